@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2022 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package c2go
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/goplus/c2go/clang/pathutil"
+	"github.com/goplus/c2go/clang/preprocessor"
+)
+
+const (
+	buildCacheFile = ".c2go/build.json"
+)
+
+// tuCache records how a translation unit (*.c file) was preprocessed.
+type tuCache struct {
+	Key  string            `json:"key"`  // hash of preprocessing options
+	Deps map[string]string `json:"deps"` // files it depends on => hash of their contents
+}
+
+// buildCache is a per-project build cache (see buildCacheFile). A translation
+// unit is preprocessed again only if its *.c file, included headers or
+// preprocessing options changed, and it's compiled again only if it or project
+// settings changed (see unitKey). A target is built again only if any of its
+// translation units or project settings changed.
+type buildCache struct {
+	TUs     map[string]*tuCache `json:"tus"`     // *.c file => its cache
+	Units   map[string]string   `json:"units"`   // Go file of a translation unit => key of its last compile
+	Targets map[string]string   `json:"targets"` // target dir => key of its last build
+
+	file   string
+	hashes map[string]string // file => hash of its content
+}
+
+func loadBuildCache(projDir string) *buildCache {
+	p := &buildCache{file: filepath.Join(projDir, buildCacheFile), hashes: make(map[string]string)}
+	if b, err := os.ReadFile(p.file); err == nil {
+		json.Unmarshal(b, p) // ignore a broken cache
+	}
+	if p.TUs == nil {
+		p.TUs = make(map[string]*tuCache)
+	}
+	if p.Units == nil {
+		p.Units = make(map[string]string)
+	}
+	if p.Targets == nil {
+		p.Targets = make(map[string]string)
+	}
+	return p
+}
+
+func (p *buildCache) save() error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(p.file), 0777)
+	return os.WriteFile(p.file, b, 0666)
+}
+
+// fileHash returns hash of content of file ("" if file doesn't exist).
+func (p *buildCache) fileHash(file string) string {
+	h, ok := p.hashes[file]
+	if !ok {
+		if b, err := os.ReadFile(file); err == nil {
+			sum := sha256.Sum256(b)
+			h = hex.EncodeToString(sum[:])
+		}
+		p.hashes[file] = h
+	}
+	return h
+}
+
+// upToDate checks if infile was preprocessed with key and none of the files
+// it depends on changed since then.
+func (p *buildCache) upToDate(infile, key string) bool {
+	tu, ok := p.TUs[absPath(infile)]
+	if !ok || tu.Key != key || len(tu.Deps) == 0 {
+		return false
+	}
+	for dep, h := range tu.Deps {
+		if p.fileHash(dep) != h {
+			return false
+		}
+	}
+	return true
+}
+
+// update records that infile was preprocessed with key. depfile is the
+// dependency file written by the preprocessor.
+func (p *buildCache) update(infile, key, depfile string) error {
+	deps, err := preprocessor.ReadDepFile(depfile)
+	if err != nil {
+		return err
+	}
+	infile = absPath(infile)
+	dir := filepath.Dir(infile)
+	tu := &tuCache{Key: key, Deps: make(map[string]string, len(deps))}
+	for _, dep := range deps {
+		dep = pathutil.Canonical(dir, dep)
+		delete(p.hashes, dep) // it may change before preprocessing
+		tu.Deps[dep] = p.fileHash(dep)
+	}
+	p.TUs[infile] = tu
+	return nil
+}
+
+// writeTU writes the state of translation unit infile into h.
+func (p *buildCache) writeTU(h hash.Hash, infile string) {
+	infile = absPath(infile)
+	fmt.Fprintln(h, infile)
+	if tu, ok := p.TUs[infile]; ok {
+		deps := make([]string, 0, len(tu.Deps))
+		for dep := range tu.Deps {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		fmt.Fprintln(h, tu.Key)
+		for _, dep := range deps {
+			fmt.Fprintln(h, dep, tu.Deps[dep])
+		}
+	}
+}
+
+func absPath(file string) string {
+	if absf, err := filepath.Abs(file); err == nil {
+		return absf
+	}
+	return file
+}
+
+// hashOf returns hash of json encoding of v.
+func hashOf(v interface{}) string {
+	b, err := json.Marshal(v)
+	check(err)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// targetKeys returns key of building current target of conf with files, and
+// key of compiling each file (see unitKey).
+func (p *buildCache) targetKeys(conf *c2goConf, flags int, files []string) (key string, units []string) {
+	h := sha256.New()
+	fmt.Fprintln(h, hashOf(conf), hashOf(conf.public), flags)
+	if exe, err := os.Executable(); err == nil { // c2go itself
+		fmt.Fprintln(h, p.fileHash(exe))
+	}
+	for _, dep := range conf.depPkgs {
+		fmt.Fprintln(h, dep.Path, p.fileHash(filepath.Join(dep.Dir, "c2go.a.pub")))
+	}
+	common := hex.EncodeToString(h.Sum(nil))
+	units = make([]string, len(files))
+	for i, file := range files {
+		units[i] = p.unitKey(common, file, flags)
+		fmt.Fprintln(h, units[i])
+	}
+	return hex.EncodeToString(h.Sum(nil)), units
+}
+
+// unitKey returns key of compiling translation unit infile, where common is
+// key of project settings.
+func (p *buildCache) unitKey(common, infile string, flags int) string {
+	h := sha256.New()
+	fmt.Fprintln(h, common)
+	p.writeTU(h, infile)
+	if (flags & FlagFromJson) != 0 { // not preprocessed: see preprocessProjFile
+		fmt.Fprintln(h, p.fileHash(infile+".i"), p.fileHash(infile+".json"), p.fileHash(infile+".macros"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
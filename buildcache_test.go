@@ -0,0 +1,70 @@
+package c2go
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildCache(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(text), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	write("a.h", "int a(void);\n")
+	files := []string{
+		write("a.c", "#include \"a.h\"\n"),
+		write("b.c", "int b;\n"),
+	}
+	depfiles := []string{
+		write("a.c.d", "a.c.o: a.c a.h\n"),
+		write("b.c.d", "b.c.o: b.c\n"),
+	}
+	cache := loadBuildCache(dir)
+	for i, file := range files {
+		if cache.upToDate(file, "k") {
+			t.Fatal("upToDate: no cache")
+		}
+		if err := cache.update(file, "k", depfiles[i]); err != nil {
+			t.Fatal("update:", err)
+		}
+	}
+	if !cache.upToDate(files[0], "k") || cache.upToDate(files[0], "k2") {
+		t.Fatal("upToDate: key")
+	}
+	conf := new(c2goConf)
+	key, units := cache.targetKeys(conf, 0, files)
+	if key2, _ := cache.targetKeys(conf, FlagFuncStub, files); key2 == key {
+		t.Fatal("targetKeys: flags")
+	}
+	if err := cache.save(); err != nil {
+		t.Fatal("save:", err)
+	}
+
+	write("a.h", "int a(int);\n")
+	cache = loadBuildCache(dir)
+	if cache.upToDate(files[0], "k") || !cache.upToDate(files[1], "k") {
+		t.Fatal("upToDate: a.h changed")
+	}
+	if err := cache.update(files[0], "k", depfiles[0]); err != nil { // preprocessed again
+		t.Fatal("update:", err)
+	}
+	key2, units2 := cache.targetKeys(conf, 0, files)
+	if key2 == key || units2[0] == units[0] || units2[1] != units[1] {
+		t.Fatal("targetKeys: a.h changed")
+	}
+}
+
+func TestBrokenBuildCache(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".c2go"), 0777)
+	os.WriteFile(filepath.Join(dir, buildCacheFile), []byte("{broken"), 0666)
+	cache := loadBuildCache(dir)
+	if cache.TUs == nil || cache.Units == nil || cache.Targets == nil {
+		t.Fatal("loadBuildCache:", cache)
+	}
+}
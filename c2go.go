@@ -29,6 +29,7 @@ import (
 	"strings"
 
 	"github.com/goplus/c2go/cl"
+	"github.com/goplus/c2go/clang/ast"
 	"github.com/goplus/c2go/clang/parser"
 	"github.com/goplus/c2go/clang/preprocessor"
 )
@@ -41,6 +42,11 @@ const (
 	FlagForcePreprocess
 	FlagDumpJson
 	FlagTestMain
+	FlagFuncStub
+	FlagLineDirective
+	FlagSourceMap
+	FlagNoASTCache
+	FlagFromJson
 
 	flagChdir
 )
@@ -68,10 +74,11 @@ func Run(pkgname, infile string, flags int, conf *Config) {
 	outfile := infile
 	switch filepath.Ext(infile) {
 	case ".i":
+	case ".json": // AST dumped by FlagDumpJson, with a sibling *.i file
+		outfile = strings.TrimSuffix(infile, ".json") + ".i"
+		flags |= FlagFromJson
 	case ".c":
-		outfile = infile + ".i"
-		err := preprocessor.Do(infile, outfile, nil)
-		check(err)
+		outfile = preprocessFile(infile, flags)
 	default:
 		if strings.HasSuffix(infile, "/...") {
 			infile = strings.TrimSuffix(infile, "/...")
@@ -159,37 +166,40 @@ func execDir(pkgname string, dir string, flags int) (n int, err error) {
 	cwd := chdir(dir)
 	defer os.Chdir(cwd)
 
-	var infile, outfile string
+	var outfile string
 	files, err := filepath.Glob("*.c")
 	check(err)
 	switch n = len(files); n {
 	case 1:
-		infile = files[0]
-		outfile = infile + ".i"
-		err = preprocessor.Do(infile, outfile, nil)
-		check(err)
+		outfile = preprocessFile(files[0], flags)
 		execFile(pkgname, outfile, flags)
 	}
 	return
 }
 
-func execFile(pkgname string, outfile string, flags int) {
-	var json []byte
-	doc, _, err := parser.ParseFileEx(outfile, 0, &parser.Config{
-		Json:   &json,
-		Stderr: true,
-	})
-	check(err)
-
-	if (flags & FlagDumpJson) != 0 {
-		os.WriteFile(strings.TrimSuffix(outfile, ".i")+".json", json, 0666)
+// preprocessFile preprocesses infile (a *.c file) into infile.i. If FlagFromJson
+// is set, it doesn't run the preprocessor but uses infile.i and infile.json
+// dumped by FlagDumpJson instead.
+func preprocessFile(infile string, flags int) (outfile string) {
+	outfile = infile + ".i"
+	if (flags & FlagFromJson) == 0 {
+		err := preprocessor.Do(infile, outfile, nil)
+		check(err)
 	}
+	return
+}
 
+func execFile(pkgname string, outfile string, flags int) {
 	needPkgInfo := (flags & FlagDepsAutoGen) != 0
-	pkg, err := cl.NewPackage("", pkgname, doc, &cl.Config{
+	jsonfile := strings.TrimSuffix(outfile, ".i") + ".json"
+	pkg, err := newPackage(pkgname, outfile, jsonfile, nil, flags, &cl.Config{
 		SrcFile: outfile, NeedPkgInfo: needPkgInfo,
+		FuncStubOnError: (flags & FlagFuncStub) != 0,
+		LineDirectives:  (flags & FlagLineDirective) != 0,
+		SourceMap:       (flags & FlagSourceMap) != 0,
 	})
 	check(err)
+	showWarnings(pkg)
 
 	gofile := outfile + ".go"
 	err = pkg.WriteFile(gofile)
@@ -216,6 +226,38 @@ func execFile(pkgname string, outfile string, flags int) {
 	}
 }
 
+// newPackage compiles outfile (a *.i file) into a Go package. AST of outfile is
+// streamed from clang, unless FlagDumpJson is set, which dumps the whole AST
+// into jsonfile. If FlagFromJson is set, AST is read from jsonfile instead and
+// clang isn't needed.
+func newPackage(pkgname, outfile, jsonfile string, cflags []string, flags int, conf *cl.Config) (cl.Package, error) {
+	if (flags & FlagFromJson) != 0 {
+		if !isFile(outfile) {
+			fatalf("%s not found: it's required to compile %s.\n", outfile, jsonfile)
+		}
+		return cl.NewPackageStream("", pkgname, func(fn func(decl *ast.Node) error) error {
+			_, err := parser.ParseJSONStream(jsonfile, 0, fn)
+			return err
+		}, conf)
+	}
+	pconf := &parser.Config{Flags: cflags, Stderr: true, Target: conf.Target}
+	if (flags & FlagDumpJson) != 0 {
+		var json []byte
+		pconf.Json = &json
+		doc, _, err := parser.ParseFileEx(outfile, 0, pconf)
+		check(err)
+		os.WriteFile(jsonfile, json, 0666)
+		return cl.NewPackage("", pkgname, doc, conf)
+	}
+	if (flags & FlagNoASTCache) == 0 {
+		pconf.CacheDir = parser.DefaultCacheDir()
+	}
+	return cl.NewPackageStream("", pkgname, func(fn func(decl *ast.Node) error) error {
+		_, _, err := parser.ParseFileStream(outfile, 0, pconf, fn)
+		return err
+	}, conf)
+}
+
 func checkEqual(prompt string, a, expected []byte) {
 	if bytes.Equal(a, expected) {
 		return
@@ -344,6 +386,14 @@ func fatalWith(err error, stdout, stderr io.Writer) {
 	log.Panicln(err)
 }
 
+func showWarnings(pkg cl.Package) {
+	for _, d := range pkg.Diagnostics() {
+		if d.Severity == cl.SevWarning {
+			fmt.Fprintln(os.Stderr, d)
+		}
+	}
+}
+
 func newError(v interface{}) error {
 	switch e := v.(type) {
 	case error:
@@ -0,0 +1,30 @@
+package c2go
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFromJson(t *testing.T) {
+	infile := filepath.Join(t.TempDir(), "foo.c")
+	os.WriteFile(infile, []byte("int foo(int a) { return a + 1; }\n"), 0666)
+	Run("main", infile, FlagDumpJson, nil)
+	gofile := infile + ".i.go"
+	expected, err := os.ReadFile(gofile)
+	if err != nil {
+		t.Fatal("FlagDumpJson:", err)
+	}
+	if !isFile(infile + ".json") {
+		t.Fatal("FlagDumpJson: no json file")
+	}
+
+	// infile isn't preprocessed again: its *.i and *.json are used
+	os.WriteFile(infile, []byte("#error not preprocessed\n"), 0666)
+	os.Remove(gofile)
+	Run("main", infile, FlagFromJson, nil)
+	if b, err := os.ReadFile(gofile); err != nil || !bytes.Equal(b, expected) {
+		t.Fatal("FlagFromJson:", string(b), err)
+	}
+}
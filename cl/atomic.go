@@ -0,0 +1,569 @@
+package cl
+
+import (
+	goast "go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/goplus/gogen"
+
+	"github.com/goplus/c2go/clang/ast"
+	ctypes "github.com/goplus/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+// C11 _Atomic objects and the __atomic_* / __sync_* builtins are lowered to
+// sync/atomic, which is sequentially consistent, so memory orders are ignored.
+// 8-bit and 16-bit values use their counterparts in package clang (see
+// clang/atomic.go), and operations sync/atomic lacks are compare-and-swap loops.
+
+const syncAtomicPkgPath = "sync/atomic"
+
+// isAtomicType reports whether t is an _Atomic(T) type.
+func isAtomicType(t *ast.Type) bool {
+	if t == nil {
+		return false
+	}
+	qt := t.QualType
+	if t.DesugaredQualType != "" {
+		qt = t.DesugaredQualType
+	}
+	qt = strings.TrimPrefix(strings.TrimPrefix(qt, "const "), "volatile ")
+	return strings.HasPrefix(qt, "_Atomic(") && strings.HasSuffix(qt, ")")
+}
+
+// atomicKind tells which functions access an object atomically.
+type atomicKind struct {
+	pkg  string     // syncAtomicPkgPath or clangPkgPath
+	name string     // suffix of the function names, like Int32 of atomic.AddInt32
+	arg  types.Type // operand type of the functions
+}
+
+var atomicKinds = map[types.BasicKind]string{
+	types.Int32:   "Int32",
+	types.Uint32:  "Uint32",
+	types.Int64:   "Int64",
+	types.Uint64:  "Uint64",
+	types.Uintptr: "Uintptr",
+}
+
+func atomicKindOf(t types.Type) (kind atomicKind, ok bool) {
+	switch t := t.(type) {
+	case *types.Pointer:
+		return atomicKind{syncAtomicPkgPath, "Pointer", ctypes.UnsafePointer}, true
+	case *types.Basic:
+		switch k := t.Kind(); k {
+		case types.UnsafePointer:
+			return atomicKind{syncAtomicPkgPath, "Pointer", ctypes.UnsafePointer}, true
+		case types.Int8, types.Uint8, types.Bool:
+			return atomicKind{clangPkgPath, "Uint8", types.Typ[types.Uint8]}, true
+		case types.Int16, types.Uint16:
+			return atomicKind{clangPkgPath, "Uint16", types.Typ[types.Uint16]}, true
+		default:
+			if name, ok := atomicKinds[k]; ok {
+				return atomicKind{syncAtomicPkgPath, name, t}, true
+			}
+		}
+	}
+	return
+}
+
+// atomicObj emits atomic accesses to a C object of Go type typ. Addresses
+// passed to its methods are converted by ptr, and values are of type typ.
+type atomicObj struct {
+	atomicKind
+	ctx     *blockCtx
+	typ     types.Type
+	src     *ast.Node
+	discard bool // the result is unused: leave it as a call, so it's a valid statement
+}
+
+func newAtomicObj(ctx *blockCtx, ptr types.Type, src *ast.Node, flags int) *atomicObj {
+	t, ok := ptr.(*types.Pointer)
+	if !ok {
+		ctx.panicf(src, "atomic operation on non-pointer type %v", ptr)
+	}
+	kind, ok := atomicKindOf(t.Elem())
+	if !ok {
+		ctx.panicf(src, "atomic operation on type %v is not supported", t.Elem())
+	}
+	return &atomicObj{kind, ctx, t.Elem(), src, (flags & flagIgnoreResult) != 0}
+}
+
+func (p *atomicObj) isPointer() bool {
+	return p.name == "Pointer"
+}
+
+func (p *atomicObj) fn(op string) *gogen.CodeBuilder {
+	return p.ctx.cb.Val(p.ctx.pkg.Import(p.pkg).Ref(op + p.name))
+}
+
+// ptr converts addr, a pointer to the object, to a pointer to the operand type.
+func (p *atomicObj) ptr(addr *gogen.Element) *gogen.Element {
+	if ctypes.Identical(p.typ, p.arg) {
+		return addr
+	}
+	cb := p.ctx.cb
+	castPtrType(cb, types.NewPointer(p.arg), addr)
+	return cb.InternalStack().Pop()
+}
+
+// toArg converts the value on the top of the stack to the operand type.
+func (p *atomicObj) toArg() {
+	atomicConv(p.ctx, p.arg, p.ctx.cb.InternalStack().Pop())
+}
+
+// toObj converts the value on the top of the stack to the object type.
+func (p *atomicObj) toObj() {
+	atomicConv(p.ctx, p.typ, p.ctx.cb.InternalStack().Pop())
+}
+
+// ret converts the result on the top of the stack to the object type.
+func (p *atomicObj) ret() {
+	if !p.discard {
+		p.toObj()
+	}
+}
+
+func atomicConv(ctx *blockCtx, typ types.Type, v *gogen.Element) {
+	cb := ctx.cb
+	switch {
+	case ctypes.Identical(typ, v.Type):
+		cb.Val(v)
+	case isBool(typ): // uint8 => bool
+		cb.Val(v).Val(0).BinaryOp(token.NEQ)
+	case isBool(v.Type): // bool => uint8
+		v, _ = gogen.CastFromBool(cb, typ, v)
+		cb.Val(v)
+	default:
+		cb.Typ(typ).Val(v)
+		typeCastCall(ctx, typ)
+	}
+}
+
+func (p *atomicObj) load(addr interface{}) {
+	p.fn("Load").Val(addr).Call(1)
+	p.ret()
+}
+
+func (p *atomicObj) store(addr interface{}, v interface{}) {
+	p.fn("Store").Val(addr).Val(v)
+	p.toArg()
+	p.ctx.cb.Call(2)
+}
+
+func (p *atomicObj) swap(addr interface{}, v interface{}) {
+	p.fn("Swap").Val(addr).Val(v)
+	p.toArg()
+	p.ctx.cb.Call(2)
+	p.ret()
+}
+
+func (p *atomicObj) compareAndSwap(addr interface{}, old, new interface{}) {
+	cb := p.fn("CompareAndSwap").Val(addr).Val(old)
+	p.toArg()
+	cb.Val(new)
+	p.toArg()
+	cb.Call(3)
+}
+
+// add adds delta (or -delta if neg) to the object and pushes its new value.
+func (p *atomicObj) add(addr interface{}, delta *gogen.Element, neg bool) {
+	cb := p.fn("Add").Val(addr).Val(delta)
+	p.toArg()
+	if neg {
+		stk := cb.InternalStack()
+		if v := stk.Get(-1); v.CVal != nil && isUnsigned(v.Type) { // -c overflows: use 2^n - c
+			mod := constant.Shift(constant.MakeInt64(1), token.SHL, uint(8*p.ctx.sizeof(v.Type)))
+			c := constant.BinaryOp(constant.BinaryOp(mod, token.SUB, v.CVal), token.REM, mod)
+			stk.Pop()
+			cb.Typ(v.Type).Val(&goast.BasicLit{Kind: token.INT, Value: c.ExactString()}).Call(1)
+		} else {
+			cb.UnaryOp(token.SUB)
+		}
+	}
+	cb.Call(2)
+	p.ret()
+}
+
+// tokNand is ^(x & y) in modify, not x &^ y.
+const tokNand = token.AND_NOT
+
+// modify replaces the object x with (x op v) atomically, and pushes the old
+// value of x if retOld, or the new one.
+func (p *atomicObj) modify(addr interface{}, v *gogen.Element, op token.Token, retOld bool) {
+	ctx := p.ctx
+	retOld = retOld && !p.discard
+	if p.isPointer() {
+		if isUntyped(v.Type) {
+			typeCast(ctx, ctypes.Int, v)
+		}
+	} else {
+		typeCast(ctx, p.typ, v)
+		if (op == token.ADD || op == token.SUB) && (!retOld || v.CVal != nil) {
+			p.add(addr, v, op == token.SUB)
+			if retOld { // new - v, or new + v
+				ctx.cb.Val(v).BinaryOp((token.ADD + token.SUB) - op)
+			}
+			return
+		}
+	}
+	p.closure(p.typ, []string{"_cgo_val"}, func(params []*types.Var) {
+		cb := ctx.cb
+		p.casLoop(params[0], nil, func(old types.Object) {
+			cb.Val(old)
+			p.toObj()
+			cb.Val(params[1])
+			if op == tokNand {
+				binaryOp(ctx, token.AND, p.src)
+				cb.UnaryOp(token.XOR)
+			} else {
+				binaryOp(ctx, op, p.src)
+			}
+			p.toArg()
+		}, func(old, new types.Object) {
+			if retOld {
+				cb.Val(old)
+			} else {
+				cb.Val(new)
+			}
+			p.toObj()
+			cb.Return(1)
+		})
+	}, addr, v)
+}
+
+// compareExchange compares the object with *exp: if they are equal it stores
+// des into the object, otherwise it stores the object into *exp. It pushes
+// whether the object was changed.
+func (p *atomicObj) compareExchange(addr interface{}, exp, des *gogen.Element) {
+	ctx := p.ctx
+	typeCast(ctx, p.typ, des)
+	p.closure(types.Typ[types.Bool], []string{"_cgo_exp", "_cgo_des"}, func(params []*types.Var) {
+		cb := ctx.cb
+		exp, des := params[1], params[2]
+		p.casLoop(params[0], func(old types.Object) {
+			cb.If().Val(old).Val(exp).Elem()
+			p.toArg()
+			cb.BinaryOp(token.NEQ).Then()
+			cb.Val(exp).ElemRef().Val(old)
+			p.toObj()
+			cb.Assign(1).Val(false).Return(1).End()
+		}, func(old types.Object) {
+			cb.Val(des)
+			p.toArg()
+		}, func(old, new types.Object) {
+			cb.Val(true).Return(1)
+		})
+	}, addr, exp, des)
+}
+
+// valCompareAndSwap stores new into the object if it equals old, and pushes
+// the value the object had.
+func (p *atomicObj) valCompareAndSwap(addr interface{}, old, new *gogen.Element) {
+	ctx := p.ctx
+	typeCast(ctx, p.typ, old)
+	typeCast(ctx, p.typ, new)
+	p.closure(p.typ, []string{"_cgo_cmp", "_cgo_des"}, func(params []*types.Var) {
+		cb := ctx.cb
+		cmp, des := params[1], params[2]
+		p.casLoop(params[0], func(old types.Object) {
+			cb.If().Val(old).Val(cmp)
+			p.toArg()
+			cb.BinaryOp(token.NEQ).Then().Val(old)
+			p.toObj()
+			cb.Return(1).End()
+		}, func(old types.Object) {
+			cb.Val(des)
+			p.toArg()
+		}, func(old, new types.Object) {
+			cb.Val(cmp).Return(1)
+		})
+	}, addr, old, new)
+}
+
+// closure emits func(_cgo_addr, names...) ret { body }(addr, args...).
+func (p *atomicObj) closure(
+	ret types.Type, names []string, body func(params []*types.Var), addr interface{}, args ...*gogen.Element) {
+	ctx := p.ctx
+	cb, pkg := ctx.cb, ctx.pkg
+	pos := ctx.goNodePos(p.src)
+	params := make([]*types.Var, len(args)+1)
+	params[0] = pkg.NewParam(pos, "_cgo_addr", types.NewPointer(p.arg))
+	for i, arg := range args {
+		params[i+1] = pkg.NewParam(pos, names[i], arg.Type)
+	}
+	results := types.NewTuple(pkg.NewParam(pos, "", ret))
+	cb.NewClosure(types.NewTuple(params...), results, false).BodyStart(pkg)
+	body(params)
+	cb.End().Val(addr)
+	for _, arg := range args {
+		cb.Val(arg)
+	}
+	cb.CallWith(len(params), 0, ctx.goNode(p.src))
+}
+
+// casLoop emits:
+//
+//	for {
+//		_cgo_old := LoadT(addr)
+//		check(_cgo_old)
+//		_cgo_new := update(_cgo_old)
+//		if CompareAndSwapT(addr, _cgo_old, _cgo_new) {
+//			done(_cgo_old, _cgo_new)
+//		}
+//	}
+func (p *atomicObj) casLoop(
+	addr *types.Var, check, update func(old types.Object), done func(old, new types.Object)) {
+	ctx := p.ctx
+	cb := ctx.cb
+	pos := ctx.goNodePos(p.src)
+	cb.For().None().Then()
+	cb.DefineVarStart(pos, "_cgo_old")
+	p.fn("Load").Val(addr).Call(1).EndInit(1)
+	old := cb.Scope().Lookup("_cgo_old")
+	if check != nil {
+		check(old)
+	}
+	cb.DefineVarStart(pos, "_cgo_new")
+	update(old)
+	cb.EndInit(1)
+	new := cb.Scope().Lookup("_cgo_new")
+	cb.If()
+	p.fn("CompareAndSwap").Val(addr).Val(old).Val(new).Call(3).Then()
+	done(old, new)
+	cb.End().End()
+}
+
+// -----------------------------------------------------------------------------
+
+var atomicFetchOps = map[string]token.Token{
+	"add":  token.ADD,
+	"sub":  token.SUB,
+	"and":  token.AND,
+	"or":   token.OR,
+	"xor":  token.XOR,
+	"nand": tokNand,
+}
+
+// parseFetchOp parses __atomic_fetch_OP, __atomic_OP_fetch, __sync_fetch_and_OP,
+// __sync_OP_and_fetch and so on. retOld reports whether it returns the old value.
+func parseFetchOp(name string) (op token.Token, retOld, ok bool) {
+	for _, prefix := range []string{"__atomic_fetch_", "__c11_atomic_fetch_", "__sync_fetch_and_"} {
+		if strings.HasPrefix(name, prefix) {
+			op, ok = atomicFetchOps[name[len(prefix):]]
+			return op, true, ok
+		}
+	}
+	if strings.HasPrefix(name, "__sync_") && strings.HasSuffix(name, "_and_fetch") {
+		op, ok = atomicFetchOps[name[7:len(name)-10]]
+	} else if strings.HasPrefix(name, "__atomic_") && strings.HasSuffix(name, "_fetch") {
+		op, ok = atomicFetchOps[name[9:len(name)-6]]
+	}
+	return
+}
+
+// fetchOp modifies the object with op and v, and pushes its old value if retOld,
+// or the new one. Unlike p += v, v of a pointer object is in bytes (GCC doesn't
+// scale it), so the object is modified as a char pointer.
+func (p *atomicObj) fetchOp(addr interface{}, v *gogen.Element, op token.Token, retOld bool) {
+	if !p.isPointer() {
+		p.modify(addr, v, op, retOld)
+		return
+	}
+	if op != token.ADD && op != token.SUB {
+		p.ctx.panicf(p.src, "atomic bitwise operation on pointer type %v is not supported", p.typ)
+	}
+	obj := *p
+	obj.typ = tyCharPtr
+	obj.modify(addr, v, op, retOld)
+	p.ret()
+}
+
+// fetchOperand compiles the operand of a fetch op. Clang casts it to the type of
+// a pointer object, but it's an integer in bytes (see fetchOp).
+func fetchOperand(ctx *blockCtx, v *ast.Node) *gogen.Element {
+	if v.Kind == ast.ImplicitCastExpr && v.CastKind == ast.IntegralToPointer {
+		v = v.Inner[0]
+	}
+	compileExpr(ctx, v)
+	return ctx.cb.InternalStack().Pop()
+}
+
+// compileAtomicExpr compiles the __atomic_* and __c11_atomic_* builtins, which
+// clang represents as AtomicExpr. Its operands are Ptr, Order, Val1, OrderFail,
+// Val2 and Weak, each present or not depending on the builtin.
+func compileAtomicExpr(ctx *blockCtx, v *ast.Node, flags int) {
+	name := ctx.getInstr(v)
+	stk := ctx.cb.InternalStack()
+	arg := func(i int) *gogen.Element {
+		compileExpr(ctx, v.Inner[i])
+		return stk.Pop()
+	}
+	elem := func(i int) *gogen.Element {
+		compileExpr(ctx, v.Inner[i])
+		return ctx.cb.Elem().InternalStack().Pop()
+	}
+	ptr := arg(0)
+	obj := newAtomicObj(ctx, ptr.Type, v, flags)
+	addr := obj.ptr(ptr)
+	switch name {
+	case "__c11_atomic_init":
+		obj.store(addr, arg(1))
+	case "__atomic_load_n", "__c11_atomic_load":
+		obj.load(addr)
+	case "__atomic_load": // *ret = *ptr
+		obj.load(addr)
+		val := stk.Pop()
+		obj.store(obj.ptr(arg(2)), val)
+	case "__atomic_store_n", "__c11_atomic_store":
+		obj.store(addr, arg(2))
+	case "__atomic_store":
+		obj.store(addr, elem(2))
+	case "__atomic_exchange_n", "__c11_atomic_exchange":
+		obj.swap(addr, arg(2))
+	case "__atomic_exchange": // *ret = xchg(ptr, *val)
+		obj.swap(addr, elem(2))
+		old := stk.Pop()
+		obj.store(obj.ptr(arg(3)), old)
+	case "__atomic_compare_exchange_n",
+		"__c11_atomic_compare_exchange_strong", "__c11_atomic_compare_exchange_weak":
+		obj.compareExchange(addr, arg(2), arg(4))
+	case "__atomic_compare_exchange":
+		obj.compareExchange(addr, arg(2), elem(4))
+	default:
+		op, retOld, ok := parseFetchOp(name)
+		if !ok {
+			ctx.panicf(v, "unsupported atomic builtin %s", name)
+		}
+		obj.fetchOp(addr, fetchOperand(ctx, v.Inner[2]), op, retOld)
+	}
+}
+
+// compileAtomicBuiltin compiles a call to an __atomic_* builtin function that
+// isn't an AtomicExpr, or to a __sync_* one. It reports false if the function
+// isn't one of them.
+func compileAtomicBuiltin(ctx *blockCtx, v *ast.Node, name string, flags int) bool {
+	cb := ctx.cb
+	stk := cb.InternalStack()
+	arg := func(i int) *gogen.Element {
+		compileExpr(ctx, v.Inner[i])
+		return stk.Pop()
+	}
+	switch name {
+	case "__atomic_thread_fence", "__atomic_signal_fence":
+		return true // nothing to do: sync/atomic operations are sequentially consistent
+	case "__atomic_test_and_set", "__atomic_clear": // on the byte at a volatile void *
+		obj := newAtomicObj(ctx, tyUint8Ptr, v, flags)
+		addr := cb.Typ(tyUint8Ptr).Val(arg(1)).Call(1).InternalStack().Pop()
+		if name == "__atomic_clear" {
+			obj.store(addr, 0)
+		} else if obj.swap(addr, 1); !obj.discard {
+			cb.Val(0).BinaryOp(token.NEQ)
+		}
+		return true
+	case "__sync_synchronize": // see builtin_decls
+		return false
+	}
+	if !strings.HasPrefix(name, "__sync_") {
+		return false
+	}
+	if pos := strings.LastIndexByte(name, '_'); pos > 0 { // __sync_fetch_and_add_4, etc.
+		switch name[pos+1:] {
+		case "1", "2", "4", "8", "16":
+			name = name[:pos]
+		}
+	}
+	ptr := arg(1)
+	obj := newAtomicObj(ctx, ptr.Type, v, flags)
+	addr := obj.ptr(ptr)
+	switch name {
+	case "__sync_bool_compare_and_swap":
+		obj.compareAndSwap(addr, arg(2), arg(3))
+	case "__sync_val_compare_and_swap":
+		obj.valCompareAndSwap(addr, arg(2), arg(3))
+	case "__sync_lock_test_and_set", "__sync_swap":
+		obj.swap(addr, arg(2))
+	case "__sync_lock_release":
+		obj.store(addr, cb.ZeroLit(obj.typ).InternalStack().Pop())
+	default:
+		op, retOld, ok := parseFetchOp(name)
+		if !ok {
+			ctx.panicf(v, "unsupported atomic builtin %s", name)
+		}
+		obj.fetchOp(addr, fetchOperand(ctx, v.Inner[2]), op, retOld)
+	}
+	return true
+}
+
+var (
+	tyUint8Ptr = types.NewPointer(types.Typ[types.Uint8])
+	tyCharPtr  = types.NewPointer(types.Typ[types.Int8])
+)
+
+// -----------------------------------------------------------------------------
+
+// atomicAddr compiles &x, where x is an _Atomic object.
+func atomicAddr(ctx *blockCtx, x *ast.Node) *gogen.Element {
+	compileExprLHS(ctx, x)
+	return ctx.cb.UnaryOp(token.AND).InternalStack().Pop()
+}
+
+// compileAtomicLoad compiles an AtomicToNonAtomic cast, which loads an _Atomic
+// object.
+func compileAtomicLoad(ctx *blockCtx, v *ast.Node) {
+	x := v.Inner[0]
+	if x.Kind != ast.ImplicitCastExpr || x.CastKind != ast.LValueToRValue {
+		compileExpr(ctx, x)
+		return
+	}
+	ptr := atomicAddr(ctx, x.Inner[0])
+	obj := newAtomicObj(ctx, ptr.Type, v, 0)
+	obj.load(obj.ptr(ptr))
+}
+
+// compileAtomicAssignExpr compiles x = v, where x is an _Atomic object.
+func compileAtomicAssignExpr(ctx *blockCtx, v *ast.Node, flags int) {
+	ptr := atomicAddr(ctx, v.Inner[0])
+	obj := newAtomicObj(ctx, ptr.Type, v, flags)
+	addr := obj.ptr(ptr)
+	compileExpr(ctx, v.Inner[1])
+	val := ctx.cb.InternalStack().Pop()
+	if obj.discard {
+		obj.store(addr, val)
+		return
+	}
+	typeCast(ctx, obj.typ, val)
+	obj.closure(obj.typ, []string{"_cgo_val"}, func(params []*types.Var) {
+		obj.store(params[0], params[1])
+		ctx.cb.EndStmt().Val(params[1]).Return(1)
+	}, addr, val)
+}
+
+// compileAtomicAssignOpExpr compiles x op= v, where x is an _Atomic object.
+func compileAtomicAssignOpExpr(ctx *blockCtx, op token.Token, v *ast.Node, flags int) {
+	ptr := atomicAddr(ctx, v.Inner[0])
+	obj := newAtomicObj(ctx, ptr.Type, v, flags)
+	addr := obj.ptr(ptr)
+	compileExpr(ctx, v.Inner[1])
+	obj.modify(addr, ctx.cb.InternalStack().Pop(), op-(token.ADD_ASSIGN-token.ADD), false)
+}
+
+// compileAtomicIncDec compiles ++x, --x, x++ and x--, where x is an _Atomic
+// object.
+func compileAtomicIncDec(ctx *blockCtx, tok token.Token, v *ast.Node, flags int) {
+	ptr := atomicAddr(ctx, v.Inner[0])
+	obj := newAtomicObj(ctx, ptr.Type, v, flags)
+	addr := obj.ptr(ptr)
+	op := token.ADD
+	if tok == token.DEC {
+		op = token.SUB
+	}
+	one := ctx.cb.Val(1).InternalStack().Pop()
+	obj.modify(addr, one, op, v.IsPostfix)
+}
+
+// -----------------------------------------------------------------------------
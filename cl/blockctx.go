@@ -7,6 +7,8 @@ import (
 	"go/types"
 	"log"
 	"os"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -25,6 +27,9 @@ const (
 
 type funcCtx struct {
 	labels  map[string]*gogen.Label
+	addrs   map[string]int // indexes of address-taken labels (&&label)
+	lblv    *types.Var     // addresses of the labels, see compileAddrLabelExpr
+	jmp     *jmpCtx        // setjmp call sites, see compileSetjmpBody
 	vdefs   *gogen.VarDefs
 	basel   int
 	basev   int
@@ -198,9 +203,12 @@ type blockCtx struct {
 	fset     *token.FileSet
 	tyI128   types.Type
 	tyU128   types.Type
+	tyLDbl   types.Type // nil means ctypes.LongDouble (see LDMode)
 	unnameds map[ast.ID]unnamedType
 	gblvars  map[string]*gogen.VarDefs
 	public   map[string]string
+	pubFrom  []string // absolute paths of conf.PublicFrom
+	inPub    bool     // if current decl is in PublicFrom (see markPublic)
 	ignored  []string
 	srcdir   string
 	srcfile  string
@@ -209,8 +217,20 @@ type blockCtx struct {
 	curfn    *funcCtx
 	curflow  flowCtx
 	bfm      BFMode
+	builtins map[string]*BuiltinFunc // extra builtins (see Config.Builtins)
+	ldm      LDMode
+	target   *ctypes.Target // nil means the host
+	sizes    types.Sizes
+	aligns   map[*types.Named]int // alignments of C types unlike their Go types
+	packs    []pragmaPack         // see packOf
+	packsOk  bool
 	multiFileCtl
+	diagCtx
 	testMain bool
+	funcStub bool
+	lineDir  bool
+	skipBody bool // see Config.SkipFuncBodies
+	srcmap   *srcMap
 }
 
 func (p *blockCtx) Pkg() *types.Package {
@@ -218,13 +238,51 @@ func (p *blockCtx) Pkg() *types.Package {
 }
 
 func (p *blockCtx) Int128() types.Type {
+	if p.tyI128 == nil {
+		p.initInt128()
+	}
 	return p.tyI128
 }
 
 func (p *blockCtx) Uint128() types.Type {
+	if p.tyU128 == nil {
+		p.initInt128()
+	}
 	return p.tyU128
 }
 
+// initInt128 imports runtime types of __int128 on demand, since it's rarely
+// used (see ctypes.Int128).
+func (p *blockCtx) initInt128() {
+	c := p.pkg.Import(clangPkgPath)
+	p.tyI128 = c.Ref("Int128").Type()
+	p.tyU128 = c.Ref("Uint128").Type()
+}
+
+// long returns Go type of C long on the target.
+func (p *blockCtx) long() types.Type {
+	if p.target != nil {
+		return p.target.Long()
+	}
+	return ctypes.Long
+}
+
+// ulong returns Go type of C unsigned long on the target.
+func (p *blockCtx) ulong() types.Type {
+	if p.target != nil {
+		return p.target.Ulong()
+	}
+	return ctypes.Ulong
+}
+
+// biggestAlign returns alignment of __attribute__((aligned)) on the target.
+func (p *blockCtx) biggestAlign() int {
+	if p.target != nil {
+		return p.target.BiggestAlign()
+	}
+	return ctypes.BiggestAlign
+}
+
 func (p *blockCtx) deleteUnnamed(id ast.ID) {
 	if u, ok := p.unnameds[id]; ok {
 		for _, delName := range u.del {
@@ -241,12 +299,18 @@ func (p *blockCtx) deleteByName(name string) {
 }
 
 func (p *blockCtx) addExternFunc(name string) {
+	if !p.isIgnored(name) {
+		p.extfns[name] = none{}
+	}
+}
+
+func (p *blockCtx) isIgnored(name string) bool {
 	for _, ign := range p.ignored {
 		if ign == name {
-			return
+			return true
 		}
 	}
-	p.extfns[name] = none{}
+	return false
 }
 
 func (p *blockCtx) lookupParent(name string) types.Object {
@@ -395,6 +459,102 @@ func (p *blockCtx) paramOfSizeof(v *ast.Node) string {
 	return paramsOf(src[off+n : v.Range.End.Offset])
 }
 
+// A pragmaPack is max field alignment by a #pragma pack at offset off of the
+// source, which is in effect until the next one. It's -1 if the pragma can't
+// be evaluated, and so are all the later ones.
+type pragmaPack struct {
+	off  int
+	pack int
+}
+
+// packOf returns max field alignment by #pragma pack for struct or union decl,
+// which clang doesn't dump (see MaxFieldAlignmentAttr). It returns -1 if the
+// pragma can't be evaluated, 0 if there's none.
+func (p *blockCtx) packOf(decl *ast.Node) int {
+	end, ok := nodeOffset(decl)
+	if !ok {
+		return -1
+	}
+	if !p.packsOk {
+		p.packs, p.packsOk = pragmaPacks(p.src), true
+	}
+	packs := p.packs
+	i := sort.Search(len(packs), func(i int) bool {
+		return packs[i].off >= end
+	})
+	if i == 0 {
+		return 0
+	}
+	return packs[i-1].pack
+}
+
+// pragmaPacks evaluates all #pragma pack of src in one pass.
+func pragmaPacks(src []byte) (packs []pragmaPack) {
+	type packItem struct {
+		label string
+		pack  int
+	}
+	var stack []packItem
+	var pack int
+	for off := 0; off < len(src); {
+		line := src[off:]
+		if pos := bytes.IndexByte(line, '\n'); pos >= 0 {
+			line = line[:pos]
+		}
+		lineOff := off
+		off += len(line) + 1
+		line = bytes.TrimLeft(line, space)
+		if !bytes.HasPrefix(line, []byte("#pragma")) {
+			continue
+		}
+		text := strings.TrimLeft(string(line[7:]), space)
+		if !strings.HasPrefix(text, "pack") {
+			continue
+		}
+		text = strings.TrimSpace(text[4:])
+		if !strings.HasPrefix(text, "(") || !strings.HasSuffix(text, ")") {
+			return append(packs, pragmaPack{lineOff, -1})
+		}
+		args := strings.Split(text[1:len(text)-1], ",")
+		for i, arg := range args {
+			args[i] = strings.TrimSpace(arg)
+		}
+		n, err := strconv.Atoi(args[len(args)-1])
+		switch op := args[0]; {
+		case len(args) == 1 && (op == "" || err == nil): // pack(), pack(n)
+			pack = n
+		case op == "push" && (len(args) == 1 || err == nil && len(args) <= 3):
+			label := ""
+			if len(args) == 3 {
+				label = args[1]
+			}
+			stack = append(stack, packItem{label, pack})
+			if len(args) > 1 {
+				pack = n
+			}
+		case op == "pop" && len(args) <= 2:
+			label := ""
+			if len(args) == 2 && err != nil {
+				label = args[1]
+			}
+			for i := len(stack) - 1; i >= 0; i-- {
+				if label == "" || stack[i].label == label {
+					pack, stack = stack[i].pack, stack[:i]
+					break
+				}
+			}
+			if len(args) == 2 && err == nil {
+				pack = n
+			}
+		case op == "show":
+		default: // maybe a macro
+			return append(packs, pragmaPack{lineOff, -1})
+		}
+		packs = append(packs, pragmaPack{lineOff, pack})
+	}
+	return packs
+}
+
 func (p *blockCtx) getInstr(v *ast.Node) string {
 	src := p.src
 	off := v.Range.Begin.Offset
@@ -414,7 +574,29 @@ func ident(b []byte, msg string) string {
 }
 
 func (p *blockCtx) sizeof(typ types.Type) int {
-	return int(p.pkg.Sizeof(typ))
+	size, align := p.sizes.Sizeof(typ), p.sizes.Alignof(typ)
+	return int((size + align - 1) / align * align)
+}
+
+// alignof returns alignment of typ as clang lays it out, which isn't the Go one
+// for structs with packed or aligned attributes (see structBuilder).
+func (p *blockCtx) alignof(typ types.Type) int {
+	switch t := typ.(type) {
+	case *types.Named:
+		if align, ok := p.aligns[t]; ok {
+			return align
+		}
+	case *types.Array:
+		return p.alignof(t.Elem())
+	}
+	return int(p.sizes.Alignof(typ))
+}
+
+func (p *blockCtx) setAlign(t *types.Named, align int) {
+	if p.aligns == nil {
+		p.aligns = make(map[*types.Named]int)
+	}
+	p.aligns[t] = align
 }
 
 func (p *blockCtx) offsetof(typ types.Type, name string) int {
@@ -422,9 +604,16 @@ retry:
 	switch t := typ.(type) {
 	case *types.Struct:
 		if flds, idx := getFld(t, name, 0); idx >= 0 {
-			return int(p.pkg.Offsetsof(flds)[idx])
+			return int(p.sizes.Offsetsof(flds)[idx])
 		}
 	case *types.Named:
+		if vfs, ok := p.pkg.VFields(t); ok {
+			if sf, ok := vfs.(*structFields); ok {
+				if fld := sf.unalignedField(name); fld != nil {
+					return fld.Off
+				}
+			}
+		}
 		typ = t.Underlying()
 		goto retry
 	}
@@ -524,15 +713,25 @@ func (p *bfType) String() string {
 		aliasType(scope, pkg, name, c.Ref(cname).Type())
 	}
 */
+var hostSizes = types.SizesFor("gc", runtime.GOARCH)
+
 func (p *blockCtx) initCTypes() {
 	pkg := p.pkg.Types
 	scope := pkg.Scope()
-	p.tyI128 = ctypes.NotImpl
-	p.tyU128 = ctypes.NotImpl
+	p.sizes = hostSizes
+	if p.target != nil {
+		p.sizes = p.target.Sizes()
+	}
+	switch p.ldm {
+	case LDM_X87:
+		p.tyLDbl = p.pkg.Import(clangPkgPath).Ref("Float80").Type()
+	case LDM_Binary128:
+		p.tyLDbl = p.pkg.Import(clangPkgPath).Ref("Float128").Type()
+	}
 
-	aliasType(scope, pkg, "__int128", p.tyI128)
-	aliasType(scope, pkg, "__int128_t", p.tyI128)
-	aliasType(scope, pkg, "__uint128_t", p.tyU128)
+	aliasType(scope, pkg, "__int128", ctypes.Int128)
+	aliasType(scope, pkg, "__int128_t", ctypes.Int128)
+	aliasType(scope, pkg, "__uint128_t", ctypes.Uint128)
 
 	aliasType(scope, pkg, "void", ctypes.Void)
 
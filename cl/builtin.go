@@ -0,0 +1,237 @@
+package cl
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/goplus/gogen"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+// Bit manipulation builtins are lowered to math/bits, the overflow checking ones
+// to inline closures, so they need no definitions in libc, whatever BFMode is.
+
+const mathBitsPkgPath = "math/bits"
+
+var bitsBuiltins = map[string]string{
+	"clz":      "LeadingZeros",
+	"ctz":      "TrailingZeros",
+	"popcount": "OnesCount",
+	"parity":   "OnesCount",
+	"ffs":      "TrailingZeros",
+}
+
+var overflowBuiltins = map[string]token.Token{
+	"add": token.ADD,
+	"sub": token.SUB,
+	"mul": token.MUL,
+}
+
+// compileBitsBuiltin compiles a call to a bit manipulation, overflow checking or
+// control flow builtin function, and reports whether name is one of them.
+func compileBitsBuiltin(ctx *blockCtx, v *ast.Node, name string, flags int) bool {
+	cb := ctx.cb
+	discard := (flags & flagIgnoreResult) != 0
+	switch name {
+	case "__builtin_unreachable", "__builtin_trap":
+		cb.Val(ctx.pkg.Builtin().Ref("panic")).Val(name).CallWith(1, 0, ctx.goNode(v))
+		return true
+	case "__builtin_assume": // its argument isn't evaluated
+		return true
+	}
+	if !strings.HasPrefix(name, "__builtin_") {
+		return false
+	}
+	fn := name[10:]
+	if strings.HasSuffix(fn, "_overflow") {
+		op, ok := overflowOpOf(strings.TrimSuffix(fn, "_overflow"))
+		if !ok {
+			return false
+		}
+		compileOverflowBuiltin(ctx, v, op)
+		return true
+	}
+	if rot := strings.TrimPrefix(strings.TrimPrefix(fn, "rotateleft"), "rotateright"); rot != fn {
+		switch rot {
+		case "8", "16", "32", "64":
+		default:
+			return false
+		}
+		compileExpr(ctx, v.Inner[1])
+		compileExpr(ctx, v.Inner[2])
+		n := cb.InternalStack().Pop()
+		x := cb.InternalStack().Pop()
+		typeCast(ctx, types.Typ[types.Int], n)
+		cb.Val(ctx.pkg.Import(mathBitsPkgPath).Ref("RotateLeft" + rot)).Val(x).Val(n)
+		if strings.HasPrefix(fn, "rotateright") {
+			cb.UnaryOp(token.SUB)
+		}
+		cb.CallWith(2, 0, ctx.goNode(v))
+		return true
+	}
+	base := strings.TrimSuffix(strings.TrimSuffix(fn, "l"), "l") // clzl, clzll, etc.
+	op, ok := bitsBuiltins[base]
+	if !ok {
+		return false
+	}
+	compileExpr(ctx, v.Inner[1])
+	x := cb.InternalStack().Pop()
+	bits := 32
+	if ctx.sizeof(x.Type) == 8 {
+		op, bits = op+"64", 64
+		typeCast(ctx, types.Typ[types.Uint64], x)
+	} else {
+		op += "32"
+		typeCast(ctx, types.Typ[types.Uint32], x)
+	}
+	cb.Val(ctx.pkg.Import(mathBitsPkgPath).Ref(op)).Val(x).CallWith(1, 0, ctx.goNode(v))
+	if discard {
+		return true
+	}
+	switch base {
+	case "parity":
+		cb.Val(1).BinaryOp(token.AND)
+	case "ffs": // ffs(0) = 0, while TrailingZeros(0) = bits
+		cb.Val(1).BinaryOp(token.ADD).Val(bits + 1).BinaryOp(token.REM)
+	}
+	ret := cb.InternalStack().Pop()
+	typeCast(ctx, toType(ctx, v.Type, 0), ret)
+	cb.Val(ret)
+	return true
+}
+
+// overflowOpOf parses OP of __builtin_OP_overflow: add, sub and mul, optionally
+// prefixed by s or u, and suffixed by l or ll, like saddl.
+func overflowOpOf(name string) (op token.Token, ok bool) {
+	if op, ok = overflowBuiltins[name]; ok {
+		return
+	}
+	if name != "" && (name[0] == 's' || name[0] == 'u') {
+		for _, suffix := range []string{"", "l", "ll"} {
+			if op, ok = overflowBuiltins[strings.TrimSuffix(name[1:], suffix)]; ok {
+				return
+			}
+		}
+	}
+	return
+}
+
+// compileOverflowBuiltin compiles __builtin_OP_overflow(a, b, res), which stores
+// a OP b to *res and reports whether it doesn't fit, as:
+//
+//	func(_cgo_a, _cgo_b W, _cgo_res *T) bool {
+//		_cgo_v := _cgo_a OP _cgo_b
+//		*_cgo_res = T(_cgo_v)
+//		return W(*_cgo_res) != _cgo_v
+//	}(W(a), W(b), res)
+//
+// where W is int64 if T is signed, or uint64. The arithmetic in W is exact if
+// all of a, b and T are 32-bit or narrower; otherwise it's checked, too.
+func compileOverflowBuiltin(ctx *blockCtx, v *ast.Node, op token.Token) {
+	cb, pkg := ctx.cb, ctx.pkg
+	for i := 1; i <= 3; i++ {
+		compileExpr(ctx, v.Inner[i])
+	}
+	stk := cb.InternalStack()
+	args := append([]*gogen.Element(nil), stk.GetArgs(3)...)
+	stk.PopN(3)
+	var typ types.Type
+	if t, ok := args[2].Type.(*types.Pointer); ok && isInteger(t.Elem()) && !isBool(t.Elem()) {
+		typ = t.Elem()
+	} else {
+		ctx.panicf(v.Inner[3], "unsupported result type %v of %s", args[2].Type, v.Inner[0].Inner[0].ReferencedDecl.Name)
+	}
+	signed := !isUnsigned(typ)
+	wtyp := types.Typ[types.Uint64]
+	if signed {
+		wtyp = types.Typ[types.Int64]
+	}
+	exact := ctx.sizeof(typ) <= 4
+	for _, arg := range args[:2] {
+		if exact = exact && ctx.sizeof(arg.Type) <= 4; !exact && !fitsWide(ctx, arg, signed) {
+			ctx.panicf(v, "unsupported operand of type %v in overflow checking of %v", arg.Type, typ)
+		}
+	}
+	for _, arg := range args[:2] {
+		typeCast(ctx, wtyp, arg)
+	}
+	pos := ctx.goNodePos(v)
+	a := pkg.NewParam(pos, "_cgo_a", wtyp)
+	b := pkg.NewParam(pos, "_cgo_b", wtyp)
+	res := pkg.NewParam(pos, "_cgo_res", types.NewPointer(typ))
+	results := types.NewTuple(pkg.NewParam(pos, "", types.Typ[types.Bool]))
+	cb.NewClosure(types.NewTuple(a, b, res), results, false).BodyStart(pkg)
+	bits := pkg.Import(mathBitsPkgPath)
+	switch {
+	case exact || signed:
+		cb.DefineVarStart(pos, "_cgo_v").Val(a).Val(b).BinaryOp(op).EndInit(1)
+	case op == token.ADD:
+		cb.DefineVarStart(pos, "_cgo_v", "_cgo_c").Val(bits.Ref("Add64")).Val(a).Val(b).Val(0).Call(3).EndInit(1)
+	case op == token.SUB:
+		cb.DefineVarStart(pos, "_cgo_v", "_cgo_c").Val(bits.Ref("Sub64")).Val(a).Val(b).Val(0).Call(3).EndInit(1)
+	default:
+		cb.DefineVarStart(pos, "_cgo_c", "_cgo_v").Val(bits.Ref("Mul64")).Val(a).Val(b).Call(2).EndInit(1)
+	}
+	val := cb.Scope().Lookup("_cgo_v")
+	cb.Val(res).ElemRef().Val(val)
+	typeCast(ctx, typ, stk.Get(-1))
+	cb.Assign(1)
+	ovf := 0 // number of overflow conditions pushed
+	switch {
+	case exact:
+	case !signed:
+		cb.Val(cb.Scope().Lookup("_cgo_c")).Val(0).BinaryOp(token.NEQ)
+		ovf++
+	case op == token.ADD: // (a^v)&(b^v) < 0
+		cb.Val(a).Val(val).BinaryOp(token.XOR).Val(b).Val(val).BinaryOp(token.XOR).
+			BinaryOp(token.AND).Val(0).BinaryOp(token.LSS)
+		ovf++
+	case op == token.SUB: // (a^b)&(a^v) < 0
+		cb.Val(a).Val(b).BinaryOp(token.XOR).Val(a).Val(val).BinaryOp(token.XOR).
+			BinaryOp(token.AND).Val(0).BinaryOp(token.LSS)
+		ovf++
+	default: // a == -1 && b == math.MinInt64 || a != 0 && v/a != b
+		cb.Val(a).Val(-1).BinaryOp(token.EQL).
+			Val(b).Val(pkg.Import("math").Ref("MinInt64")).BinaryOp(token.EQL).BinaryOp(token.LAND).
+			Val(a).Val(0).BinaryOp(token.NEQ).
+			Val(val).Val(a).BinaryOp(token.QUO).Val(b).BinaryOp(token.NEQ).BinaryOp(token.LAND).
+			BinaryOp(token.LOR)
+		ovf++
+	}
+	if ctx.sizeof(typ) < 8 { // W(*res) != v
+		cb.Val(res).Elem()
+		typeCast(ctx, wtyp, stk.Get(-1))
+		cb.Val(val).BinaryOp(token.NEQ)
+		if ovf++; ovf > 1 {
+			cb.BinaryOp(token.LOR)
+		}
+	}
+	cb.Return(1).End()
+	cb.Val(args[0]).Val(args[1]).Val(args[2]).CallWith(3, 0, ctx.goNode(v))
+}
+
+// fitsWide reports whether all values of arg fit in int64 (signed) or uint64.
+func fitsWide(ctx *blockCtx, arg *gogen.Element, signed bool) bool {
+	if arg.CVal != nil {
+		if signed {
+			_, ok := constant.Int64Val(arg.CVal)
+			return ok
+		}
+		_, ok := constant.Uint64Val(arg.CVal)
+		return ok
+	}
+	if !isInteger(arg.Type) {
+		return false
+	}
+	if isUnsigned(arg.Type) {
+		return !signed || ctx.sizeof(arg.Type) < 8
+	}
+	return signed
+}
+
+// -----------------------------------------------------------------------------
@@ -8,6 +8,8 @@ import (
 	"go/types"
 	"log"
 	"math/big"
+	"math/bits"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -40,100 +42,196 @@ const builtin_decls = `{
 	"__builtin_huge_valf": "float32 ()",
 	"__builtin_inff": "float32 ()",
 	"__builtin_infl": "float64 ()",
-	"__builtin_inf": "float64 ()",
-	"__atomic_store_n_u16": "void (uint16*, int, uint16)",
-	"__atomic_store_n_i16": "void (int16*, int, int16)",
-	"__atomic_store_n_u32": "void (uint32*, int, uint32)",
-	"__atomic_store_n_i32": "void (int32*, int, int32)",
-	"__atomic_store_n_u64": "void (uint64*, int, uint64)",
-	"__atomic_store_n_i64": "void (int64*, int, int64)",
-	"__atomic_load_n_u16": "uint16 (uint16*, int)",
-	"__atomic_load_n_i16": "int16 (int16*, int)",
-	"__atomic_load_n_u32": "uint32 (uint32*, int)",
-	"__atomic_load_n_i32": "int32 (int32*, int)",
-	"__atomic_load_n_u64": "uint64 (uint64*, int)",
-	"__atomic_load_n_i64": "int64 (int64*, int)"
+	"__builtin_inf": "float64 ()"
 }`
 
-type overloadFn struct {
-	name      string
-	overloads []string
-}
-
-var (
-	builtin_overloads = []overloadFn{
-		{name: "__atomic_store_n", overloads: []string{
-			"__atomic_store_n_u16", "__atomic_store_n_u32", "__atomic_store_n_u64",
-			"__atomic_store_n_i16", "__atomic_store_n_i32", "__atomic_store_n_i64",
-		}},
-		{name: "__atomic_load_n", overloads: []string{
-			"__atomic_load_n_u16", "__atomic_load_n_u32", "__atomic_load_n_u64",
-			"__atomic_load_n_i16", "__atomic_load_n_i32", "__atomic_load_n_i64",
-		}},
-	}
-)
-
 func decl_builtin(ctx *blockCtx) {
 	var fns map[string]string
 	err := json.NewDecoder(strings.NewReader(builtin_decls)).Decode(&fns)
 	if err != nil {
 		log.Panicln("decl_builtin decode error:", err)
 	}
+	builtins := make(map[string]*BuiltinFunc, len(fns)+len(ctx.builtins))
+	for fn, proto := range fns {
+		builtins[fn] = &BuiltinFunc{Proto: proto}
+	}
+	for fn, bf := range ctx.builtins {
+		builtins[fn] = bf
+	}
+	names := make([]string, 0, len(builtins))
+	for fn := range builtins {
+		names = append(names, fn)
+	}
+	sort.Strings(names)
+
 	bfm := ctx.bfm
 	pkg := ctx.pkg.Types
 	scope := pkg.Scope()
-	if bfm != BFM_FromLibC {
-		for fn, proto := range fns {
-			t := toType(ctx, &cast.Type{QualType: strings.ReplaceAll(proto, "size_t", "unsigned long")}, 0)
-			origFn := fn
-			if bfm == BFM_InLibC {
-				fn = "X" + fn
+	sizeT := "unsigned long"
+	if ctx.target != nil && ctx.target.Model == ctypes.LLP64 {
+		sizeT = "unsigned long long"
+	}
+	objs := make(map[string]types.Object, len(builtins))
+	for _, fn := range names {
+		bf := builtins[fn]
+		if len(bf.Overloads) > 0 {
+			continue
+		}
+		name := fn
+		if bf.GoFunc != "" {
+			name = bf.GoFunc
+		}
+		if bf.GoPkg != "" {
+			var obj types.Object
+			if ref := ctx.pkg.TryImport(bf.GoPkg); ref.Types != nil {
+				obj = ref.TryRef(name)
 			}
-			fnObj := types.NewFunc(token.NoPos, pkg, fn, t.(*types.Signature))
-			scope.Insert(fnObj)
-			if bfm == BFM_InLibC {
-				substObj(pkg, scope, origFn, fnObj)
+			if _, ok := obj.(*types.Func); !ok {
+				ctx.errorf(nil, "builtin %s: func %s.%s not found", fn, bf.GoPkg, name)
+				continue
 			}
+			substObj(pkg, scope, fn, obj)
+			objs[fn] = obj
+			continue
+		}
+		if bfm == BFM_FromLibC {
+			continue
 		}
+		proto := &cast.Type{QualType: strings.ReplaceAll(bf.Proto, "size_t", sizeT)}
+		t, _, err := parseType(ctx, scope, nil, proto, 0, false)
+		sig, ok := t.(*types.Signature)
+		if err != nil || !ok {
+			ctx.errorf(nil, "builtin %s: invalid prototype %q", fn, bf.Proto)
+			continue
+		}
+		if bfm == BFM_InLibC {
+			name = "X" + name
+		}
+		fnObj := types.NewFunc(token.NoPos, pkg, name, sig)
+		scope.Insert(fnObj)
+		if name != fn {
+			substObj(pkg, scope, fn, fnObj)
+		}
+		objs[fn] = fnObj
 	}
-	for _, o := range builtin_overloads {
-		fns := make([]types.Object, len(o.overloads))
-		for i, item := range o.overloads {
-			switch bfm {
-			case BFM_InLibC:
-				item = "X" + item
+	for _, fn := range names {
+		bf := builtins[fn]
+		if len(bf.Overloads) == 0 {
+			continue
+		}
+		overloads := make([]types.Object, len(bf.Overloads))
+		for i, item := range bf.Overloads {
+			if overloads[i] = objs[item]; overloads[i] == nil {
+				if bfm != BFM_FromLibC {
+					ctx.errorf(nil, "builtin %s: overload %s not found", fn, item)
+				}
+				overloads = nil
+				break
 			}
-			fns[i] = pkg.Scope().Lookup(item)
 		}
-		scope.Insert(gogen.NewOverloadFunc(token.NoPos, pkg, o.name, fns...))
+		if overloads != nil {
+			scope.Insert(gogen.NewOverloadFunc(token.NoPos, pkg, fn, overloads...))
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// layoutAttrs returns attributes of a struct, union or field decl which change
+// layout as clang does: whether it's packed, its alignment by aligned attributes
+// (0 if none), and max alignment of its fields by #pragma pack (0 if none).
+func layoutAttrs(ctx *blockCtx, decl *cast.Node) (packed bool, align, pack int) {
+	for _, v := range decl.Inner {
+		switch v.Kind {
+		case cast.PackedAttr:
+			packed = true
+		case cast.AlignedAttr:
+			if n := alignedAttr(ctx, v); n > align {
+				align = n
+			}
+		case cast.MaxFieldAlignmentAttr:
+			if pack = ctx.packOf(decl); pack <= 0 {
+				ctx.panicf(decl, "#pragma pack of %s not found", decl.Name)
+			}
+		}
+	}
+	return
+}
+
+func alignedAttr(ctx *blockCtx, v *cast.Node) int {
+	if len(v.Inner) == 0 || v.Inner[0].Kind == "" { // __attribute__((aligned))
+		return ctx.biggestAlign()
+	}
+	e := v.Inner[0]
+	if s, ok := e.Value.(string); ok && e.Kind == cast.ConstantExpr {
+		if n, err := strconv.Atoi(s); err == nil {
+			return n
+		}
 	}
+	return int(toInt64(ctx, e, "non-constant alignment"))
+}
+
+// fieldAlign returns alignment of a field with type alignment align, as clang
+// lays it out in a packed struct or under #pragma pack.
+func fieldAlign(ctx *blockCtx, decl *cast.Node, align int, packed bool, pack int) int {
+	fpacked, explicit, _ := layoutAttrs(ctx, decl)
+	if packed || fpacked {
+		align = 1
+	}
+	if explicit > align {
+		align = explicit
+	}
+	if pack != 0 && pack < align {
+		align = pack
+	}
+	return align
 }
 
 // -----------------------------------------------------------------------------
 
 type unionBuilder struct {
 	fields []*gogen.UnionField
+	src    *cast.Node
+	align  int // alignment of the union, as clang lays it out
+	packed bool
+	pack   int // max alignment of fields by #pragma pack, 0 if none
 }
 
-func newUnionBuilder() *unionBuilder {
-	return &unionBuilder{}
+func newUnionBuilder(ctx *blockCtx, unio *cast.Node) *unionBuilder {
+	packed, align, pack := layoutAttrs(ctx, unio)
+	if align == 0 {
+		align = 1
+	}
+	return &unionBuilder{src: unio, align: align, packed: packed, pack: pack}
 }
 
 func unionEmbeddedField(ctx *blockCtx, fields []*gogen.UnionField, t *types.Named, off int) []*gogen.UnionField {
 	o := t.Underlying().(*types.Struct)
-	for i, n := 0, o.NumFields(); i < n; i++ {
-		fld := o.Field(i)
+	flds := make([]*types.Var, o.NumFields())
+	for i := range flds {
+		flds[i] = o.Field(i)
+	}
+	offs := ctx.sizes.Offsetsof(flds)
+	for i, fld := range flds {
 		fldType := fld.Type()
 		if fld.Embedded() {
-			fields = unionEmbeddedField(ctx, fields, fldType.(*types.Named), off)
-		} else {
+			fields = unionEmbeddedField(ctx, fields, fldType.(*types.Named), off+int(offs[i]))
+		} else if !isPadding(fld) {
 			fields = append(fields, &gogen.UnionField{
 				Name: fld.Name(),
-				Off:  off,
+				Off:  off + int(offs[i]),
 				Type: fldType,
 			})
 		}
-		off += ctx.sizeof(fldType)
+	}
+	if vfs, ok := ctx.pkg.VFields(t); ok {
+		if sf, ok := vfs.(*structFields); ok {
+			for i, n := 0, sf.unaligned.Len(); i < n; i++ {
+				fld := *sf.unaligned.At(i)
+				fld.Off += off
+				fields = append(fields, &fld)
+			}
+		}
 	}
 	return fields
 }
@@ -158,80 +256,317 @@ func (p *unionBuilder) Type(ctx *blockCtx, t *types.Named) *types.Struct {
 		fld := types.NewField(fldLargest.Pos, pkg.Types, fldLargest.Name, fldLargest.Type, false)
 		flds = append(flds, fld)
 	}
-	return types.NewStruct(flds, nil)
+	return recordType(ctx, t, p.src, flds, lenLargest, alignTo(lenLargest, p.align), p.align)
 }
 
-func (p *unionBuilder) Field(ctx *blockCtx, pos token.Pos, typ types.Type, name string, embedded bool) {
+func (p *unionBuilder) Field(ctx *blockCtx, src *cast.Node, typ types.Type, name string, embedded bool) {
 	if embedded {
 		name = ""
 	}
+	if align := fieldAlign(ctx, src, ctx.alignof(typ), p.packed, p.pack); align > p.align {
+		p.align = align
+	}
 	fld := &gogen.UnionField{
 		Name: name,
 		Type: typ,
-		Pos:  pos,
+		Pos:  ctx.goNodePos(src),
 	}
 	p.fields = append(p.fields, fld)
 }
 
+// recordType returns a struct of fields ending at end, which has the size and
+// alignment of a C struct or union t, by padding fields. It reports an error if
+// Go can't lay it out as clang does.
+func recordType(ctx *blockCtx, t *types.Named, src *cast.Node, flds []*types.Var, end, size, align int) *types.Struct {
+	goAlign := 1
+	for _, fld := range flds {
+		if a := int(ctx.sizes.Alignof(fld.Type())); a > goAlign {
+			goAlign = a
+		}
+	}
+	if goAlign < align { // aligned by type of a bit field, or aligned attributes
+		for n := 8; n > goAlign; n >>= 1 {
+			typ := intType(n, false)
+			if a := int(ctx.sizes.Alignof(typ)); a <= align && a > goAlign {
+				flds = append([]*types.Var{newPadding(ctx, types.NewArray(typ, 0))}, flds...)
+				goAlign = a
+				break
+			}
+		}
+	}
+	if alignTo(end, goAlign) < size {
+		pad := types.NewArray(types.Typ[types.Uint8], int64(size-end))
+		flds = append(flds, newPadding(ctx, pad))
+		end = size
+	}
+	if alignTo(end, goAlign) != size {
+		ctx.panicf(src, "layout of %s is not supported", t.Obj().Name())
+	}
+	if goAlign != align {
+		if goAlign < align && !ctx.inSysHeader(src) { // Go aligns values of t to goAlign only
+			ctx.warnf(src, "alignment %d of %s is not supported, it's aligned to %d in Go",
+				align, t.Obj().Name(), goAlign)
+		}
+		ctx.setAlign(t, align)
+	}
+	return types.NewStruct(flds, nil)
+}
+
 // -----------------------------------------------------------------------------
 
+// A structBuilder lays out fields as clang does first, and then makes a struct
+// of them. Its fields are padded to the offsets of clang, and a field which Go
+// can't align there is accessed by its offset (see structFields).
 type structBuilder struct {
-	fields      []*types.Var
-	bitFields   []*gogen.BitField
-	lastFldName string
-	lastTy      types.Type
-	totalBits   int
-	leftBits    int
-	idx         int
+	fields    []*types.Var
+	bitFields []*gogen.BitField
+	unaligned []*gogen.UnionField // fields not aligned as Go requires
+	members   []*member           // fields and bit fields laid out as clang does
+	cfields   []*types.Var        // fields and bit fields (with declared type) of C
+	src       *cast.Node
+	idx       int
+	off       int // offset in bits of the next field, as clang lays it out
+	end       int // end offset in bytes of fields
+	align     int // alignment of the struct, as clang lays it out
+	pack      int // max alignment of fields by #pragma pack, 0 if none
+	packed    bool
 }
 
-func newStructBuilder() *structBuilder {
-	return &structBuilder{leftBits: -1}
+type member struct {
+	fld  *types.Var // nil if it's a bit field
+	typ  types.Type
+	name string
+	off  int // offset in bits
+	bits int
+	src  *cast.Node
+}
+
+func newStructBuilder(ctx *blockCtx, struc *cast.Node) *structBuilder {
+	packed, align, pack := layoutAttrs(ctx, struc)
+	if align == 0 {
+		align = 1
+	}
+	return &structBuilder{src: struc, align: align, packed: packed, pack: pack}
 }
 
 func (p *structBuilder) Type(ctx *blockCtx, t *types.Named) *types.Struct {
-	struc := types.NewStruct(p.fields, nil)
-	if len(p.bitFields) > 0 {
+	var pending []*member
+	for _, m := range p.members {
+		if m.fld == nil {
+			pending = append(pending, m)
+			continue
+		}
+		off := m.off >> 3
+		p.flushBits(ctx, pending, off)
+		pending = nil
+		typ := m.fld.Type()
+		if align := int(ctx.sizes.Alignof(typ)); off%align == 0 && align <= p.align {
+			p.addField(ctx, off, m.fld)
+		} else if m.fld.Embedded() {
+			ctx.panicf(m.src, "layout of %s is not supported", m.fld.Name())
+		} else {
+			p.unaligned = append(p.unaligned, &gogen.UnionField{
+				Name: m.fld.Name(),
+				Off:  off,
+				Type: typ,
+				Pos:  m.fld.Pos(),
+			})
+		}
+	}
+	size := alignTo((p.off+7)>>3, p.align)
+	p.flushBits(ctx, pending, size)
+	struc := recordType(ctx, t, p.src, p.fields, p.end, size, p.align)
+	if len(p.unaligned) > 0 {
+		sf := &structFields{unaligned: gogen.NewUnionFields(p.unaligned), fields: p.cfields}
+		if len(p.bitFields) > 0 {
+			sf.bitFields = gogen.NewBitFields(p.bitFields)
+		}
+		ctx.pkg.SetVFields(t, sf)
+	} else if len(p.bitFields) > 0 {
 		ctx.pkg.SetVFields(t, gogen.NewBitFields(p.bitFields))
 	}
 	return struc
 }
 
-func (p *structBuilder) BitField(ctx *blockCtx, typ types.Type, name string, bits int) {
-	if p.leftBits >= bits && ctypes.Identical(typ, p.lastTy) {
-		if name != "" {
-			p.bitFields = append(p.bitFields, &gogen.BitField{
-				Name:    name,
-				FldName: p.lastFldName,
-				Off:     p.totalBits - p.leftBits,
-				Bits:    bits,
-			})
+// BitField lays out a bit field as clang does: it's put in the storage unit
+// (sized as its type) where the previous field ends, or in the next one if it
+// doesn't fit. A zero-width bit field makes the next field start a new unit.
+// Bit fields of a packed struct, or under #pragma pack, aren't moved.
+func (p *structBuilder) BitField(ctx *blockCtx, src *cast.Node, typ types.Type, name string, bits int) {
+	size := int(ctx.sizes.Sizeof(typ)) << 3
+	if bits > size {
+		ctx.panicf(src, "BitField - too large bits: %d", bits)
+	}
+	packed, explicit, _ := layoutAttrs(ctx, src)
+	packed, explicit = packed || p.packed, explicit<<3
+	align := ctx.alignof(typ) << 3
+	if bits == 0 {
+		if explicit > align {
+			align = explicit
 		}
-		p.leftBits -= bits
-	} else if p.totalBits = ctx.sizeof(typ) << 3; p.totalBits >= bits {
-		fldName := "Xbf_" + strconv.Itoa(p.idx)
-		p.Field(ctx, token.NoPos, typ, fldName, false)
-		p.idx++
-		p.lastFldName = fldName
-		p.lastTy = typ
-		p.leftBits = p.totalBits - bits
-		if name != "" {
-			p.bitFields = append(p.bitFields, &gogen.BitField{
-				Name:    name,
-				FldName: p.lastFldName,
-				Bits:    bits,
-			})
+		p.off = alignTo(p.off, align)
+		return
+	}
+	unpacked := align
+	if packed {
+		align = 1
+	}
+	if explicit > align {
+		align = explicit
+	}
+	if explicit > unpacked {
+		unpacked = explicit
+	}
+	if pack := p.pack << 3; pack != 0 { // #pragma pack overrides aligned attributes
+		if unpacked > pack {
+			unpacked = pack
 		}
-	} else {
-		p.leftBits = -1
-		log.Panicln("BitField - too large bits:", bits)
+		if packed || align > pack {
+			align = unpacked
+		}
+		if explicit != 0 && explicit <= pack {
+			p.off = alignTo(p.off, explicit)
+		}
+	} else if p.off%align+bits > size {
+		p.off = alignTo(p.off, align)
+	} else if explicit != 0 {
+		p.off = alignTo(p.off, explicit)
 	}
+	if name != "" { // unnamed bit fields are only padding
+		p.members = append(p.members, &member{typ: typ, name: name, off: p.off, bits: bits, src: src})
+		p.cfields = append(p.cfields, types.NewField(ctx.goNodePos(src), ctx.pkg.Types, name, typ, false))
+		if align >>= 3; align > p.align {
+			p.align = align
+		}
+	}
+	p.off += bits
 }
 
-func (p *structBuilder) Field(ctx *blockCtx, pos token.Pos, typ types.Type, name string, embedded bool) {
-	fld := types.NewField(pos, ctx.pkg.Types, name, typ, embedded)
+// flushBits puts bit fields in storage fields, which must end before limit (in
+// bytes). A storage field has the type of its first bit field if possible, or
+// the smallest integer type that fits.
+func (p *structBuilder) flushBits(ctx *blockCtx, bfs []*member, limit int) {
+	var fld *types.Var
+	var start int
+	for _, bf := range bfs {
+		begin, end := bf.off>>3, (bf.off+bf.bits+7)>>3
+		if fld == nil || begin >= p.end {
+			typ := bf.typ
+			if size := int(ctx.sizes.Sizeof(typ)); begin%size != 0 || begin+size > limit {
+				if typ = storageType(typ, begin, end, limit); typ == nil {
+					ctx.panicf(bf.src, "layout of bit field %s is not supported", bf.name)
+				}
+			}
+			fldName := "Xbf_" + strconv.Itoa(p.idx)
+			p.idx++
+			fld, start = types.NewField(token.NoPos, ctx.pkg.Types, fldName, typ, false), begin
+			p.addField(ctx, begin, fld)
+		} else if end > p.end { // straddles end of the storage field
+			typ := storageType(fld.Type(), start, end, limit)
+			if typ == nil {
+				ctx.panicf(bf.src, "layout of bit field %s is not supported", bf.name)
+			}
+			fld = types.NewField(token.NoPos, ctx.pkg.Types, fld.Name(), typ, false)
+			p.fields[len(p.fields)-1] = fld
+			p.end = start + int(ctx.sizes.Sizeof(typ))
+		}
+		p.bitFields = append(p.bitFields, &gogen.BitField{
+			Name:    bf.name,
+			FldName: fld.Name(),
+			Off:     bf.off - start<<3,
+			Bits:    bf.bits,
+		})
+	}
+}
+
+func (p *structBuilder) Field(ctx *blockCtx, src *cast.Node, typ types.Type, name string, embedded bool) {
+	align := fieldAlign(ctx, src, ctx.alignof(typ), p.packed, p.pack)
+	off := alignTo((p.off+7)>>3, align)
+	fld := types.NewField(ctx.goNodePos(src), ctx.pkg.Types, name, typ, embedded)
+	p.members = append(p.members, &member{fld: fld, off: off << 3, src: src})
+	p.cfields = append(p.cfields, fld)
+	p.off = (off + int(ctx.sizes.Sizeof(typ))) << 3
+	if align > p.align {
+		p.align = align
+	}
+}
+
+// addField adds fld at offset off (in bytes), after a padding field if Go
+// doesn't lay it out there.
+func (p *structBuilder) addField(ctx *blockCtx, off int, fld *types.Var) {
+	typ := fld.Type()
+	if alignTo(p.end, int(ctx.sizes.Alignof(typ))) < off {
+		pad := types.NewArray(types.Typ[types.Uint8], int64(off-p.end))
+		p.fields = append(p.fields, newPadding(ctx, pad))
+	}
 	p.fields = append(p.fields, fld)
-	p.leftBits = -1
+	p.end = off + int(ctx.sizes.Sizeof(typ))
+}
+
+func newPadding(ctx *blockCtx, typ types.Type) *types.Var {
+	return types.NewField(token.NoPos, ctx.pkg.Types, "_", typ, false)
+}
+
+func isPadding(fld *types.Var) bool {
+	return fld.Name() == "_"
+}
+
+func alignTo(off, align int) int {
+	return (off + align - 1) / align * align
+}
+
+// storageType returns the smallest integer type, signed as typ, to store bytes
+// from start to end. It must be aligned and end before limit.
+func storageType(typ types.Type, start, end, limit int) types.Type {
+	for size := 1; size <= 8; size <<= 1 {
+		if start%size == 0 && start+size >= end && start+size <= limit {
+			return intType(size, isUnsigned(typ))
+		}
+	}
+	return nil
+}
+
+func intType(size int, unsigned bool) types.Type {
+	kind := types.Int8 + types.BasicKind(bits.TrailingZeros(uint(size)))
+	if unsigned {
+		kind += types.Uint8 - types.Int8
+	}
+	return types.Typ[kind]
+}
+
+// structFields are virtual fields of a struct: bit fields, and fields which
+// aren't aligned as Go requires and are accessed by their offsets.
+type structFields struct {
+	bitFields *gogen.BitFields // nil if none
+	unaligned *gogen.UnionFields
+	fields    []*types.Var // fields of C, see structLitOf
+}
+
+func (p *structFields) FindField(cb *gogen.CodeBuilder, t *types.Named, name string, arg *gogen.Element, src ast.Node) gogen.MemberKind {
+	if p.bitFields != nil {
+		if kind := p.bitFields.FindField(cb, t, name, arg, src); kind != gogen.MemberInvalid {
+			return kind
+		}
+	}
+	return p.unaligned.FindField(cb, t, name, arg, src)
+}
+
+func (p *structFields) FieldRef(cb *gogen.CodeBuilder, t *types.Named, name string, src ast.Node) gogen.MemberKind {
+	if p.bitFields != nil {
+		if kind := p.bitFields.FieldRef(cb, t, name, src); kind != gogen.MemberInvalid {
+			return kind
+		}
+	}
+	return p.unaligned.FieldRef(cb, t, name, src)
+}
+
+func (p *structFields) unalignedField(name string) *gogen.UnionField {
+	for i, n := 0, p.unaligned.Len(); i < n; i++ {
+		if fld := p.unaligned.At(i); fld.Name == name {
+			return fld
+		}
+	}
+	return nil
 }
 
 // -----------------------------------------------------------------------------
@@ -257,6 +592,11 @@ func toInt64(ctx *blockCtx, v *cast.Node, emsg string) int64 {
 
 func typeCast(ctx *blockCtx, typ types.Type, arg *gogen.Element) {
 	if !ctypes.Identical(typ, arg.Type) {
+		if isSoftNum(typ) || isSoftNum(arg.Type) {
+			softCast(ctx, typ, arg)
+			*arg = *ctx.cb.InternalStack().Pop()
+			return
+		}
 		adjustIntConst(ctx, arg, typ)
 		*arg = *ctx.cb.Typ(typ).Val(arg).Call(1).InternalStack().Pop()
 	}
@@ -276,6 +616,13 @@ func assignOp(ctx *blockCtx, op token.Token, src ast.Node) {
 	stk := cb.InternalStack()
 	arg1 := stk.Get(-2)
 	arg1Type, _ := gogen.DerefType(arg1.Type)
+	if isInt128(arg1Type) {
+		softAssignOp(ctx, op, src, int128BinaryOp)
+		return
+	} else if isSoftFloat(arg1Type) {
+		softAssignOp(ctx, op, src, softFloatBinaryOp)
+		return
+	}
 	switch op {
 	case token.ADD_ASSIGN, token.SUB_ASSIGN: // ptr+=n, ptr-=n
 		if t1, ok := arg1Type.(*types.Pointer); ok {
@@ -302,7 +649,9 @@ func assignOp(ctx *blockCtx, op token.Token, src ast.Node) {
 		arg2 := stk.Get(-1)
 		typeCast(ctx, arg1Type, arg2)
 	case token.SHL_ASSIGN, token.SHR_ASSIGN:
-		// noop
+		if arg2 := stk.Get(-1); isInt128(arg2.Type) { // n <<= uint(i128)
+			softCast(ctx, types.Typ[types.Uint], stk.Pop())
+		}
 	}
 done:
 	cb.AssignOp(op, src)
@@ -334,6 +683,15 @@ func isZeroNumber(v *gogen.Element) bool {
 }
 
 func unaryOp(ctx *blockCtx, op token.Token, v *cast.Node) {
+	if op != token.AND {
+		if t := ctx.cb.Get(-1).Type; isInt128(t) {
+			int128UnaryOp(ctx, op)
+			return
+		} else if isSoftFloat(t) {
+			softFloatUnaryOp(ctx, op)
+			return
+		}
+	}
 	switch op {
 	case token.NOT:
 		castToBoolExpr(ctx.cb)
@@ -363,6 +721,16 @@ func binaryOp(ctx *blockCtx, op token.Token, v *cast.Node) {
 	stk := cb.InternalStack()
 	arg1 := stk.Get(-2)
 	arg2 := stk.Get(-1)
+	if isSoftFloat(arg1.Type) || isSoftFloat(arg2.Type) {
+		softFloatBinaryOp(ctx, op, src)
+		return
+	} else if isInt128(arg1.Type) {
+		int128BinaryOp(ctx, op, src)
+		return
+	} else if isInt128(arg2.Type) && isShiftOpertor(op) { // n << uint(i128)
+		softCast(ctx, types.Typ[types.Uint], stk.Pop())
+		arg2 = stk.Get(-1)
+	}
 	switch op {
 	case token.SUB, token.ADD: // ptr-ptr, ptr-n, ptr+n, n+ptr
 		if op == token.ADD && isIntegerOrBool(arg1.Type) { // n+ptr
@@ -547,6 +915,8 @@ func castToBoolExpr(cb *gogen.CodeBuilder) {
 		cb.Val(0).BinaryOp(token.NEQ)
 	} else if isNilComparable(t) {
 		cb.Val(nil).BinaryOp(token.NEQ)
+	} else if isSoftNum(t) {
+		cb.MemberVal("IsZero").Call(0).UnaryOp(token.NOT)
 	}
 }
 
@@ -621,6 +991,11 @@ func typeCastCall(ctx *blockCtx, typ types.Type) {
 	cb := ctx.cb
 	stk := cb.InternalStack()
 	v := stk.Get(-1)
+	if isSoftNum(typ) || isSoftNum(v.Type) {
+		stk.PopN(2)
+		softCast(ctx, typ, v)
+		return
+	}
 	if convertibleTo(v.Type, typ) {
 		adjustIntConst(ctx, v, typ)
 		cb.Call(1)
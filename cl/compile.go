@@ -1,8 +1,11 @@
 package cl
 
 import (
+	"bytes"
+	"fmt"
 	"go/token"
 	"go/types"
+	"io"
 	"log"
 	"path/filepath"
 	"syscall"
@@ -104,6 +107,33 @@ const (
 	BFM_FromLibC        // import builtin functions from libc
 )
 
+// BuiltinFunc specifies a builtin function (see Config.Builtins).
+type BuiltinFunc struct {
+	// Proto is the C prototype of the builtin, like "uint32 (uint32)". It's
+	// declared as a Go func that is defined in the package being compiled
+	// (or libc, see BFMode).
+	Proto string `json:"proto"`
+
+	// GoPkg and GoFunc specify the Go func the builtin resolves to instead.
+	// If GoPkg is empty, GoFunc is the name of the declared func, which is
+	// the builtin name by default.
+	GoPkg  string `json:"pkg"`
+	GoFunc string `json:"func"`
+
+	// Overloads specifies names of builtins which the builtin is an overload
+	// group of. Proto, GoPkg and GoFunc are ignored if it isn't empty.
+	Overloads []string `json:"overloads"`
+}
+
+// LDMode sets representation of long double.
+type LDMode int8
+
+const (
+	LDM_Float64   LDMode = iota // float64, it may lose precision
+	LDM_X87                     // x87 80-bit extended precision (clang.Float80)
+	LDM_Binary128               // IEEE 754 binary128 (clang.Float128)
+)
+
 // -----------------------------------------------------------------------------
 
 type typeDecl struct {
@@ -118,7 +148,43 @@ type PkgInfo struct {
 
 type Package struct {
 	*gogen.Package
-	pi *PkgInfo
+	pi     *PkgInfo
+	diags  ErrorList
+	srcmap *srcMap
+	target *ctypes.Target
+
+	lineDir bool // see fixLineDirectives
+}
+
+// goFile returns content of the Go file fname. It has a GOARCH build
+// constraint if conf.Target is specified.
+func (p Package) goFile(fname ...string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(gogen.GeneratedHeader)
+	if p.target != nil {
+		fmt.Fprintf(&b, "//go:build %s\n\n", p.target.GOARCH)
+	}
+	err := p.Package.WriteTo(&b, fname...)
+	return b.Bytes(), err
+}
+
+// WriteTo writes the Go file fname (the default file if fname is not provided)
+// to dst. Its //line directives are fixed by fixLineDirectives, which treats
+// fname as name of the Go file.
+func (p Package) WriteTo(dst io.Writer, fname ...string) error {
+	if !p.lineDir {
+		return p.Package.WriteTo(dst, fname...)
+	}
+	var b bytes.Buffer
+	if err := p.Package.WriteTo(&b, fname...); err != nil {
+		return err
+	}
+	gofile := headerGoFile
+	if len(fname) > 0 {
+		gofile = fname[0]
+	}
+	_, err := dst.Write(fixLineDirectives(b.Bytes(), gofile))
+	return err
 }
 
 // IsValid returns is this package instance valid or not.
@@ -153,6 +219,14 @@ type Config struct {
 	// Src specifies source code of SrcFile. Will read from SrcFile if nil.
 	Src []byte
 
+	// MacroFile specifies a file which contains macro definitions of SrcFile
+	// (see preprocessor.Config.MacroFile). Public object-like macros (see
+	// Public, PublicFrom) which expand to constants are compiled into Go consts.
+	MacroFile string
+
+	// Macros specifies content of MacroFile. Will read from MacroFile if nil.
+	Macros []byte
+
 	// Ignored specifies all ignored symbols (types, functions, etc).
 	Ignored []string
 
@@ -182,6 +256,14 @@ type Config struct {
 	// BuiltinFuncMode sets compiling mode of builtin functions.
 	BuiltinFuncMode BFMode
 
+	// Builtins specifies extra builtin functions, like compiler intrinsics.
+	// They are merged with the default ones, and replace those of the same name.
+	Builtins map[string]*BuiltinFunc
+
+	// LongDouble sets representation of long double. Default is float64.
+	// Others are software floats which are faithful to C but much slower.
+	LongDouble LDMode
+
 	// SkipLibcHeader specifies to ignore standard library headers.
 	SkipLibcHeader bool
 
@@ -190,6 +272,30 @@ type Config struct {
 
 	// TestMain specifies to generate TestMain func as entry, not main func.
 	TestMain bool
+
+	// FuncStubOnError specifies to emit a function whose body fails to compile
+	// as a stub that panics with the reason, and to report it as a warning.
+	FuncStubOnError bool
+
+	// SkipFuncBodies specifies to leave function bodies of the C file (not of
+	// its headers) empty, because its Go file is up to date and won't be
+	// written. Bodies which declare struct or union types are still compiled,
+	// so that anonymous types are named as usual.
+	SkipFuncBodies bool
+
+	// LineDirectives specifies to emit //line directives (per function and
+	// per statement) that link the generated Go code to the C source.
+	LineDirectives bool
+
+	// SourceMap specifies to write a source map file next to each Go file
+	// in pkg.WriteFile (see SourceMapFile).
+	SourceMap bool
+
+	// Target specifies clang target triple of the C file (see
+	// ctypes.ParseTarget). It decides sizes of long and pointers, and Go files
+	// written by pkg.WriteFile have a GOARCH build constraint. Default is
+	// the host.
+	Target string
 }
 
 const (
@@ -199,7 +305,53 @@ const (
 // NewPackage create a Go package from C file AST.
 // If conf.Reused isn't nil, it shares the Go package instance in multi C files.
 // Otherwise it creates a single Go file in the Go package.
+//
+// NewPackage doesn't stop at the first unsupported construct. It returns all
+// problems as an ErrorList if any of them is an error (see pkg.Diagnostics).
 func NewPackage(pkgPath, pkgName string, file *ast.Node, conf *Config) (pkg Package, err error) {
+	if file.Kind != ast.TranslationUnitDecl {
+		return pkg, syscall.EINVAL
+	}
+	if pkg, err = newPackage(pkgPath, pkgName, conf); err != nil {
+		return
+	}
+	pkg.pi, pkg.diags, err = loadFile(pkg, conf, file, nil)
+	if err == nil {
+		err = pkg.diags.Err()
+	}
+	return
+}
+
+// A DeclStream calls fn for each top-level decl of a translation unit in
+// order. It stops and returns the error if fn returns an error. For example:
+//
+//	func(fn func(decl *ast.Node) error) error {
+//		_, _, err := parser.ParseFileStream(filename, 0, conf, fn)
+//		return err
+//	}
+type DeclStream = func(fn func(decl *ast.Node) error) error
+
+// NewPackageStream is like NewPackage, but it compiles top-level decls of a
+// C file one by one as stream yields them, so the whole AST of the C file
+// isn't needed in memory.
+func NewPackageStream(pkgPath, pkgName string, stream DeclStream, conf *Config) (pkg Package, err error) {
+	if pkg, err = newPackage(pkgPath, pkgName, conf); err != nil {
+		return
+	}
+	pkg.pi, pkg.diags, err = loadFile(pkg, conf, nil, stream)
+	if err == nil {
+		err = pkg.diags.Err()
+	}
+	return
+}
+
+func newPackage(pkgPath, pkgName string, conf *Config) (pkg Package, err error) {
+	var target *ctypes.Target
+	if conf.Target != "" {
+		if target, err = ctypes.ParseTarget(conf.Target); err != nil {
+			return
+		}
+	}
 	if reused := conf.Reused; reused != nil && reused.pkg.Package != nil {
 		pkg = reused.pkg
 	} else {
@@ -217,8 +369,25 @@ func NewPackage(pkgPath, pkgName string, file *ast.Node, conf *Config) (pkg Pack
 		pkg.Package = gogen.NewPackage(pkgPath, pkgName, confGox)
 		interp.fset = pkg.Fset
 	}
+	if conf.SourceMap && pkg.srcmap == nil {
+		pkg.srcmap = newSrcMap(conf.LineDirectives)
+		if conf.Reused != nil {
+			conf.Reused.pkg.srcmap = pkg.srcmap
+		}
+	}
+	if target != nil {
+		pkg.target = target
+		if conf.Reused != nil {
+			conf.Reused.pkg.target = target
+		}
+	}
+	if conf.LineDirectives || conf.SourceMap {
+		pkg.lineDir = true
+		if conf.Reused != nil {
+			conf.Reused.pkg.lineDir = true
+		}
+	}
 	pkg.SetRedeclarable(true)
-	pkg.pi, err = loadFile(pkg.Package, conf, file)
 	return
 }
 
@@ -256,10 +425,9 @@ func implicitCast(pkg *gogen.Package, V, T types.Type, pv *gogen.Element) bool {
 
 // -----------------------------------------------------------------------------
 
-func loadFile(p *gogen.Package, conf *Config, file *ast.Node) (pi *PkgInfo, err error) {
-	if file.Kind != ast.TranslationUnitDecl {
-		return nil, syscall.EINVAL
-	}
+// loadFile compiles file, or decls of stream if file is nil.
+func loadFile(pkg Package, conf *Config, file *ast.Node, stream DeclStream) (pi *PkgInfo, diags ErrorList, err error) {
+	p := pkg.Package
 	srcFile := conf.SrcFile
 	if srcFile != "" {
 		srcFile, _ = filepath.Abs(srcFile)
@@ -274,7 +442,14 @@ func loadFile(p *gogen.Package, conf *Config, file *ast.Node) (pi *PkgInfo, err
 		srcfile:  srcFile,
 		src:      conf.Src,
 		bfm:      conf.BuiltinFuncMode,
+		builtins: conf.Builtins,
+		ldm:      conf.LongDouble,
 		testMain: conf.TestMain,
+		funcStub: conf.FuncStubOnError,
+		skipBody: conf.SkipFuncBodies,
+		lineDir:  conf.LineDirectives || conf.SourceMap,
+		srcmap:   pkg.srcmap,
+		target:   pkg.target,
 	}
 	baseDir, _ := filepath.Abs(conf.Dir)
 	ctx.initMultiFileCtl(p, baseDir, conf)
@@ -286,11 +461,19 @@ func loadFile(p *gogen.Package, conf *Config, file *ast.Node) (pi *PkgInfo, err
 			ctx.ignored = append(ctx.ignored, ign)
 		}
 	}
-	compileDeclStmt(ctx, file, true)
+	if file != nil {
+		compileDeclStmt(ctx, file, true)
+	} else if err = compileDeclStream(ctx, stream); err != nil {
+		return
+	}
+	if conf.MacroFile != "" || conf.Macros != nil {
+		loadMacros(ctx, conf)
+	}
 	if conf.NeedPkgInfo {
 		pkgInfo := ctx.PkgInfo // make a copy: don't keep a ref to blockCtx
 		pi = &pkgInfo
 	}
+	diags = ctx.diags
 	return
 }
 
@@ -306,75 +489,144 @@ func isPubTypedef(ctx *blockCtx, decl *ast.Node) bool {
 func compileDeclStmt(ctx *blockCtx, node *ast.Node, global bool) {
 	scope := ctx.cb.Scope()
 	n := len(node.Inner)
+	if global {
+		compileGlobalDecls(ctx, node, n, scope)
+		return
+	}
 	for i := 0; i < n; i++ {
+		i = compileDecl(ctx, node, i, scope, false)
+	}
+}
+
+// compileGlobalDecls compiles global decls node.Inner[:n] and returns index of
+// the first decl not compiled yet. Decls after n may be compiled as well if
+// they are consumed by a previous decl (see compileDecl).
+func compileGlobalDecls(ctx *blockCtx, node *ast.Node, n int, scope *types.Scope) int {
+	i := 0
+	for ; i < n; i++ {
 		decl := node.Inner[i]
-		if global {
-			ctx.logFile(decl)
-			if decl.IsImplicit || ctx.inDepPkg {
-				continue
-			}
+		ctx.logFile(decl)
+		if decl.IsImplicit || ctx.inDepPkg {
+			continue
 		}
-		switch decl.Kind {
-		case ast.VarDecl:
-			compileVarDecl(ctx, decl, global)
-		case ast.TypedefDecl:
-			origName, pub := decl.Name, false
-			if global {
-				pub = ctx.getPubName(&decl.Name)
-			}
-			compileTypedef(ctx, decl, global, pub)
-			if pub {
-				substObj(ctx.pkg.Types, scope, origName, scope.Lookup(decl.Name))
-			}
-		case ast.RecordDecl:
-			pub := false
-			name, suKind := ctx.getSuName(decl, decl.TagUsed)
-			origName := name
-			if global {
-				if suKind == suAnonymous {
-					// pub = true if this is a public typedef
-					pub = i+1 < n && isPubTypedef(ctx, node.Inner[i+1])
-				} else {
-					pub = ctx.getPubName(&name)
-					if decl.CompleteDefinition && ctx.checkExists(name) {
-						continue
-					}
+		i = compileGlobalDecl(ctx, node, i, scope)
+	}
+	return i
+}
+
+// compileDeclStream compiles global decls of stream one by one. compileDecl
+// looks ahead at the decls following an anonymous struct/union: a typedef or
+// variables of it. So decls are kept until a decl which isn't a VarDecl comes.
+func compileDeclStream(ctx *blockCtx, stream DeclStream) error {
+	scope := ctx.cb.Scope()
+	pending := new(ast.Node)
+	err := stream(func(decl *ast.Node) error {
+		if ctx.pubFrom != nil {
+			ctx.markPublic(decl)
+			if ctx.isIgnored(decl.Name) {
+				ign := decl.Name
+				if ctx.getPubName(&ign) {
+					ctx.ignored = append(ctx.ignored, ign)
 				}
 			}
-			typ, del := compileStructOrUnion(ctx, name, decl, pub)
-			if suKind != suAnonymous {
-				if pub {
-					substObj(ctx.pkg.Types, scope, origName, scope.Lookup(name))
+		}
+		pending.Inner = append(pending.Inner, decl)
+		if decl.Kind != ast.VarDecl {
+			n := len(pending.Inner) - 1
+			i := compileGlobalDecls(ctx, pending, n, scope)
+			pending.Inner = append(pending.Inner[:0], pending.Inner[i:]...)
+		}
+		return nil
+	})
+	if err == nil {
+		compileGlobalDecls(ctx, pending, len(pending.Inner), scope)
+	}
+	return err
+}
+
+// compileGlobalDecl compiles a global decl. If it fails, the error is recorded
+// and compiling goes on with the next decl.
+func compileGlobalDecl(ctx *blockCtx, node *ast.Node, i int, scope *types.Scope) (next int) {
+	cb := ctx.cb
+	// A shallow copy of cb is enough to restore it: the stack (empty between
+	// decls) and the current block with its scope and stmts are held by value,
+	// so elements pushed, blocks entered and stmts added after it are dropped.
+	saved := *cb
+	defer func() {
+		if e := recover(); e != nil {
+			*cb = saved
+			ctx.curfn, ctx.curflow = nil, nil
+			ctx.addError(e)
+		}
+	}()
+	next = i
+	ctx.curnode = node.Inner[i]
+	return compileDecl(ctx, node, i, scope, true)
+}
+
+func compileDecl(ctx *blockCtx, node *ast.Node, i int, scope *types.Scope, global bool) int {
+	decl := node.Inner[i]
+	switch decl.Kind {
+	case ast.VarDecl:
+		compileVarDecl(ctx, decl, global)
+	case ast.TypedefDecl:
+		origName, pub := decl.Name, false
+		if global {
+			pub = ctx.getPubName(&decl.Name)
+		}
+		compileTypedef(ctx, decl, global, pub)
+		if global {
+			ctx.recordDecl(decl.Name, origName, decl)
+		}
+		if pub {
+			substObj(ctx.pkg.Types, scope, origName, scope.Lookup(decl.Name))
+		}
+	case ast.RecordDecl:
+		pub := false
+		name, suKind := ctx.getSuName(decl, decl.TagUsed)
+		origName := name
+		if global {
+			if suKind == suAnonymous {
+				// pub = true if this is a public typedef
+				pub = i+1 < len(node.Inner) && isPubTypedef(ctx, node.Inner[i+1])
+			} else {
+				pub = ctx.getPubName(&name)
+				if decl.CompleteDefinition && ctx.checkExists(name) {
+					return i
 				}
-				break
 			}
-			ctx.unnameds[decl.ID] = unnamedType{typ: typ, del: del}
-			for i+1 < n {
-				next := node.Inner[i+1]
-				if next.Kind == ast.VarDecl {
-					if ret, ok := checkAnonymous(ctx, scope, typ, next); ok {
-						compileVarWith(ctx, ret, next)
-						i++
-						continue
-					}
-				}
-				break
+		}
+		typ, del := compileStructOrUnion(ctx, name, decl, pub)
+		if suKind != suAnonymous {
+			if pub {
+				substObj(ctx.pkg.Types, scope, origName, scope.Lookup(name))
 			}
-		case ast.EnumDecl:
-			compileEnum(ctx, decl, global)
-		case ast.EmptyDecl:
-		case ast.FunctionDecl:
-			if global {
-				compileFunc(ctx, decl)
-				continue
+			break
+		}
+		ctx.unnameds[decl.ID] = unnamedType{typ: typ, del: del}
+		for i+1 < len(node.Inner) {
+			next := node.Inner[i+1]
+			if next.Kind == ast.VarDecl {
+				if ret, ok := checkAnonymous(ctx, scope, typ, next); ok {
+					compileVarWith(ctx, ret, next)
+					i++
+					continue
+				}
 			}
-			fallthrough
-		case ast.StaticAssertDecl:
-			continue
-		default:
-			log.Panicln("compileDeclStmt: unknown kind =", decl.Kind)
+			break
+		}
+	case ast.EnumDecl:
+		compileEnum(ctx, decl, global)
+	case ast.EmptyDecl:
+	case ast.FunctionDecl:
+		if global {
+			compileFunc(ctx, decl)
 		}
+	case ast.StaticAssertDecl:
+	default:
+		ctx.errorf(decl, "compileDeclStmt: unknown kind = %v", decl.Kind)
 	}
+	return i
 }
 
 func compileFunc(ctx *blockCtx, fn *ast.Node) {
@@ -402,9 +654,9 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 			ast.AlwaysInlineAttr, ast.WarnUnusedResultAttr, ast.NoThrowAttr, ast.NoInlineAttr, ast.AllocSizeAttr,
 			ast.NonNullAttr, ast.ConstAttr, ast.PureAttr, ast.GNUInlineAttr, ast.ReturnsTwiceAttr, ast.NoSanitizeAttr,
 			ast.RestrictAttr, ast.MSAllocatorAttr, ast.VisibilityAttr, ast.C11NoReturnAttr, ast.StrictFPAttr,
-			ast.AllocAlignAttr, ast.DisableTailCallsAttr, ast.FormatArgAttr:
+			ast.AllocAlignAttr, ast.DisableTailCallsAttr, ast.FormatArgAttr, ast.OverloadableAttr:
 		default:
-			log.Panicln("compileFunc: unknown kind =", item.Kind)
+			ctx.panicf(item, "compileFunc: unknown kind = %v", item.Kind)
 		}
 	}
 	variadic := fn.Variadic
@@ -434,18 +686,26 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 		if err != nil {
 			log.Panicln("compileFunc:", err)
 		}
+		ctx.recordDecl(fnName, origName, fn)
+		if ctx.lineDir {
+			if doc := ctx.lineDirective(fn); doc != nil {
+				f.SetComments(pkg, doc)
+			}
+		}
 		if rewritten { // for fnName is a recursive function
 			scope := pkg.Types.Scope()
 			substObj(pkg.Types, scope, origName, f.Obj())
 			rewritten = false
 		}
-		cb := f.BodyStart(pkg)
-		ctx.curfn = newFuncCtx(pkg, ctx.markComplicated(fnName, body), origName)
-		compileSub(ctx, body)
-		checkNeedReturn(ctx, body)
-		ctx.curfn = nil
-		cb.End()
+		if ctx.skipBody && ctx.inSrcFile() && !hasRecordDecl(body) {
+			f.BodyStart(pkg).End()
+		} else {
+			compileFuncBody(ctx, f, fnName, origName, body)
+		}
 		if isMain {
+			if len(params) > 3 {
+				ctx.panicf(fn, "main func with %d params is not supported", len(params))
+			}
 			var t *types.Var
 			var entryParams *types.Tuple
 			var entry = "main"
@@ -456,7 +716,7 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 				t = pkg.NewParam(token.NoPos, "t", types.NewPointer(testing.Ref("T").Type()))
 				entryParams = types.NewTuple(t)
 			}
-			pkg.NewFunc(nil, entry, entryParams, nil, false).BodyStart(pkg)
+			cb := pkg.NewFunc(nil, entry, entryParams, nil, false).BodyStart(pkg)
 			if results != nil {
 				if testMain {
 					// if _cgo_ret := _cgo_main(); _cgo_ret != 0 {
@@ -469,9 +729,7 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 				}
 			}
 			cb.Val(f.Obj())
-			if params != nil {
-				panic("TODO: main func with params")
-			}
+			mainArgs(ctx, params)
 			cb.Call(len(params))
 			if results != nil {
 				if testMain {
@@ -500,6 +758,87 @@ func compileFunc(ctx *blockCtx, fn *ast.Node) {
 	}
 }
 
+// mainArgs pushes arguments of main(argc, argv, envp), that are:
+//
+//	len(os.Args), clang.CStrings(os.Args), clang.CStrings(os.Environ())
+func mainArgs(ctx *blockCtx, params []*types.Var) {
+	pkg, cb := ctx.pkg, ctx.cb
+	if len(params) == 0 {
+		return
+	}
+	os, clang := pkg.Import("os"), pkg.Import(clangPkgPath)
+	for i, param := range params {
+		switch i {
+		case 0:
+			cb.Val(pkg.Builtin().Ref("len")).Val(os.Ref("Args")).Call(1)
+		case 1:
+			cb.Val(clang.Ref("CStrings")).Val(os.Ref("Args")).Call(1)
+		default:
+			cb.Val(clang.Ref("CStrings")).Val(os.Ref("Environ")).Call(0).Call(1)
+		}
+		typeCast(ctx, param.Type(), cb.Get(-1))
+	}
+}
+
+// hasRecordDecl reports whether a struct or union type is declared in body.
+func hasRecordDecl(body *ast.Node) bool {
+	if body.Kind == ast.RecordDecl {
+		return true
+	}
+	for _, item := range body.Inner {
+		if hasRecordDecl(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileFuncBody compiles body of a C function. If it fails, the error is
+// recorded and the function body is replaced by a stub:
+//
+//	panic("c2go: <reason> at file.c:123")
+func compileFuncBody(ctx *blockCtx, f *gogen.Func, fnName, origName string, body *ast.Node) {
+	pkg, cb := ctx.pkg, ctx.cb
+	saved := *cb // see compileGlobalDecl
+	defer func() {
+		if e := recover(); e != nil {
+			*cb = saved
+			ctx.curfn, ctx.curflow = nil, nil
+			d := ctx.addError(e)
+			if ctx.funcStub {
+				d.Severity = SevWarning
+			}
+			f.BodyStart(pkg).
+				Val(types.Universe.Lookup("panic")).Val(stubMsg(d)).Call(1).EndStmt().
+				End()
+		}
+	}()
+	f.BodyStart(pkg)
+	jmps := setjmpStmts(body)
+	ctx.curfn = newFuncCtx(pkg, ctx.markComplicated(fnName, body) || jmps != nil, origName)
+	if addrs := addrLabelsOf(body); addrs != nil {
+		ctx.curfn.addrs, ctx.curfn.lblv = addrs, newLabelsVar(ctx, len(addrs))
+	}
+	if jmps != nil {
+		compileSetjmpBody(ctx, body, jmps)
+	} else {
+		compileSub(ctx, body)
+		checkNeedReturn(ctx, body)
+	}
+	ctx.curfn = nil
+	cb.End()
+	if ctx.lineDir {
+		cb.SetComments(nil, false)
+	}
+}
+
+func stubMsg(d *Diagnostic) string {
+	if pos := d.Pos; pos.IsValid() {
+		return fmt.Sprintf("c2go: %s at %s:%d", d.Msg, filepath.Base(pos.Filename), pos.Line)
+	}
+	return "c2go: " + d.Msg
+}
+
 func (p *blockCtx) getPubName(pfnName *string) (ok bool) {
 	name := *pfnName
 	goName, ok := p.public[name]
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 
@@ -40,20 +41,24 @@ func init() {
 }
 
 func parse(code string, json *[]byte) (doc *ast.Node, src []byte) {
+	return parseEx(code, json, "")
+}
+
+func parseEx(code string, json *[]byte, target string) (doc *ast.Node, src []byte) {
 	idx := atomic.AddInt64(&tmpFileIdx, 1)
 	infile := tmpDir + strconv.FormatInt(idx, 10) + ".c"
 	err := os.WriteFile(infile, []byte(code), 0666)
 	check(err)
 
 	outfile := infile + ".i"
-	err = preprocessor.Do(infile, outfile, nil)
+	err = preprocessor.Do(infile, outfile, &preprocessor.Config{Target: target})
 	check(err)
 	os.Remove(infile)
 
 	src, err = os.ReadFile(outfile)
 	check(err)
 
-	doc, _, err = parser.ParseFileEx(outfile, 0, &parser.Config{Json: json})
+	doc, _, err = parser.ParseFileEx(outfile, 0, &parser.Config{Json: json, Target: target})
 	check(err)
 	os.Remove(outfile)
 	return
@@ -340,3 +345,377 @@ void test() {
 }
 
 // -----------------------------------------------------------------------------
+
+func TestDiagnostics(t *testing.T) {
+	doc, src := parse(`
+int bad(int x) {
+    return ({ if (x < 0) return 0; x + 1; });
+}
+
+int good(int x) {
+    return x + 1;
+}
+`, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src})
+	diags, ok := err.(ErrorList)
+	if !ok || len(diags) != 1 {
+		t.Fatal("NewPackage:", err)
+	}
+	if d := diags[0]; d.Severity != SevError || d.Pos.Line != 3 || d.Msg != "return in statement expression is not supported" {
+		t.Fatal("diagnostic:", d)
+	}
+	file := gogen.ASTFile(pkg.Package)
+	for _, name := range []string{"bad", "good"} {
+		if findFunc(file, name) == nil {
+			t.Fatal("func not found:", name)
+		}
+	}
+}
+
+func TestFuncStubOnError(t *testing.T) {
+	pkg := testFuncEx(t, "testFuncStub", `#line 1 "bad.c"
+int test(int x) {
+    return ({ if (x < 0) return 0; x + 1; });
+}
+`, `func test(x int32) int32 {
+	panic("c2go: return in statement expression is not supported at bad.c:2")
+}`, func(conf *Config) {
+		conf.FuncStubOnError = true
+	})
+	if diags := pkg.Diagnostics(); len(diags) != 1 || diags[0].Severity != SevWarning {
+		t.Fatal("Diagnostics:", diags)
+	}
+}
+
+func TestRestoreOnError(t *testing.T) {
+	doc, src := parse(`
+int bad(int x) {
+    if (x) {
+        int y = x + ({ return 0; 1; });
+    }
+    return x;
+}
+
+__attribute__((used)) int unknown(int x) {
+    return x;
+}
+
+int good(int x) {
+    return x + 1;
+}
+`, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, FuncStubOnError: true})
+	diags, ok := err.(ErrorList)
+	if !ok || len(diags) != 2 || diags[0].Pos.Line != 4 || diags[1].Pos.Line != 9 ||
+		diags[1].Severity != SevError || diags[1].Msg != "compileFunc: unknown kind = UsedAttr" {
+		t.Fatal("NewPackage:", err)
+	}
+	if cb := pkg.CB(); cb.InternalStack().Len() != 0 || cb.Scope() != pkg.Types.Scope() {
+		t.Fatal("CodeBuilder isn't restored")
+	}
+	file := gogen.ASTFile(pkg.Package)
+	var b bytes.Buffer
+	for _, name := range []string{"bad", "good"} {
+		format.Node(&b, token.NewFileSet(), findFunc(file, name))
+		b.WriteByte('\n')
+	}
+	if ret := b.String(); !strings.HasPrefix(ret, `func bad(x int32) int32 {
+	panic("c2go: return in statement expression is not supported at `) ||
+		!strings.HasSuffix(ret, `
+func good(x int32) int32 {
+	return x + int32(1)
+}
+`) {
+		t.Fatal("Result:", ret)
+	}
+}
+
+func TestLineDirectives(t *testing.T) {
+	doc, src := parse(`#line 10 "foo.c"
+int test(int x) {
+    int y = x;
+
+    if (y > 1)
+        y--;
+    for (x = 0; x < 2; x++)
+        y++;
+    return y;
+}
+
+int g = 1;
+
+int test2(void) {
+    return g;
+}
+`, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, LineDirectives: true})
+	check(err)
+	var w bytes.Buffer
+	err = pkg.WriteTo(&w)
+	check(err)
+	if out := w.String(); out != `package main
+
+//line foo.c:10
+func test(x int32) int32 {
+//line foo.c:11
+	var y int32 = x
+//line foo.c:13
+	if y > int32(1) {
+//line foo.c:14
+		y--
+	}
+//line foo.c:15
+	for x = int32(0); x < int32(2); x++ {
+//line foo.c:16
+		y++
+	}
+//line foo.c:17
+	return y
+}
+//line c2go_header.i.go:21
+
+var g int32 = int32(1)
+
+//line foo.c:22
+func test2() int32 {
+//line foo.c:23
+	return g
+}
+//line c2go_header.i.go:30
+` {
+		t.Fatal("TestLineDirectives:", out)
+	}
+}
+
+func TestTarget(t *testing.T) {
+	doc, src := parseEx(`
+struct foo {
+	long a;
+	char b;
+	void *p;
+};
+
+unsigned long test(long x) {
+	return sizeof(long) + sizeof(void*) + sizeof(struct foo) + __builtin_offsetof(struct foo, p) + x + 1L;
+}
+`, nil, "i386-pc-linux-gnu")
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, Target: "i386-pc-linux-gnu"})
+	check(err)
+	b, err := pkg.goFile()
+	check(err)
+	if out := string(b); out != gogen.GeneratedHeader+`//go:build 386
+
+package main
+
+import "unsafe"
+
+type struct_foo struct {
+	a int32
+	b int8
+	p unsafe.Pointer
+}
+
+func test(x int32) uint32 {
+	return uint32(28) + uint32(x) + uint32(1)
+}
+` {
+		t.Fatal("TestTarget:", out)
+	}
+	if _, err = NewPackage("", "main", doc, &Config{Src: src, Target: "foo-bar"}); err == nil {
+		t.Fatal("NewPackage: no error for unsupported target")
+	}
+}
+
+func TestLongDouble(t *testing.T) {
+	doc, src := parse(`
+long double test(long double x, int n) {
+	return x / 3 + n;
+}
+`, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, LongDouble: LDM_X87})
+	check(err)
+	b, err := pkg.goFile()
+	check(err)
+	if out := string(b); out != gogen.GeneratedHeader+`package main
+
+import "github.com/goplus/c2go/clang"
+
+func test(x clang.Float80, n int32) clang.Float80 {
+	return x.Quo(clang.Float80FromInt64(int64(int32(3)))).Add(clang.Float80FromInt64(int64(n)))
+}
+` {
+		t.Fatal("TestLongDouble:", out)
+	}
+}
+
+func TestBitsBuiltin(t *testing.T) {
+	doc, src := parse(`
+int test(unsigned x, long long *r) {
+	return __builtin_popcount(x) + __builtin_mul_overflow(x, 3, r);
+}
+`, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, BuiltinFuncMode: BFM_InLibC})
+	check(err)
+	b, err := pkg.goFile()
+	check(err)
+	if out := string(b); out != gogen.GeneratedHeader+`package main
+
+import (
+	"math"
+	"math/bits"
+)
+
+func test(x uint32, r *int64) int32 {
+	return int32(bits.OnesCount32(x)) + func() int32 {
+		if func(_cgo_a int64, _cgo_b int64, _cgo_res *int64) bool {
+			_cgo_v := _cgo_a * _cgo_b
+			*_cgo_res = _cgo_v
+			return _cgo_a == -1 && _cgo_b == math.MinInt64 || _cgo_a != 0 && _cgo_v/_cgo_a != _cgo_b
+		}(int64(x), int64(3), r) {
+			return 1
+		} else {
+			return 0
+		}
+	}()
+}
+` {
+		t.Fatal("TestBitsBuiltin:", out)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	doc, src := parse(`
+int vendor_popcount(unsigned x);
+
+int test(unsigned x) {
+	int n = vendor_popcount(x);
+	return n + __builtin_bswap16(x);
+}
+`, nil)
+	builtins := map[string]*BuiltinFunc{
+		"vendor_popcount":   {GoPkg: "math/bits", GoFunc: "OnesCount32"},
+		"__builtin_bswap16": {Proto: "uint16 (uint16)", GoFunc: "bswap16"},
+		"vendor_bad":        {Proto: "uint16 ("},
+		"vendor_group":      {Overloads: []string{"vendor_popcount", "vendor_none"}},
+	}
+	_, err := NewPackage("", "main", doc, &Config{Src: src, Builtins: builtins})
+	if diags, ok := err.(ErrorList); !ok || len(diags) != 2 ||
+		diags[0].Msg != `builtin vendor_bad: invalid prototype "uint16 ("` ||
+		diags[1].Msg != "builtin vendor_group: overload vendor_none not found" {
+		t.Fatal("NewPackage:", err)
+	}
+	delete(builtins, "vendor_bad")
+	delete(builtins, "vendor_group")
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, Builtins: builtins, BuiltinFuncMode: BFM_InLibC})
+	check(err)
+	b, err := pkg.goFile()
+	check(err)
+	if out := string(b); out != gogen.GeneratedHeader+`package main
+
+import "math/bits"
+
+func test(x uint32) int32 {
+	var n int32 = int32(bits.OnesCount32(x))
+	return n + int32(Xbswap16(uint16(x)))
+}
+` {
+		t.Fatal("TestBuiltins:", out)
+	}
+}
+
+func TestStmtExprJumps(t *testing.T) {
+	doc, src := parse(`
+int f(int x) {
+	int y = ({ if (x) goto out; x; });
+out:
+	return y;
+}
+
+int g(int x) {
+	while (x--) {
+		x += ({ if (x == 3) break; 1; });
+	}
+	return x;
+}
+`, nil)
+	_, err := NewPackage("", "main", doc, &Config{Src: src})
+	diags, ok := err.(ErrorList)
+	if !ok || len(diags) != 2 ||
+		diags[0].Msg != "goto out out of statement expression is not supported" || diags[0].Pos.Line != 3 ||
+		diags[1].Msg != "break out of statement expression is not supported" || diags[1].Pos.Line != 10 {
+		t.Fatal("NewPackage:", err)
+	}
+}
+
+func TestComputedGoto(t *testing.T) {
+	testFunc(t, "Dispatch", `
+int test(int op) {
+	static void *tbl[] = { &&inc, &&dec };
+	int n = 0;
+	goto *tbl[op];
+inc:
+	return n + 1;
+dec:
+	return n - 1;
+}
+`, `func test(op int32) int32 {
+	var n int32 = int32(0)
+	switch uintptr(*(*unsafe.Pointer)(unsafe.Pointer(uintptr(unsafe.Pointer((*unsafe.Pointer)(unsafe.Pointer(&_cgos_test_tbl)))) + uintptr(op)*8))) - uintptr(unsafe.Pointer(&_cgo_labels_test[0])) {
+	case 0:
+		goto inc
+	case 1:
+		goto dec
+	default:
+		panic("c2go: goto *addr: invalid label address")
+	}
+inc:
+	return n + int32(1)
+dec:
+	return n - int32(1)
+	return 0
+}`)
+}
+
+func TestSetjmpDiagnostics(t *testing.T) {
+	doc, src := parse(`
+#include <setjmp.h>
+
+int f(jmp_buf env) {
+	do {
+	} while (setjmp(env));
+	return 0;
+}
+
+int g(jmp_buf env) {
+	return ({ setjmp(env); });
+}
+`, nil)
+	_, err := NewPackage("", "main", doc, &Config{Src: src})
+	diags, ok := err.(ErrorList)
+	if !ok || len(diags) != 2 ||
+		diags[0].Msg != "setjmp in condition of do statement is not supported" || diags[0].Pos.Line != 6 ||
+		diags[1].Msg != "setjmp in statement expression is not supported" || diags[1].Pos.Line != 11 {
+		t.Fatal("NewPackage:", err)
+	}
+}
+
+func TestMainArgs(t *testing.T) {
+	testWith(t, "argv", "main", `
+int main(int argc, char *argv[]) {
+	return argc;
+}
+`, `func main() {
+	os.Exit(int(_cgo_main(int32(len(os.Args)), clang.CStrings(os.Args))))
+}`, nil)
+	testWith(t, "envp", "TestMain", `
+int main(int argc, char **argv, char **envp) {
+	return 0;
+}
+`, `func TestMain(t *testing.T) {
+	if _cgo_ret := _cgo_main(int32(len(os.Args)), clang.CStrings(os.Args), clang.CStrings(os.Environ())); _cgo_ret != 0 {
+		t.Fatal("exit status", _cgo_ret)
+	}
+}`, func(conf *Config) {
+		conf.TestMain = true
+	})
+}
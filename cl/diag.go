@@ -0,0 +1,346 @@
+package cl
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	goast "go/ast"
+
+	"github.com/goplus/c2go/clang/ast"
+	"github.com/goplus/c2go/clang/pathutil"
+	"github.com/goplus/gogen"
+)
+
+// -----------------------------------------------------------------------------
+
+// Severity represents how serious a Diagnostic is.
+type Severity int
+
+const (
+	SevError Severity = iota
+	SevWarning
+)
+
+func (p Severity) String() string {
+	if p == SevWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic represents a problem found when compiling a C translation unit.
+type Diagnostic struct {
+	Pos      token.Position // position in C source (file:line:col)
+	Severity Severity
+	Msg      string
+}
+
+func (p *Diagnostic) Error() string {
+	return fmt.Sprintf("%v: %v: %s", p.Pos, p.Severity, p.Msg)
+}
+
+// ErrorList is a list of diagnostics.
+// NewPackage returns it as an error if it contains any SevError diagnostic.
+type ErrorList []*Diagnostic
+
+func (p ErrorList) Error() string {
+	msgs := make([]string, len(p))
+	for i, d := range p {
+		msgs[i] = d.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// HasError checks if there is any SevError diagnostic in this list.
+func (p ErrorList) HasError() bool {
+	for _, d := range p {
+		if d.Severity == SevError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns p as an error if p.HasError(), otherwise returns nil.
+func (p ErrorList) Err() error {
+	if p.HasError() {
+		return p
+	}
+	return nil
+}
+
+// Diagnostics returns all diagnostics of the last NewPackage call.
+func (p Package) Diagnostics() ErrorList {
+	return p.diags
+}
+
+// -----------------------------------------------------------------------------
+
+type lineMarker struct {
+	iline int    // line number in *.i file where this marker takes effect
+	line  int    // presumed line number
+	file  string // presumed file
+	sys   bool   // file is a system header
+}
+
+type diagCtx struct {
+	diags    ErrorList
+	curnode  *ast.Node // the decl or stmt being compiled
+	markers  []lineMarker
+	markerOk bool
+}
+
+// newDiag creates a diagnostic at position of node v (if v isn't nil).
+func (p *blockCtx) newDiag(v *ast.Node, sev Severity, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{Pos: p.position(v), Severity: sev, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *blockCtx) warnf(v *ast.Node, format string, args ...interface{}) {
+	p.diags = append(p.diags, p.newDiag(v, SevWarning, format, args...))
+}
+
+func (p *blockCtx) errorf(v *ast.Node, format string, args ...interface{}) {
+	p.diags = append(p.diags, p.newDiag(v, SevError, format, args...))
+}
+
+// panicf aborts compiling current decl with an error diagnostic.
+// If v is nil, position of the decl or stmt being compiled is used.
+func (p *blockCtx) panicf(v *ast.Node, format string, args ...interface{}) {
+	panic(p.newDiag(v, SevError, format, args...))
+}
+
+// addError converts a recovered panic value into an error diagnostic.
+func (p *blockCtx) addError(e interface{}) *Diagnostic {
+	var d *Diagnostic
+	switch v := e.(type) {
+	case *Diagnostic:
+		d = v
+	case *gogen.CodeError:
+		d = &Diagnostic{Pos: p.goPosition(v.Pos), Msg: v.Msg}
+	case error:
+		d = &Diagnostic{Msg: v.Error()}
+	default:
+		d = &Diagnostic{Msg: strings.TrimSuffix(fmt.Sprint(v), "\n")}
+	}
+	if !d.Pos.IsValid() {
+		d.Pos = p.position(p.curnode)
+	}
+	p.diags = append(p.diags, d)
+	return d
+}
+
+// position returns the presumed C source position of node v.
+func (p *blockCtx) position(v *ast.Node) token.Position {
+	if v != nil {
+		if off, ok := nodeOffset(v); ok {
+			return p.offsetPosition(off)
+		}
+	}
+	return token.Position{}
+}
+
+func (p *blockCtx) goPosition(pos token.Pos) token.Position {
+	if f := p.file; f != nil && pos.IsValid() {
+		if base := f.Base(); int(pos) >= base && int(pos) <= base+f.Size() {
+			return p.offsetPosition(int(pos) - base)
+		}
+	}
+	return token.Position{}
+}
+
+func (p *blockCtx) offsetPosition(off int) (pos token.Position) {
+	f := p.file
+	if f == nil || off > f.Size() {
+		return
+	}
+	pos = f.Position(token.Pos(f.Base() + off))
+	if m := p.lineMarker(pos.Line); m != nil {
+		pos.Filename, pos.Line = m.file, m.line+pos.Line-m.iline
+	}
+	return
+}
+
+// setLineDirective makes the next emitted Go statement carry a //line directive
+// which refers to C source position of node v.
+func (p *blockCtx) setLineDirective(v *ast.Node) {
+	if p.lineDir {
+		if c := p.lineDirective(v); c != nil {
+			p.cb.SetComments(c, true)
+		}
+	}
+}
+
+// suspendLineDir stops emitting //line directives, eg. for init and post
+// statements of a Go for statement. It returns the old state.
+func (p *blockCtx) suspendLineDir() (old bool) {
+	if old, p.lineDir = p.lineDir, false; old {
+		p.cb.SetComments(nil, false)
+	}
+	return
+}
+
+// lineDirective returns a //line comment which refers to C source position of
+// node v. go/printer prints it like other comments, so it's moved to column 1
+// of its own line by fixLineDirectives when the Go file is written.
+func (p *blockCtx) lineDirective(v *ast.Node) *goast.CommentGroup {
+	pos := p.position(v)
+	if !pos.IsValid() || pos.Filename == "" {
+		return nil
+	}
+	text := "//line " + pathutil.Canonical(p.srcdir, pos.Filename) + ":" + strconv.Itoa(pos.Line)
+	if p.srcmap != nil { // column is used by source map, see srcMap.build
+		text += ":" + strconv.Itoa(pos.Column)
+	}
+	return &goast.CommentGroup{List: []*goast.Comment{{Text: text}}}
+}
+
+// fixLineDirectives moves //line comments of src (a printed Go file) to column
+// 1 of their own lines, where Go compiler recognizes them as line directives.
+// After each top-level decl which has line directives, it adds a directive to
+// restore positions of the Go file gofile, so that following Go code isn't
+// attributed to C source. gofile is the base name of the Go file ("" means
+// unknown, and positions aren't restored).
+func fixLineDirectives(src []byte, gofile string) []byte {
+	const prefix = "//line "
+	fset := token.NewFileSet()
+	f := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(f, src, nil, scanner.ScanComments)
+	var b bytes.Buffer
+	last, depth, dirty := 0, 0, false
+	for {
+		pos, tok, lit := s.Scan()
+		switch tok {
+		case token.EOF:
+			b.Write(src[last:])
+			return b.Bytes()
+		case token.COMMENT:
+			if !strings.HasPrefix(lit, prefix) {
+				continue
+			}
+			off := f.Offset(pos)
+			code := bytes.TrimRight(src[last:off], " \t")
+			b.Write(code)
+			if n := len(code); n > 0 && code[n-1] != '\n' {
+				b.WriteByte('\n')
+			}
+			if depth == 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n\n")) { // doc of a decl
+				b.WriteByte('\n')
+			}
+			b.WriteString(lit)
+			last, dirty = off+len(lit), true
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK:
+			depth--
+		case token.RBRACE:
+			end := f.Offset(pos) + 1
+			if depth--; depth == 0 && dirty && gofile != "" && isDeclEnd(src[end:]) {
+				b.Write(src[last:end])
+				if end < len(src) && src[end] == '\n' {
+					end++
+				}
+				b.WriteByte('\n')
+				line := bytes.Count(b.Bytes(), []byte{'\n'}) + 2 // line after the directive
+				b.WriteString(prefix + gofile + ":" + strconv.Itoa(line) + "\n")
+				last, dirty = end, false
+			}
+		}
+	}
+}
+
+// isDeclEnd checks if a top-level } followed by rest ends a decl rather than a
+// type in it, such as interface{} in a func signature.
+func isDeclEnd(rest []byte) bool {
+	return len(rest) == 0 || rest[0] == '\n' || bytes.HasPrefix(rest, []byte("//"))
+}
+
+func nodeOffset(v *ast.Node) (int, bool) {
+	if loc := v.Loc; loc != nil && loc.Col != 0 {
+		return int(loc.Offset), true
+	}
+	if rg := v.Range; rg != nil {
+		if begin := rg.Begin; begin.Col != 0 {
+			return int(begin.Offset), true
+		} else if loc := begin.ExpansionLoc; loc != nil && loc.Col != 0 {
+			return int(loc.Offset), true
+		}
+	}
+	return 0, false
+}
+
+// lineMarker returns the last line marker (# N "file") before line iline of *.i file.
+func (p *blockCtx) lineMarker(iline int) *lineMarker {
+	if !p.markerOk {
+		p.markers, p.markerOk = parseLineMarkers(p.src), true
+	}
+	markers := p.markers
+	i := sort.Search(len(markers), func(i int) bool {
+		return markers[i].iline > iline
+	})
+	if i == 0 {
+		return nil
+	}
+	return &markers[i-1]
+}
+
+func parseLineMarkers(src []byte) (markers []lineMarker) {
+	for iline := 1; len(src) > 0; iline++ {
+		var line []byte
+		if pos := bytes.IndexByte(src, '\n'); pos >= 0 {
+			line, src = src[:pos], src[pos+1:]
+		} else {
+			line, src = src, nil
+		}
+		if len(line) < 3 || line[0] != '#' {
+			continue
+		}
+		line = bytes.TrimPrefix(bytes.TrimLeft(line[1:], " \t"), []byte("line"))
+		fields := strings.Fields(string(line))
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		file, flags := fields[1], fields[2:]
+		if len(file) >= 2 && file[0] == '"' {
+			if end := strings.LastIndexByte(string(line), '"'); end > 0 {
+				file = string(line[bytes.IndexByte(line, '"') : end+1])
+				flags = strings.Fields(string(line[end+1:]))
+			}
+			if v, err := strconv.Unquote(file); err == nil {
+				file = v
+			} else {
+				file = file[1 : len(file)-1]
+			}
+		}
+		sys := false
+		for _, flag := range flags {
+			sys = sys || flag == "3"
+		}
+		markers = append(markers, lineMarker{iline: iline + 1, line: n, file: file, sys: sys})
+	}
+	return
+}
+
+// inSysHeader checks if node v is in a system header, by line markers of the
+// *.i file.
+func (p *blockCtx) inSysHeader(v *ast.Node) bool {
+	if f := p.file; f != nil {
+		if off, ok := nodeOffset(v); ok && off <= f.Size() {
+			if m := p.lineMarker(f.Position(token.Pos(f.Base() + off)).Line); m != nil {
+				return m.sys
+			}
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
@@ -38,7 +38,7 @@ func compileExprEx(ctx *blockCtx, expr *ast.Node, prompt string, flags int) {
 	case ast.MemberExpr:
 		compileMemberExpr(ctx, expr, (flags&flagLHS) != 0)
 	case ast.CallExpr:
-		compileCallExpr(ctx, expr)
+		compileCallExpr(ctx, expr, flags)
 	case ast.CompoundAssignOperator:
 		compileCompoundAssignOperator(ctx, expr, flags)
 	case ast.ImplicitCastExpr:
@@ -53,6 +53,8 @@ func compileExprEx(ctx *blockCtx, expr *ast.Node, prompt string, flags int) {
 		compileFloatLiteral(ctx, expr)
 	case ast.ParenExpr, ast.ConstantExpr:
 		compileExprEx(ctx, expr.Inner[0], prompt, flags)
+	case ast.GenericSelectionExpr:
+		compileExprEx(ctx, genericSelected(ctx, expr), prompt, flags)
 	case ast.CStyleCastExpr:
 		compileTypeCast(ctx, expr, ctx.goNode(expr))
 	case ast.ArraySubscriptExpr:
@@ -68,12 +70,16 @@ func compileExprEx(ctx *blockCtx, expr *ast.Node, prompt string, flags int) {
 	case ast.VAArgExpr:
 		compileVAArgExpr(ctx, expr)
 	case ast.AtomicExpr:
-		compileAtomicExpr(ctx, expr)
+		compileAtomicExpr(ctx, expr, flags)
 	case ast.OffsetOfExpr:
 		compileOffsetOfExpr(ctx, expr)
 	case ast.VisibilityAttr:
 	case ast.CompoundLiteralExpr:
 		compileCompoundLiteralExpr(ctx, expr)
+	case ast.StmtExpr:
+		compileStmtExpr(ctx, expr)
+	case ast.AddrLabelExpr:
+		compileAddrLabelExpr(ctx, expr)
 	case ast.InitListExpr:
 		compileExprEx(ctx, expr.Inner[0], prompt, flags)
 		t := toType(ctx, expr.Type, flags)
@@ -81,10 +87,22 @@ func compileExprEx(ctx *blockCtx, expr *ast.Node, prompt string, flags int) {
 	case ast.PredefinedExpr:
 		compileExpr(ctx, expr.Inner[0])
 	default:
-		log.Panicln(prompt, expr.Kind)
+		ctx.panicf(expr, "%s %v", prompt, expr.Kind)
 	}
 }
 
+// genericSelected returns result expression of the association which clang
+// selected for _Generic(ctrl, T1: expr1, ..., default: exprN).
+func genericSelected(ctx *blockCtx, v *ast.Node) *ast.Node {
+	for _, assoc := range v.Inner[1:] {
+		if assoc.Selected {
+			return assoc.Inner[len(assoc.Inner)-1]
+		}
+	}
+	ctx.panicf(v, "_Generic: no association selected")
+	return nil
+}
+
 func compileExpr(ctx *blockCtx, expr *ast.Node) {
 	compileExprEx(ctx, expr, unknownExprPrompt, 0)
 }
@@ -114,6 +132,10 @@ func compileIntegerLiteral(ctx *blockCtx, expr *ast.Node) {
 
 func compileFloatLiteral(ctx *blockCtx, expr *ast.Node) {
 	value := expr.Value.(string)
+	if t := toType(ctx, expr.Type, 0); isSoftFloat(t) { // long double
+		softFloatLit(ctx, t, value, ctx.goNode(expr))
+		return
+	}
 	if !strings.Contains(value, ".") {
 		value += ".0"
 	}
@@ -214,8 +236,10 @@ func getBuiltinFn(v *ast.Node) (fn string, ok bool) {
 
 func compileImplicitCastExpr(ctx *blockCtx, v *ast.Node) {
 	switch v.CastKind {
-	case ast.LValueToRValue, ast.NoOp:
+	case ast.LValueToRValue, ast.NoOp, ast.NonAtomicToAtomic:
 		compileExpr(ctx, v.Inner[0])
+	case ast.AtomicToNonAtomic:
+		compileAtomicLoad(ctx, v)
 	case ast.BuiltinFnToFnPtr:
 		if fn, ok := getBuiltinFn(v.Inner[0]); ok && ctx.pkg.Types.Scope().Lookup(fn) != nil {
 			ctx.addExternFunc(fn)
@@ -253,9 +277,13 @@ func compileToBoolean(ctx *blockCtx, v *ast.Node) {
 	case ast.IntegralToBoolean:
 		elem := ctx.cb.InternalStack().Get(-1)
 		if !isBool(elem.Type) {
-			ctx.cb.Val(0).BinaryOp(token.NEQ)
+			castToBoolExpr(ctx.cb)
 		}
 	case ast.FloatingToBoolean, ast.IntegralComplexToBoolean, ast.FloatingComplexToBoolean:
+		if isSoftFloat(ctx.cb.Get(-1).Type) { // long double
+			castToBoolExpr(ctx.cb)
+			break
+		}
 		ctx.cb.Val(0.0).BinaryOp(token.NEQ)
 	case ast.PointerToBoolean:
 		ctx.cb.Val(nil).BinaryOp(token.NEQ)
@@ -301,7 +329,7 @@ func compileDeclRefExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
 
 // -----------------------------------------------------------------------------
 
-func compileCallExpr(ctx *blockCtx, v *ast.Node) {
+func compileCallExpr(ctx *blockCtx, v *ast.Node, flags int) {
 	if n := len(v.Inner); n > 0 {
 		cb := ctx.cb
 		if fn := v.Inner[0]; isBuiltinFn(fn) {
@@ -324,7 +352,13 @@ func compileCallExpr(ctx *blockCtx, v *ast.Node) {
 				compileExpr(ctx, v.Inner[2])
 				compareOp(ctx, token.EQL, ctx.goNode(v))
 				return
+			default:
+				if compileAtomicBuiltin(ctx, v, name, flags) || compileBitsBuiltin(ctx, v, name, flags) {
+					return
+				}
 			}
+		} else if compileSetjmpCall(ctx, v) {
+			return
 		}
 		for i := 0; i < n; i++ {
 			compileExpr(ctx, v.Inner[i])
@@ -383,7 +417,11 @@ func compileMemberExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
 	if lhs {
 		cb.MemberRef(name, src)
 	} else {
+		bf := bitFieldOf(ctx, cb.Get(-1).Type, name)
 		_, err := cb.Member(name, gogen.MemberFlagVal, src)
+		if bf != nil && err == nil {
+			bitFieldVal(ctx, toType(ctx, v.Type, 0), bf)
+		}
 		if err != nil { // see aslong @ testdata/compoundlit.c
 			if t, ok := checkAnonyUnion(cb.InternalStack().Get(-1).Type); ok {
 				if stru, ok := t.Underlying().(*types.Struct); ok && stru.NumFields() == 1 {
@@ -402,6 +440,48 @@ func compileMemberExpr(ctx *blockCtx, v *ast.Node, lhs bool) {
 	}
 }
 
+// bitFieldOf returns the bit field name of struct t (or pointer to it), if any.
+func bitFieldOf(ctx *blockCtx, t types.Type, name string) *gogen.BitField {
+	if tp, ok := t.(*types.Pointer); ok {
+		t = tp.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		if vfs, ok := ctx.pkg.VFields(named); ok {
+			if sf, ok := vfs.(*structFields); ok {
+				vfs = sf.bitFields
+			}
+			if bfs, ok := vfs.(*gogen.BitFields); ok && bfs != nil {
+				for i, n := 0, bfs.Len(); i < n; i++ {
+					if bf := bfs.At(i); bf.Name == name {
+						return bf
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// bitFieldVal converts value of bit field bf, which has type of its storage
+// field, to its declared type typ. A storage field may hold bit fields of
+// different types (see structBuilder.BitField), so the sign bits are fixed.
+func bitFieldVal(ctx *blockCtx, typ types.Type, bf *gogen.BitField) {
+	v := ctx.cb.Get(-1)
+	if ctypes.Identical(v.Type, typ) || !isInteger(typ) {
+		return
+	}
+	signed := !isUnsigned(v.Type)
+	typeCast(ctx, typ, v)
+	if signed == isUnsigned(typ) {
+		if signed { // unsigned bit field with sign extended
+			ctx.cb.Val(1<<bf.Bits - 1).BinaryOp(token.AND)
+		} else {
+			n := ctx.sizeof(typ)<<3 - bf.Bits
+			ctx.cb.Val(n).BinaryOp(token.SHL).Val(n).BinaryOp(token.SHR)
+		}
+	}
+}
+
 // -----------------------------------------------------------------------------
 
 func compileCommaExpr(ctx *blockCtx, v *ast.Node, flags int) {
@@ -452,6 +532,10 @@ func compileBinaryExpr(ctx *blockCtx, v *ast.Node, flags int) {
 	default:
 		log.Panicln("compileBinaryExpr unknown operator:", v.OpCode)
 	}
+	if isAtomicType(v.Inner[0].Type) {
+		compileAtomicAssignExpr(ctx, v, flags)
+		return
+	}
 	if (flags & flagIgnoreResult) != 0 {
 		compileSimpleAssignExpr(ctx, v)
 		return
@@ -497,7 +581,9 @@ var (
 
 func compileCompoundAssignOperator(ctx *blockCtx, v *ast.Node, flags int) {
 	if op, ok := assignOps[v.OpCode]; ok {
-		if (flags & flagIgnoreResult) != 0 {
+		if isAtomicType(v.Inner[0].Type) {
+			compileAtomicAssignOpExpr(ctx, op, v, flags)
+		} else if (flags&flagIgnoreResult) != 0 && !isSoftNumExpr(ctx, v.Inner[0]) {
 			compileSimpleAssignOpExpr(ctx, op, v)
 		} else {
 			compileAssignOpExpr(ctx, op, v)
@@ -589,7 +675,11 @@ func compileIncDec(ctx *blockCtx, op token.Token, v *ast.Node) {
 	}
 	elemSize := valOfAddr(cb, addr, ctx)
 	cb.ElemRef()
-	if elemSize == 1 {
+	if typ, _ := gogen.DerefType(cb.Get(-1).Type); isInt128(typ) {
+		softIncDec(ctx, op, int128BinaryOp)
+	} else if isSoftFloat(typ) {
+		softIncDec(ctx, op, softFloatBinaryOp)
+	} else if elemSize == 1 {
 		cb.IncDec(op)
 	} else {
 		cb.Val(elemSize).AssignOp(op + (token.ADD_ASSIGN - token.INC))
@@ -700,7 +790,11 @@ func compileUnaryOperator(ctx *blockCtx, v *ast.Node, flags int) {
 	default:
 		log.Panicln("compileUnaryOperator: unknown operator -", v.OpCode)
 	}
-	if (flags & flagIgnoreResult) != 0 {
+	if isAtomicType(v.Inner[0].Type) {
+		compileAtomicIncDec(ctx, tok, v, flags)
+		return
+	}
+	if (flags&flagIgnoreResult) != 0 && !isSoftNumExpr(ctx, v.Inner[0]) {
 		compileSimpleIncDec(ctx, tok, v)
 		return
 	}
@@ -718,28 +812,6 @@ var (
 
 // -----------------------------------------------------------------------------
 
-func compileAtomicExpr(ctx *blockCtx, v *ast.Node) {
-	op := ctx.getInstr(v)
-	cb := ctx.cb.Val(ctx.pkg.Ref(op))
-	for _, expr := range v.Inner {
-		compileExpr(ctx, expr)
-	}
-	cb.Call(len(v.Inner))
-	if fn, ok := getCaller(cb); ok {
-		ctx.addExternFunc(fn)
-	}
-}
-
-func getCaller(cb *gogen.CodeBuilder) (string, bool) {
-	v := cb.Get(-1)
-	if e, ok := v.Val.(*goast.CallExpr); ok {
-		if fn, ok := e.Fun.(*goast.Ident); ok {
-			return fn.Name, true
-		}
-	}
-	return "", false
-}
-
 func decodeEscapeString(value string) (string, error) {
 	size := len(value)
 	if size == 0 {
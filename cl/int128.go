@@ -0,0 +1,89 @@
+package cl
+
+import (
+	goast "go/ast"
+	"go/token"
+	"go/types"
+	"log"
+)
+
+// -----------------------------------------------------------------------------
+
+const (
+	clangPkgPath = "github.com/goplus/c2go/clang"
+)
+
+// isInt128 checks if typ is clang.Int128 or clang.Uint128, the runtime types of
+// __int128 and unsigned __int128.
+func isInt128(typ types.Type) bool {
+	if t, ok := typ.(*types.Named); ok {
+		o := t.Obj()
+		if pkg := o.Pkg(); pkg != nil && pkg.Path() == clangPkgPath {
+			name := o.Name()
+			return name == "Int128" || name == "Uint128"
+		}
+	}
+	return false
+}
+
+var (
+	int128Ops = map[token.Token]string{
+		token.ADD: "Add",
+		token.SUB: "Sub",
+		token.MUL: "Mul",
+		token.QUO: "Quo",
+		token.REM: "Rem",
+
+		token.AND: "And",
+		token.OR:  "Or",
+		token.XOR: "Xor",
+		token.SHL: "Lsh",
+		token.SHR: "Rsh",
+	}
+)
+
+// int128BinaryOp lowers `x op y` where x is an __int128 to a method call, such
+// as x.Add(y), or x.Cmp(y) < 0 for comparisons.
+func int128BinaryOp(ctx *blockCtx, op token.Token, src goast.Node) {
+	cb := ctx.cb
+	stk := cb.InternalStack()
+	x, y := stk.Get(-2), stk.Get(-1)
+	stk.PopN(2)
+	cb.Val(x)
+	if isCmpOperator(op) {
+		cb.MemberVal("Cmp").Val(y).Call(1).Val(0).BinaryOp(op, src)
+		return
+	}
+	name, ok := int128Ops[op]
+	if !ok {
+		log.Panicln("int128BinaryOp: unexpected operator -", op)
+	}
+	cb.MemberVal(name)
+	if isShiftOpertor(op) { // x << uint(y)
+		cb.Typ(types.Typ[types.Uint]).Val(y)
+		if isInt128(y.Type) {
+			cb.MemberVal("Uint64").Call(0)
+		}
+		cb.Call(1)
+	} else {
+		cb.Val(y)
+	}
+	cb.Call(1)
+}
+
+// int128UnaryOp lowers -x, ^x and !x where x is an __int128.
+func int128UnaryOp(ctx *blockCtx, op token.Token) {
+	cb := ctx.cb
+	switch op {
+	case token.SUB:
+		cb.MemberVal("Neg").Call(0)
+	case token.XOR:
+		cb.MemberVal("Not").Call(0)
+	case token.NOT:
+		cb.MemberVal("IsZero").Call(0)
+	default:
+		log.Panicln("int128UnaryOp: unexpected operator -", op)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,777 @@
+package cl
+
+import (
+	"bytes"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	goast "go/ast"
+
+	"github.com/goplus/c2go/clang/pathutil"
+	"github.com/goplus/c2go/clang/types/parser"
+	"github.com/goplus/gogen"
+
+	ctypes "github.com/goplus/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+type macroDef struct {
+	name     string
+	params   []string // only valid for function-like macros
+	body     string
+	file     string // presumed file where this macro is defined
+	funcLike bool
+}
+
+// parseMacros parses output of `clang -E -dD` and returns all macros which
+// are still defined at the end of the translation unit.
+func parseMacros(src []byte) (macros []*macroDef, defs map[string]*macroDef) {
+	defs = make(map[string]*macroDef)
+	file := ""
+	for len(src) > 0 {
+		var line []byte
+		if pos := bytes.IndexByte(src, '\n'); pos >= 0 {
+			line, src = src[:pos], src[pos+1:]
+		} else {
+			line, src = src, nil
+		}
+		if len(line) < 2 || line[0] != '#' {
+			continue
+		}
+		directive := strings.TrimLeft(string(line[1:]), " \t")
+		switch {
+		case strings.HasPrefix(directive, "define "):
+			def := strings.TrimLeft(directive[7:], " \t")
+			pos := strings.IndexFunc(def, func(c rune) bool { return !isIdentChar(c) })
+			if pos < 0 {
+				pos = len(def)
+			}
+			m := &macroDef{name: def[:pos], file: file}
+			if def = def[pos:]; def != "" && def[0] == '(' { // function-like macro
+				end := strings.IndexByte(def, ')')
+				if end < 0 {
+					continue
+				}
+				if params := strings.TrimSpace(def[1:end]); params != "" {
+					m.params = strings.Split(params, ",")
+					for i, param := range m.params {
+						m.params[i] = strings.TrimSpace(param)
+					}
+				}
+				m.funcLike, def = true, def[end+1:]
+			}
+			m.body = strings.TrimSpace(def)
+			name := m.name
+			defs[name] = m
+			macros = append(macros, m)
+		case strings.HasPrefix(directive, "undef "):
+			delete(defs, strings.TrimSpace(directive[6:]))
+		default:
+			if ms := parseLineMarkers(line); len(ms) == 1 {
+				file = ms[0].file
+			}
+		}
+	}
+	n := 0
+	for _, m := range macros {
+		if defs[m.name] == m {
+			macros[n] = m
+			n++
+		}
+	}
+	return macros[:n], defs
+}
+
+func isIdentChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// compileMacros compiles public object-like macros which expand to constants
+// into Go consts. A macro is public if its name is in ctx.public or it is
+// defined in a header file of pubFrom (should be absolute paths).
+func compileMacros(ctx *blockCtx, src []byte, pubFrom []string) {
+	macros, defs := parseMacros(src)
+	e := &macroEval{ctx: ctx, defs: defs, vals: make(map[string]*macroVal)}
+	scope := ctx.pkg.Types.Scope()
+	var cdecl *gogen.ConstDefs
+	var public map[string]string // copy of ctx.public, which is Config.Public
+	for _, m := range macros {
+		if m.funcLike || ctx.isIgnored(m.name) {
+			continue
+		}
+		if _, ok := ctx.public[m.name]; !ok {
+			if m.file == "" || !isPublicFrom(pathutil.Canonical(ctx.srcdir, m.file), pubFrom) {
+				continue
+			}
+			if public == nil {
+				public = make(map[string]string, len(ctx.public)+1)
+				for name, goName := range ctx.public {
+					public[name] = goName
+				}
+				ctx.public = public
+			}
+			public[m.name] = ""
+		}
+		goName := m.name
+		ctx.getPubName(&goName)
+		if scope.Lookup(goName) != nil || scope.Lookup(m.name) != nil { // defined by a C decl or another translation unit
+			continue
+		}
+		v := e.eval(m.name)
+		if v == nil {
+			if debugCompileDecl {
+				log.Println("==> skip macro", m.name, m.body)
+			}
+			continue
+		}
+		if cdecl == nil {
+			if ctx.hasMulti {
+				ctx.pkg.SetCurFile(headerGoFile, true)
+			}
+			cdecl = ctx.pkg.NewConstDefs(scope)
+		}
+		if debugCompileDecl {
+			log.Println("macro", m.name, "=>", goName, v.val, v.typ)
+		}
+		cdecl.New(func(cb *gogen.CodeBuilder) int {
+			v.push(cb)
+			return 1
+		}, 0, token.NoPos, v.typ, goName)
+	}
+}
+
+// FuncMacro represents a function-like macro.
+type FuncMacro struct {
+	Name   string
+	Params []string // the last one is "..." if this macro is variadic
+	Body   string
+	File   string // header file where this macro is defined
+}
+
+// FuncMacros returns function-like macros which are defined in header files
+// of pubFrom (should be absolute paths). src is content of a macro file (see
+// Config.MacroFile) and relative file names in it are related to srcDir.
+func FuncMacros(src []byte, srcDir string, pubFrom []string) (ret []*FuncMacro) {
+	macros, _ := parseMacros(src)
+	for _, m := range macros {
+		if m.funcLike && m.file != "" {
+			if file := pathutil.Canonical(srcDir, m.file); isPublicFrom(file, pubFrom) {
+				ret = append(ret, &FuncMacro{Name: m.name, Params: m.params, Body: m.body, File: file})
+			}
+		}
+	}
+	return
+}
+
+func loadMacros(ctx *blockCtx, conf *Config) {
+	src := conf.Macros
+	if src == nil {
+		b, err := os.ReadFile(conf.MacroFile)
+		if err != nil {
+			ctx.errorf(nil, "loadMacros: %v", err)
+			return
+		}
+		src = b
+	}
+	compileMacros(ctx, src, ctx.pubFrom)
+}
+
+// -----------------------------------------------------------------------------
+
+// macroVal represents value of a macro which expands to a constant expression.
+type macroVal struct {
+	val  constant.Value
+	typ  types.Type // nil means untyped
+	lit  string     // Go literal if the macro is a single literal
+	char bool       // is a character constant
+}
+
+func (v *macroVal) push(cb *gogen.CodeBuilder) {
+	switch v.val.Kind() {
+	case constant.String:
+		cb.Val(constant.StringVal(v.val))
+		return
+	case constant.Int:
+		if v.char {
+			if r, ok := constant.Int64Val(v.val); ok && r >= 0 && r <= math.MaxInt32 {
+				cb.Val(rune(r))
+				return
+			}
+		}
+		lit := v.lit
+		if lit == "" {
+			lit = constant.BinaryOp(v.val, token.MUL, constant.MakeInt64(int64(constant.Sign(v.val)))).ExactString()
+		}
+		cb.Val(&goast.BasicLit{Kind: token.INT, Value: lit})
+	default:
+		lit := v.lit
+		if lit == "" {
+			f, _ := constant.Float64Val(v.val)
+			if lit = strconv.FormatFloat(math.Abs(f), 'g', -1, 64); !strings.ContainsAny(lit, ".e") {
+				lit += ".0"
+			}
+		}
+		cb.Val(&goast.BasicLit{Kind: token.FLOAT, Value: lit})
+	}
+	if v.lit == "" && constant.Sign(v.val) < 0 {
+		cb.UnaryOp(token.SUB)
+	}
+}
+
+type macroEval struct {
+	ctx  *blockCtx
+	defs map[string]*macroDef
+	vals map[string]*macroVal // nil value means this macro isn't a constant
+}
+
+func (p *macroEval) eval(name string) *macroVal {
+	if v, ok := p.vals[name]; ok {
+		return v
+	}
+	m, ok := p.defs[name]
+	if !ok || m.funcLike {
+		return nil
+	}
+	p.vals[name] = nil // avoid infinite recursion
+	toks, ok := tokenizeMacro(m.body)
+	if !ok || len(toks) == 0 {
+		return nil
+	}
+	e := &macroExpr{eval: p, toks: toks}
+	v := e.parseCond()
+	if v == nil || e.pos != len(toks) {
+		return nil
+	}
+	if len(toks) == 1 && toks[0].kind == tokNumber {
+		if lit, ok := goLiteral(toks[0].text, v.val); ok {
+			v.lit = lit
+		}
+	}
+	p.vals[name] = v
+	return v
+}
+
+// goLiteral converts a C number literal to a Go literal (removing suffixes)
+// if the literal still represents val.
+func goLiteral(lit string, val constant.Value) (string, bool) {
+	if strings.Contains(lit, "'") {
+		return "", false
+	}
+	kind := token.INT
+	isHex := strings.HasPrefix(lit, "0x") || strings.HasPrefix(lit, "0X")
+	if strings.ContainsAny(lit, ".pP") || !isHex && strings.ContainsAny(lit, "eE") {
+		kind, lit = token.FLOAT, strings.TrimRight(lit, "fFlL")
+	} else {
+		lit = strings.TrimRight(lit, "uUlL")
+	}
+	if v := constant.MakeFromLiteral(lit, kind, 0); v.Kind() == constant.Unknown || !constant.Compare(v, token.EQL, val) {
+		return "", false
+	}
+	return lit, true
+}
+
+// -----------------------------------------------------------------------------
+
+const (
+	tokIdent = iota
+	tokNumber
+	tokChar
+	tokString
+	tokOp
+)
+
+type macroToken struct {
+	kind int
+	text string
+}
+
+func tokenizeMacro(s string) (toks []macroToken, ok bool) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case c == '"' || c == '\'' || (c == 'L' || c == 'u' || c == 'U') && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\''):
+			start := i
+			if c != '"' && c != '\'' {
+				i++
+			}
+			quote := s[i]
+			for i++; i < len(s) && s[i] != quote; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(s) {
+				return nil, false
+			}
+			i++
+			kind := tokString
+			if quote == '\'' {
+				kind = tokChar
+			}
+			toks = append(toks, macroToken{kind, s[start:i]})
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			start := i
+			for i++; i < len(s); i++ {
+				c := s[i]
+				if (c == '+' || c == '-') && strings.ContainsRune("eEpP", rune(s[i-1])) {
+					continue
+				}
+				if !isIdentChar(rune(c)) && c != '.' && c != '\'' {
+					break
+				}
+			}
+			toks = append(toks, macroToken{tokNumber, s[start:i]})
+		case isIdentChar(rune(c)):
+			start := i
+			for i++; i < len(s) && isIdentChar(rune(s[i])); i++ {
+			}
+			toks = append(toks, macroToken{tokIdent, s[start:i]})
+		default:
+			if i+1 < len(s) {
+				switch op := s[i : i+2]; op {
+				case "<<", ">>", "<=", ">=", "==", "!=", "&&", "||":
+					toks = append(toks, macroToken{tokOp, op})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("+-*/%<>&|^~!?:()", rune(c)) {
+				return nil, false
+			}
+			toks = append(toks, macroToken{tokOp, s[i : i+1]})
+			i++
+		}
+	}
+	return toks, true
+}
+
+// -----------------------------------------------------------------------------
+
+type macroExpr struct {
+	eval *macroEval
+	toks []macroToken
+	pos  int
+}
+
+func (p *macroExpr) peek() *macroToken {
+	if p.pos < len(p.toks) {
+		return &p.toks[p.pos]
+	}
+	return nil
+}
+
+func (p *macroExpr) gotOp(op string) bool {
+	if t := p.peek(); t != nil && t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *macroExpr) parseCond() *macroVal {
+	cond := p.parseBinary(1)
+	if cond == nil || !p.gotOp("?") {
+		return cond
+	}
+	x := p.parseCond()
+	if x == nil || !p.gotOp(":") {
+		return nil
+	}
+	y := p.parseCond()
+	if y == nil || !isNumberVal(cond) || !isNumberVal(x) || !isNumberVal(y) {
+		return nil
+	}
+	typ := p.eval.arithType(x.typ, y.typ)
+	if constant.Sign(cond.val) != 0 {
+		return p.eval.conv(x, typ)
+	}
+	return p.eval.conv(y, typ)
+}
+
+var binaryPrecs = map[string]int{
+	"||": 1, "&&": 2, "|": 3, "^": 4, "&": 5,
+	"==": 6, "!=": 6, "<": 7, ">": 7, "<=": 7, ">=": 7,
+	"<<": 8, ">>": 8, "+": 9, "-": 9, "*": 10, "/": 10, "%": 10,
+}
+
+func (p *macroExpr) parseBinary(prec int) *macroVal {
+	x := p.parseUnary()
+	for x != nil {
+		t := p.peek()
+		if t == nil || t.kind != tokOp {
+			break
+		}
+		opPrec, ok := binaryPrecs[t.text]
+		if !ok || opPrec < prec {
+			break
+		}
+		p.pos++
+		y := p.parseBinary(opPrec + 1)
+		if y == nil {
+			return nil
+		}
+		x = p.eval.binaryOp(x, t.text, y)
+	}
+	return x
+}
+
+func (p *macroExpr) parseUnary() *macroVal {
+	t := p.peek()
+	if t == nil {
+		return nil
+	}
+	if t.kind == tokOp {
+		switch t.text {
+		case "+", "-", "~", "!":
+			p.pos++
+			x := p.parseUnary()
+			if x == nil || !isNumberVal(x) {
+				return nil
+			}
+			return p.eval.unaryOp(t.text, x)
+		case "(":
+			p.pos++
+			if typ, ok := p.parseCastType(); ok {
+				x := p.parseUnary()
+				if x == nil || !isNumberVal(x) {
+					return nil
+				}
+				return p.eval.conv(x, typ)
+			}
+			x := p.parseCond()
+			if x == nil || !p.gotOp(")") {
+				return nil
+			}
+			return x
+		}
+		return nil
+	}
+	p.pos++
+	switch t.kind {
+	case tokNumber:
+		return p.eval.numberLit(t.text)
+	case tokChar:
+		return charLit(t.text)
+	case tokString:
+		s, ok := macroStringLit(t.text)
+		for ok {
+			next := p.peek()
+			if next == nil || next.kind != tokString {
+				break
+			}
+			p.pos++
+			var s2 string
+			s2, ok = macroStringLit(next.text)
+			s += s2
+		}
+		if !ok {
+			return nil
+		}
+		return &macroVal{val: constant.MakeString(s)}
+	}
+	return p.eval.eval(t.text)
+}
+
+var cTypeKeywords = map[string]bool{
+	"char": true, "short": true, "int": true, "long": true, "signed": true, "unsigned": true,
+	"float": true, "double": true, "_Bool": true, "const": true,
+}
+
+// parseCastType parses `type)` of a cast expression `(type)x`.
+func (p *macroExpr) parseCastType() (typ types.Type, ok bool) {
+	var names []string
+	scope := p.eval.ctx.pkg.Types.Scope()
+	for i := p.pos; i < len(p.toks); i++ {
+		t := p.toks[i]
+		if t.kind == tokOp && t.text == ")" {
+			if len(names) == 0 {
+				return
+			}
+			ctx := p.eval.ctx
+			conf := &parser.Config{Scope: scope, ParseEnv: ctx, Target: ctx.target, LongDouble: ctx.tyLDbl}
+			typ, _, err := parser.ParseType(strings.Join(names, " "), conf)
+			if err != nil {
+				return nil, false
+			}
+			if t, ok := typ.Underlying().(*types.Basic); !ok || t.Info()&types.IsNumeric == 0 {
+				return nil, false
+			}
+			p.pos = i + 1
+			return typ, true
+		}
+		if t.kind != tokIdent {
+			return
+		}
+		if !cTypeKeywords[t.text] {
+			if _, isType := scope.Lookup(t.text).(*types.TypeName); !isType {
+				return
+			}
+		}
+		names = append(names, t.text)
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+func isNumberVal(v *macroVal) bool {
+	return v.val.Kind() != constant.String
+}
+
+func isIntegerVal(v *macroVal) bool {
+	return v.val.Kind() == constant.Int
+}
+
+func (p *macroEval) numberLit(lit string) *macroVal {
+	ctx := p.ctx
+	lit = strings.ReplaceAll(lit, "'", "")
+	isHex := strings.HasPrefix(lit, "0x") || strings.HasPrefix(lit, "0X")
+	if strings.ContainsAny(lit, ".pP") || !isHex && strings.ContainsAny(lit, "eE") {
+		var typ types.Type
+		switch lit[len(lit)-1] {
+		case 'f', 'F':
+			lit, typ = lit[:len(lit)-1], types.Typ[types.Float32]
+		case 'l', 'L':
+			lit, typ = lit[:len(lit)-1], ctypes.LongDouble
+		}
+		val := constant.MakeFromLiteral(lit, token.FLOAT, 0)
+		if val.Kind() == constant.Unknown {
+			return nil
+		}
+		return p.conv(&macroVal{val: val}, typ)
+	}
+	end := len(lit)
+	for end > 0 && strings.ContainsRune("uUlL", rune(lit[end-1])) {
+		end--
+	}
+	suffix := strings.ToLower(lit[end:])
+	lit = lit[:end]
+	if len(lit) > 1 && lit[0] == '0' && lit[1] >= '0' && lit[1] <= '9' {
+		lit = "0o" + lit[1:]
+	}
+	val := constant.MakeFromLiteral(lit, token.INT, 0)
+	if val.Kind() == constant.Unknown {
+		return nil
+	}
+	var typ types.Type
+	switch suffix {
+	case "":
+	case "u":
+		typ = ctypes.Uint
+		if !p.fitsIn(val, typ) {
+			typ = ctx.ulong()
+		}
+	case "l":
+		typ = ctx.long()
+	case "ul", "lu":
+		typ = ctx.ulong()
+	case "ll":
+		typ = types.Typ[types.Int64]
+	case "ull", "llu":
+		typ = types.Typ[types.Uint64]
+	default:
+		return nil
+	}
+	return p.conv(&macroVal{val: val}, typ)
+}
+
+func charLit(lit string) *macroVal {
+	if lit[0] != '\'' { // L'x', u'x', U'x'
+		lit = lit[1:]
+	}
+	s := lit[1 : len(lit)-1]
+	if len(s) > 1 && s[0] == '\\' && s[1] >= '0' && s[1] <= '7' { // octal: \0, \12, ...
+		n, err := strconv.ParseUint(s[1:], 8, 32)
+		if err != nil {
+			return nil
+		}
+		return &macroVal{val: constant.MakeUint64(n), char: true}
+	}
+	r, _, tail, err := strconv.UnquoteChar(s, '\'')
+	if err != nil || tail != "" {
+		return nil
+	}
+	return &macroVal{val: constant.MakeInt64(int64(r)), char: true}
+}
+
+func macroStringLit(lit string) (string, bool) {
+	if lit[0] != '"' { // L"xxx", u8"xxx", ...
+		return "", false
+	}
+	s, err := strconv.Unquote(lit)
+	return s, err == nil
+}
+
+func (p *macroEval) fitsIn(val constant.Value, typ types.Type) bool {
+	return constant.Compare(p.wrapInt(val, typ), token.EQL, val)
+}
+
+// wrapInt converts an integer constant to an integer type like C does, with
+// sizes of the target.
+func (p *macroEval) wrapInt(val constant.Value, typ types.Type) constant.Value {
+	bits := uint(p.ctx.sizes.Sizeof(typ) * 8)
+	v, ok := new(big.Int).SetString(val.ExactString(), 10)
+	if !ok {
+		return val
+	}
+	mod := new(big.Int).Lsh(big.NewInt(1), bits)
+	v.Mod(v, mod)
+	if typ.Underlying().(*types.Basic).Info()&types.IsUnsigned == 0 && v.Bit(int(bits)-1) != 0 {
+		v.Sub(v, mod)
+	}
+	return constant.Make(v)
+}
+
+// conv converts v to typ (nil means untyped).
+func (p *macroEval) conv(v *macroVal, typ types.Type) *macroVal {
+	if typ == nil {
+		return v
+	}
+	t := typ.Underlying().(*types.Basic)
+	val := v.val
+	if t.Info()&types.IsInteger != 0 {
+		if val.Kind() == constant.Float {
+			f, _ := new(big.Float).SetString(val.ExactString())
+			if f == nil {
+				f, _ = new(big.Float).SetString(val.String())
+			}
+			if f == nil {
+				return nil
+			}
+			i, _ := f.Int(nil)
+			val = constant.Make(i)
+		}
+		val = p.wrapInt(val, typ)
+	} else {
+		val = constant.ToFloat(val)
+	}
+	return &macroVal{val: val, typ: typ}
+}
+
+// arithType returns type of a binary expression like C usual arithmetic
+// conversions does (nil means untyped).
+func (p *macroEval) arithType(x, y types.Type) types.Type {
+	if x == nil {
+		return y
+	} else if y == nil {
+		return x
+	}
+	tx, ty := x.Underlying().(*types.Basic), y.Underlying().(*types.Basic)
+	fx, fy := tx.Info()&types.IsFloat != 0, ty.Info()&types.IsFloat != 0
+	if fx != fy {
+		if fx {
+			return x
+		}
+		return y
+	}
+	sizes := p.ctx.sizes
+	sx, sy := sizes.Sizeof(x), sizes.Sizeof(y)
+	if sx < 4 && !fx {
+		x, sx = ctypes.Int, 4
+	}
+	if sy < 4 && !fy {
+		y, sy = ctypes.Int, 4
+	}
+	if sx != sy {
+		if sx > sy {
+			return x
+		}
+		return y
+	}
+	if ty.Info()&types.IsUnsigned != 0 {
+		return y
+	}
+	return x
+}
+
+func boolMacroVal(b bool) *macroVal {
+	if b {
+		return &macroVal{val: constant.MakeInt64(1)}
+	}
+	return &macroVal{val: constant.MakeInt64(0)}
+}
+
+func (p *macroEval) unaryOp(op string, x *macroVal) *macroVal {
+	switch op {
+	case "+":
+		return &macroVal{val: x.val, typ: x.typ}
+	case "-":
+		return p.conv(&macroVal{val: constant.UnaryOp(token.SUB, x.val, 0)}, p.arithType(x.typ, x.typ))
+	case "~":
+		if !isIntegerVal(x) {
+			return nil
+		}
+		return p.conv(&macroVal{val: constant.UnaryOp(token.XOR, x.val, 0)}, p.arithType(x.typ, x.typ))
+	default: // "!"
+		return boolMacroVal(constant.Sign(x.val) == 0)
+	}
+}
+
+var macroOps = map[string]token.Token{
+	"+": token.ADD, "-": token.SUB, "*": token.MUL, "/": token.QUO, "%": token.REM,
+	"&": token.AND, "|": token.OR, "^": token.XOR,
+	"==": token.EQL, "!=": token.NEQ, "<": token.LSS, ">": token.GTR, "<=": token.LEQ, ">=": token.GEQ,
+}
+
+func (p *macroEval) binaryOp(x *macroVal, op string, y *macroVal) *macroVal {
+	if !isNumberVal(x) || !isNumberVal(y) {
+		return nil
+	}
+	switch op {
+	case "&&":
+		return boolMacroVal(constant.Sign(x.val) != 0 && constant.Sign(y.val) != 0)
+	case "||":
+		return boolMacroVal(constant.Sign(x.val) != 0 || constant.Sign(y.val) != 0)
+	case "<<", ">>":
+		s, ok := constant.Uint64Val(y.val)
+		if !isIntegerVal(x) || !isIntegerVal(y) || !ok || s >= 64 {
+			return nil
+		}
+		tok := token.SHL
+		if op == ">>" {
+			tok = token.SHR
+		}
+		return p.conv(&macroVal{val: constant.Shift(x.val, tok, uint(s))}, x.typ)
+	}
+	typ := p.arithType(x.typ, y.typ)
+	if typ != nil {
+		if x = p.conv(x, typ); x == nil {
+			return nil
+		}
+		if y = p.conv(y, typ); y == nil {
+			return nil
+		}
+	}
+	tok := macroOps[op]
+	switch tok {
+	case token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ:
+		return boolMacroVal(constant.Compare(x.val, tok, y.val))
+	case token.QUO, token.REM:
+		if constant.Sign(y.val) == 0 {
+			return nil
+		}
+		if isIntegerVal(x) && isIntegerVal(y) {
+			if tok == token.QUO {
+				tok = token.QUO_ASSIGN // integer division
+			}
+		} else if tok == token.REM {
+			return nil
+		}
+	case token.AND, token.OR, token.XOR:
+		if !isIntegerVal(x) || !isIntegerVal(y) {
+			return nil
+		}
+	}
+	return p.conv(&macroVal{val: constant.BinaryOp(x.val, tok, y.val)}, typ)
+}
@@ -0,0 +1,114 @@
+package cl
+
+import (
+	"bytes"
+	"go/constant"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestMacros(t *testing.T) {
+	doc, src := parse(`int sqlite3_open(const char* name) { return 0; }
+`, nil)
+	macros := []byte(`# 1 "foo.c"
+# 1 "<built-in>" 1
+#define __STDC__ 1
+# 1 "<command line>" 1
+# 1 "foo.c" 2
+# 1 "/usr/include/sqlite3.h" 1
+#define SQLITE_OK 0
+#define SQLITE_IOERR 10
+#define SQLITE_IOERR_READ (SQLITE_IOERR | (1<<8))
+#define SQLITE_VERSION "3.40" ".0"
+#define SQLITE_MAX_U 0xffffffffU
+#define SQLITE_NEG (-1)
+#define SQLITE_MASK ((unsigned)-1 >> 4)
+#define SQLITE_PI 3.14f
+#define SQLITE_HALF (1.0/2)
+#define SQLITE_DIV (7/2)
+#define SQLITE_CH '\n'
+#define SQLITE_FN(x) (x)
+#define SQLITE_STATIC ((void*)0)
+#define SQLITE_UNDEF 1
+#undef SQLITE_UNDEF
+#define sqlite3_open 1
+# 2 "foo.c" 2
+#define PRIVATE 1
+#define MY_OK SQLITE_OK
+`)
+	public := map[string]string{"MY_OK": "MyOK"}
+	pkg, err := NewPackage("", "main", doc, &Config{
+		Src: src, Macros: macros, Reused: &Reused{},
+		Public:     public,
+		PublicFrom: []string{"/usr/include/sqlite3.h"},
+	})
+	check(err)
+	if len(public) != 1 {
+		t.Fatal("Config.Public is changed:", public)
+	}
+	var w bytes.Buffer
+	err = pkg.WriteTo(&w, headerGoFile)
+	check(err)
+	if out := w.String(); out != `package main
+
+const (
+	SQLITE_OK                 = 0
+	SQLITE_IOERR              = 10
+	SQLITE_IOERR_READ         = 266
+	SQLITE_VERSION            = "3.40.0"
+	SQLITE_MAX_U      uint32  = 0xffffffff
+	SQLITE_NEG                = -1
+	SQLITE_MASK       uint32  = 268435455
+	SQLITE_PI         float32 = 3.14
+	SQLITE_HALF               = 0.5
+	SQLITE_DIV                = 3
+	SQLITE_CH                 = '\n'
+	MyOK                      = 0
+)
+` {
+		t.Fatal("TestMacros:", out)
+	}
+}
+
+func TestFuncMacros(t *testing.T) {
+	macros := []byte(`# 1 "foo.c"
+# 1 "./foo.h" 1
+#define FOO_MIN(a, b) ((a) < (b) ? (a) : (b))
+#define FOO_ONE 1
+#define FOO_LOG(fmt,...) printf(fmt, __VA_ARGS__)
+#define FOO_NOARG() foo()
+#define FOO_UNDEF(x) (x)
+#undef FOO_UNDEF
+# 2 "foo.c" 2
+#define PRIVATE(x) (x)
+`)
+	ret := FuncMacros(macros, "/root", []string{"/root/foo.h"})
+	if len(ret) != 3 {
+		t.Fatal("FuncMacros:", len(ret))
+	}
+	if m := ret[0]; m.Name != "FOO_MIN" || strings.Join(m.Params, ",") != "a,b" ||
+		m.Body != "((a) < (b) ? (a) : (b))" || m.File != "/root/foo.h" {
+		t.Fatal("FuncMacros:", *m)
+	}
+	if m := ret[1]; m.Name != "FOO_LOG" || strings.Join(m.Params, ",") != "fmt,..." {
+		t.Fatal("FuncMacros:", *m)
+	}
+	if m := ret[2]; m.Name != "FOO_NOARG" || len(m.Params) != 0 || m.Body != "foo()" {
+		t.Fatal("FuncMacros:", *m)
+	}
+}
+
+func TestMacroSizes(t *testing.T) {
+	e := &macroEval{ctx: &blockCtx{sizes: types.SizesFor("gc", "386")}}
+	tyUintptr, tyInt64 := types.Typ[types.Uintptr], types.Typ[types.Int64]
+	if v := e.conv(&macroVal{val: constant.MakeInt64(-1)}, tyUintptr); v.val.ExactString() != "4294967295" {
+		t.Fatal("conv:", v.val)
+	}
+	if typ := e.arithType(tyUintptr, tyInt64); typ != tyInt64 {
+		t.Fatal("arithType:", typ)
+	}
+	if e.fitsIn(constant.MakeUint64(1<<32), tyUintptr) {
+		t.Fatal("fitsIn: 1<<32")
+	}
+}
@@ -1,6 +1,9 @@
 package cl
 
 import (
+	"bytes"
+	"go/format"
+	"go/token"
 	"testing"
 
 	"github.com/goplus/gogen"
@@ -25,3 +28,45 @@ func TestBaseOfFile(t *testing.T) {
 		t.Fatal("baseOfFile:", ret)
 	}
 }
+
+func TestSkipFuncBodies(t *testing.T) {
+	doc, src := parse(`
+int add(int a, int b) {
+	return a + b;
+}
+
+int first(int a) {
+	struct { int x; } v = {a};
+	return v.x;
+}
+
+int sub(int a, int b) {
+	struct { int y; } v = {a - b};
+	return v.y;
+}
+`, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, Reused: &Reused{}, SkipFuncBodies: true})
+	check(err)
+	var b bytes.Buffer
+	pkg.ForEachFile(func(fname string, _ *gogen.File) {
+		file := gogen.ASTFile(pkg.Package, fname)
+		for _, name := range []string{"add", "sub"} {
+			if fn := findFunc(file, name); fn != nil {
+				format.Node(&b, token.NewFileSet(), fn)
+				b.WriteByte('\n')
+			}
+		}
+	})
+	if ret := b.String(); ret != `func add(a int32, b int32) int32 {
+}
+func sub(a int32, b int32) int32 {
+	type _cgoa_2 struct {
+		y int32
+	}
+	var v _cgoa_2 = _cgoa_2{a - b}
+	return v.y
+}
+` {
+		t.Fatal("Result:", ret)
+	}
+}
@@ -116,7 +116,14 @@ func (p Package) WriteDepTo(dst io.Writer) error {
 
 func (p Package) WriteDepFile(file string) error {
 	p.InitDependencies()
-	return p.Package.WriteFile(file, depsFile)
+	if p.target == nil {
+		return p.Package.WriteFile(file, depsFile)
+	}
+	b, err := p.goFile(depsFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, b, 0666)
 }
 
 // -----------------------------------------------------------------------------
@@ -150,27 +157,36 @@ func loadPubFile(pubfile string) (pubs []pubName) {
 
 // baseDir should be absolute path
 func (p *blockCtx) initPublicFrom(baseDir string, conf *Config, node *ast.Node) {
-	pubFrom := conf.PublicFrom
-	if len(pubFrom) == 0 {
+	if len(conf.PublicFrom) == 0 {
 		return
 	}
-	for i, from := range pubFrom {
+	pubFrom := make([]string, len(conf.PublicFrom))
+	for i, from := range conf.PublicFrom {
 		pubFrom[i] = pathutil.Canonical(baseDir, from)
 	}
-	isPub := false
-	for _, decl := range node.Inner {
-		if f := decl.Loc.PresumedFile; f != "" {
-			isPub = isPublicFrom(filepath.Clean(f), pubFrom)
+	p.pubFrom = pubFrom
+	if node != nil {
+		for _, decl := range node.Inner {
+			p.markPublic(decl)
 		}
-		if isPub {
-			switch decl.Kind {
-			case ast.FunctionDecl, ast.TypedefDecl, ast.VarDecl:
-				p.autopub[decl.Name] = none{}
-			case ast.RecordDecl:
-				if decl.Name != "" {
-					suName := ctypes.MangledName(decl.TagUsed, decl.Name)
-					p.autopub[suName] = none{}
-				}
+	}
+}
+
+// markPublic marks decl as public if it is in a header file of PublicFrom.
+// Decls must be marked in order, because a decl without PresumedFile is in
+// the same file as the previous one.
+func (p *blockCtx) markPublic(decl *ast.Node) {
+	if f := decl.Loc.PresumedFile; f != "" {
+		p.inPub = isPublicFrom(filepath.Clean(f), p.pubFrom)
+	}
+	if p.inPub {
+		switch decl.Kind {
+		case ast.FunctionDecl, ast.TypedefDecl, ast.VarDecl:
+			p.autopub[decl.Name] = none{}
+		case ast.RecordDecl:
+			if decl.Name != "" {
+				suName := ctypes.MangledName(decl.TagUsed, decl.Name)
+				p.autopub[suName] = none{}
 			}
 		}
 	}
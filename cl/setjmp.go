@@ -0,0 +1,216 @@
+package cl
+
+import (
+	"go/token"
+	"go/types"
+
+	"github.com/goplus/gogen"
+
+	"github.com/goplus/c2go/clang/ast"
+	ctypes "github.com/goplus/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+// A function calling setjmp runs its body in a closure that recovers longjmp,
+// and runs it again from the statement of the setjmp call (see clang.JmpFrame).
+
+var setjmpFuncs = map[string]bool{
+	"setjmp": true, "_setjmp": true, "sigsetjmp": true, "__sigsetjmp": true,
+}
+
+var longjmpFuncs = map[string]bool{
+	"longjmp": true, "_longjmp": true, "siglongjmp": true,
+}
+
+type jmpCtx struct {
+	frame  types.Object
+	sites  map[*ast.Node]int          // setjmp call => site
+	labels map[*ast.Node]*gogen.Label // statement => label to resume at
+}
+
+// calleeName returns name of the function called by v, if it's a direct call.
+func calleeName(v *ast.Node) string {
+	if fn := v.Inner[0]; fn.Kind == ast.ImplicitCastExpr && len(fn.Inner) == 1 {
+		if ref := fn.Inner[0]; ref.Kind == ast.DeclRefExpr && ref.ReferencedDecl.Kind == ast.FunctionDecl {
+			return ref.ReferencedDecl.Name
+		}
+	}
+	return ""
+}
+
+// stmtParts splits stmt into the expressions it evaluates itself, and its sub
+// statements.
+func stmtParts(stmt *ast.Node) (exprs, stmts []*ast.Node) {
+	switch stmt.Kind {
+	case ast.CompoundStmt, ast.StmtExpr, ast.LabelStmt, ast.DefaultStmt:
+		return nil, stmt.Inner
+	case ast.IfStmt, ast.WhileStmt, ast.SwitchStmt:
+		return stmt.Inner[:1], stmt.Inner[1:]
+	case ast.ForStmt:
+		return stmt.Inner[:4], stmt.Inner[4:]
+	case ast.DoStmt:
+		return stmt.Inner[1:], stmt.Inner[:1]
+	case ast.CaseStmt:
+		n := len(stmt.Inner) - 1
+		return nil, stmt.Inner[n:]
+	}
+	return []*ast.Node{stmt}, nil
+}
+
+// setjmpsIn returns setjmp calls evaluated by stmt itself, not its sub statements.
+func setjmpsIn(stmt *ast.Node) (calls []*ast.Node) {
+	exprs, _ := stmtParts(stmt)
+	for _, expr := range exprs {
+		calls = appendSetjmps(calls, expr)
+	}
+	return
+}
+
+func appendSetjmps(calls []*ast.Node, v *ast.Node) []*ast.Node {
+	switch v.Kind {
+	case ast.StmtExpr: // not supported, see compileSetjmpCall
+		return calls
+	case ast.CallExpr:
+		if setjmpFuncs[calleeName(v)] {
+			calls = append(calls, v)
+		}
+	}
+	for _, item := range v.Inner {
+		calls = appendSetjmps(calls, item)
+	}
+	return calls
+}
+
+// setjmpStmts returns statements of body which call setjmp (see setjmpsIn).
+func setjmpStmts(body *ast.Node) (stmts []*ast.Node) {
+	var walk func(stmt *ast.Node)
+	walk = func(stmt *ast.Node) {
+		if setjmpsIn(stmt) != nil {
+			stmts = append(stmts, stmt)
+		}
+		_, subs := stmtParts(stmt)
+		for _, sub := range subs {
+			walk(sub)
+		}
+	}
+	walk(body)
+	return
+}
+
+// compileSetjmpBody compiles body of a function calling setjmp in stmts as
+//
+//	var _cgo_jf clang.JmpFrame
+//	for {
+//		_cgo_ret := func() T {
+//			defer _cgo_jf.Recover()
+//			switch _cgo_jf.Resume() {
+//			case 1:
+//				goto _cgol_1 // the statement of setjmp site 1
+//			...
+//			}
+//			body
+//		}()
+//		if !_cgo_jf.Resuming() {
+//			return _cgo_ret
+//		}
+//	}
+//
+// The body is a vblock, so its local variables are declared out of the closure
+// and keep their values when it runs again.
+func compileSetjmpBody(ctx *blockCtx, body *ast.Node, stmts []*ast.Node) {
+	pkg, cb := ctx.pkg, ctx.cb
+	pos := ctx.goNodePos(body)
+	clang := pkg.Import(clangPkgPath)
+	cb.NewVar(clang.Ref("JmpFrame").Type(), "_cgo_jf")
+	frame := cb.Scope().Lookup("_cgo_jf")
+	results := cb.Func().Type().(*types.Signature).Results()
+
+	cb.For().None().Then()
+	if results.Len() > 0 {
+		cb.DefineVarStart(pos, "_cgo_ret")
+	}
+	cb.NewClosure(nil, results, false).BodyStart(pkg)
+	cb.Val(frame).MemberVal("Recover").Call(0).Defer()
+	jmp := &jmpCtx{
+		frame:  frame,
+		sites:  make(map[*ast.Node]int),
+		labels: make(map[*ast.Node]*gogen.Label),
+	}
+	cb.Switch().Val(frame).MemberVal("Resume").Call(0).Then()
+	for _, stmt := range stmts {
+		calls := setjmpsIn(stmt)
+		switch stmt.Kind {
+		case ast.DoStmt:
+			ctx.panicf(calls[0], "setjmp in condition of do statement is not supported")
+		case ast.ForStmt:
+			if len(calls) > len(appendSetjmps(nil, stmt.Inner[0])) {
+				ctx.panicf(stmt, "setjmp in condition of for statement is not supported")
+			}
+		}
+		l := ctx.curfn.newLabel(cb)
+		jmp.labels[stmt] = l
+		cb.Case()
+		for _, call := range calls {
+			site := len(jmp.sites) + 1
+			jmp.sites[call] = site
+			cb.Val(site)
+		}
+		cb.Then().Goto(l).End()
+	}
+	cb.End()
+	ctx.curfn.jmp = jmp
+
+	cb.VBlock()
+	compileSub(ctx, body)
+	cb.End()
+	checkNeedReturn(ctx, body)
+	cb.End()
+
+	n := results.Len()
+	if n > 0 {
+		cb.Call(0).EndInit(1)
+	} else {
+		cb.Call(0).EndStmt()
+	}
+	ret := cb.Scope().Lookup("_cgo_ret")
+	cb.If().Val(frame).MemberVal("Resuming").Call(0).UnaryOp(token.NOT).Then()
+	if n > 0 {
+		cb.Val(ret)
+	}
+	cb.Return(n).End()
+	cb.End() // for
+}
+
+// compileSetjmpCall compiles setjmp(env) of site as _cgo_jf.Setjmp(env, site),
+// and longjmp(env, val) as clang.Longjmp(env, val). It reports whether v calls
+// one of them. The savemask argument of sigsetjmp is ignored.
+func compileSetjmpCall(ctx *blockCtx, v *ast.Node) bool {
+	name := calleeName(v)
+	isLongjmp := longjmpFuncs[name]
+	if !isLongjmp && !setjmpFuncs[name] {
+		return false
+	}
+	cb := ctx.cb
+	if isLongjmp {
+		cb.Val(ctx.pkg.Import(clangPkgPath).Ref("Longjmp"))
+	} else {
+		jmp := ctx.curfn.jmp
+		if jmp == nil || jmp.sites[v] == 0 {
+			ctx.panicf(v, "setjmp in statement expression is not supported")
+		}
+		cb.Val(jmp.frame).MemberVal("Setjmp")
+	}
+	compileExpr(ctx, v.Inner[1])
+	typeCast(ctx, ctypes.UnsafePointer, cb.Get(-1))
+	if isLongjmp {
+		compileExpr(ctx, v.Inner[2])
+		typeCast(ctx, ctypes.Int, cb.Get(-1))
+	} else {
+		cb.Val(ctx.curfn.jmp.sites[v])
+	}
+	cb.CallWith(2, 0, ctx.goNode(v))
+	return true
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,251 @@
+package cl
+
+import (
+	goast "go/ast"
+	"go/token"
+	"go/types"
+	"log"
+	"strconv"
+
+	"github.com/goplus/gogen"
+
+	"github.com/goplus/c2go/clang"
+	"github.com/goplus/c2go/clang/ast"
+	ctypes "github.com/goplus/c2go/clang/types"
+)
+
+// -----------------------------------------------------------------------------
+
+// Soft numbers are C numeric types which have no Go counterparts, so they are
+// implemented in software by runtime types of the clang package:
+//
+//	__int128, unsigned __int128: clang.Int128, clang.Uint128 (see int128.go)
+//	long double (see LDMode):    clang.Float80, clang.Float128
+//
+// Operators on them are lowered to method calls, such as x.Add(y).
+
+func softNumName(typ types.Type) string {
+	if t, ok := typ.(*types.Named); ok {
+		o := t.Obj()
+		if pkg := o.Pkg(); pkg != nil && pkg.Path() == clangPkgPath {
+			switch name := o.Name(); name {
+			case "Int128", "Uint128", "Float80", "Float128":
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// isSoftNum checks if typ is a runtime type of a soft number.
+func isSoftNum(typ types.Type) bool {
+	return softNumName(typ) != ""
+}
+
+// isSoftFloat checks if typ is clang.Float80 or clang.Float128, the runtime
+// types of long double in software (see LDMode).
+func isSoftFloat(typ types.Type) bool {
+	name := softNumName(typ)
+	return name == "Float80" || name == "Float128"
+}
+
+// isSoftNumExpr checks if expr is a soft number. Such lvalues are updated by
+// assignment instead of op= or ++/--, so they are referenced by address to be
+// evaluated only once (see compileAssignOpExpr).
+func isSoftNumExpr(ctx *blockCtx, expr *ast.Node) bool {
+	return isSoftNum(toType(ctx, expr.Type, 0))
+}
+
+// softCast pushes v converted to typ, where typ or type of v is a soft number.
+func softCast(ctx *blockCtx, typ types.Type, v *gogen.Element) {
+	cb := ctx.cb
+	vt := v.Type
+	if ctypes.Identical(vt, typ) {
+		cb.Val(v)
+		return
+	}
+	if !isSoftNum(typ) { // soft number => typ
+		if !isSoftNum(vt) {
+			log.Panicln("softCast: unexpected -", vt, "=>", typ)
+		}
+		var method string
+		switch {
+		case isBool(typ):
+			cb.Val(v)
+			castToBoolExpr(cb)
+			return
+		case isFloat(typ):
+			method = "Float64"
+		case isInt128(vt) || isUnsigned(typ): // __int128 is truncated to low bits
+			method = "Uint64"
+		case isInteger(typ):
+			method = "Int64"
+		default:
+			ctx.panicf(nil, "cast %v to %v is not supported", vt, typ)
+		}
+		if method == "Uint64" && typ == types.Typ[types.Uint64] {
+			cb.Val(v).MemberVal(method).Call(0)
+		} else {
+			cb.Typ(typ).Val(v).MemberVal(method).Call(0).Call(1)
+		}
+		return
+	}
+	o := typ.(*types.Named).Obj()
+	c := gogen.PkgRef{Types: o.Pkg()}
+	if isSoftNum(vt) {
+		switch {
+		case isInt128(typ): // Int128 <=> Uint128, long double => __int128
+			cb.Val(v).MemberVal(o.Name()).Call(0)
+		case isInt128(vt): // __int128 => long double
+			cb.Val(c.Ref(o.Name() + "From" + softNumName(vt))).Val(v).Call(1)
+		default: // Float80 <=> Float128: only one of them is used
+			ctx.panicf(nil, "cast %v to %v is not supported", vt, typ)
+		}
+		return
+	}
+	from, fn := types.Typ[types.Int64], "FromInt64"
+	switch {
+	case isFloat(vt):
+		from, fn = types.Typ[types.Float64], "FromFloat64"
+	case isUnsigned(vt):
+		from, fn = types.Typ[types.Uint64], "FromUint64"
+	case isBool(vt):
+		if ret, ok := gogen.CastFromBool(cb, from, v); ok {
+			v = ret
+		}
+	case !isInteger(vt):
+		ctx.panicf(nil, "cast %v to %v is not supported", vt, typ)
+	}
+	cb.Val(c.Ref(o.Name() + fn))
+	if isUntyped(vt) || ctypes.Identical(vt, from) {
+		cb.Val(v)
+	} else {
+		cb.Typ(from).Val(v).Call(1)
+	}
+	cb.Call(1)
+}
+
+// softBinaryOp lowers `x op y` of soft numbers, such as int128BinaryOp.
+type softBinaryOp = func(ctx *blockCtx, op token.Token, src goast.Node)
+
+// softIncDec lowers x++ and x-- where x is a soft number to x = x.Add(1) and
+// x = x.Sub(1). The top of stack is reference of x.
+func softIncDec(ctx *blockCtx, op token.Token, binaryOp softBinaryOp) {
+	cb := ctx.cb
+	ref := cb.Get(-1)
+	typ, _ := gogen.DerefType(ref.Type)
+	cb.Val(&gogen.Element{Val: ref.Val, Type: typ})
+	softCast(ctx, typ, cb.Val(1).InternalStack().Pop())
+	if op == token.INC {
+		binaryOp(ctx, token.ADD, nil)
+	} else {
+		binaryOp(ctx, token.SUB, nil)
+	}
+	cb.Assign(1)
+}
+
+// softAssignOp lowers `x op= y` where x is a soft number to x = x.Op(y). The
+// top two elements of stack are reference of x and y.
+func softAssignOp(ctx *blockCtx, op token.Token, src goast.Node, binaryOp softBinaryOp) {
+	cb := ctx.cb
+	stk := cb.InternalStack()
+	y := stk.Pop()
+	ref := stk.Get(-1)
+	typ, _ := gogen.DerefType(ref.Type)
+	cb.Val(&gogen.Element{Val: ref.Val, Type: typ})
+	op -= token.ADD_ASSIGN - token.ADD
+	if isShiftOpertor(op) {
+		stk.Push(y)
+	} else {
+		softCast(ctx, typ, y)
+	}
+	binaryOp(ctx, op, src)
+	cb.AssignWith(1, 1, src)
+}
+
+// -----------------------------------------------------------------------------
+
+var (
+	softFloatOps = map[token.Token]string{
+		token.ADD: "Add",
+		token.SUB: "Sub",
+		token.MUL: "Mul",
+		token.QUO: "Quo",
+	}
+	softFloatCmpOps = map[token.Token]string{
+		token.EQL: "Eq",
+		token.NEQ: "Ne",
+		token.LSS: "Lt",
+		token.LEQ: "Le",
+		token.GTR: "Gt",
+		token.GEQ: "Ge",
+	}
+)
+
+// softFloatBinaryOp lowers `x op y` where x or y is a long double to a method
+// call, such as x.Add(y). Comparisons are lowered to x.Lt(y), etc. rather than
+// a Cmp method, since NaN isn't ordered.
+func softFloatBinaryOp(ctx *blockCtx, op token.Token, src goast.Node) {
+	cb := ctx.cb
+	stk := cb.InternalStack()
+	x, y := stk.Get(-2), stk.Get(-1)
+	stk.PopN(2)
+	if typ := x.Type; !isSoftFloat(typ) {
+		softCast(ctx, y.Type, x)
+		x = stk.Pop()
+	} else if !ctypes.Identical(typ, y.Type) {
+		softCast(ctx, typ, y)
+		y = stk.Pop()
+	}
+	cb.Val(x)
+	if isCmpOperator(op) {
+		cb.MemberVal(softFloatCmpOps[op]).Val(y).Call(1)
+		return
+	}
+	name, ok := softFloatOps[op]
+	if !ok {
+		log.Panicln("softFloatBinaryOp: unexpected operator -", op)
+	}
+	cb.MemberVal(name).Val(y).Call(1)
+}
+
+// softFloatUnaryOp lowers -x and !x where x is a long double.
+func softFloatUnaryOp(ctx *blockCtx, op token.Token) {
+	cb := ctx.cb
+	switch op {
+	case token.SUB:
+		cb.MemberVal("Neg").Call(0)
+	case token.NOT:
+		cb.MemberVal("IsZero").Call(0)
+	default:
+		log.Panicln("softFloatUnaryOp: unexpected operator -", op)
+	}
+}
+
+// softFloatLit pushes a long double literal, which is rounded from lit (a
+// decimal float of clang) directly rather than via float64.
+func softFloatLit(ctx *blockCtx, typ types.Type, lit string, src goast.Node) {
+	var lo, hi uint64
+	var err error
+	switch softNumName(typ) {
+	case "Float80":
+		var v clang.Float80
+		v, err = clang.ParseFloat80(lit)
+		lo, hi = v.Lo, uint64(v.Hi)
+	case "Float128":
+		var v clang.Float128
+		v, err = clang.ParseFloat128(lit)
+		lo, hi = v.Lo, v.Hi
+	default:
+		log.Panicln("softFloatLit: unexpected -", typ)
+	}
+	if err != nil {
+		log.Panicln("softFloatLit:", err)
+	}
+	cb := ctx.cb
+	cb.Val(&goast.BasicLit{Kind: token.INT, Value: "0x" + strconv.FormatUint(lo, 16)})
+	cb.Val(&goast.BasicLit{Kind: token.INT, Value: "0x" + strconv.FormatUint(hi, 16)})
+	cb.StructLit(typ, 2, false, src)
+}
+
+// -----------------------------------------------------------------------------
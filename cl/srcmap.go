@@ -0,0 +1,229 @@
+package cl
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	goast "go/ast"
+
+	"github.com/goplus/c2go/clang/ast"
+	"github.com/goplus/c2go/clang/pathutil"
+)
+
+// -----------------------------------------------------------------------------
+
+// CPos represents a position in C source.
+type CPos struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Col  int    `json:"col,omitempty"`
+}
+
+// DeclMapping records the C declaration which a Go declaration comes from.
+type DeclMapping struct {
+	Name  string   `json:"name"`  // Go name
+	Start int      `json:"start"` // first Go line of this declaration
+	End   int      `json:"end"`   // last Go line of this declaration
+	CName string   `json:"cname"` // C name
+	CKind ast.Kind `json:"ckind"` // kind of the C declaration, eg. FunctionDecl
+	CPos
+}
+
+// LineMapping maps Go lines [Start, End] to a C position.
+type LineMapping struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+	CPos
+}
+
+// SourceMap represents content of a source map file of a generated Go file.
+type SourceMap struct {
+	File  string         `json:"file"` // Go file name (without directory)
+	Decls []*DeclMapping `json:"decls"`
+	Lines []*LineMapping `json:"lines"`
+}
+
+// SourceMapFile returns name of the source map file of a generated Go file.
+func SourceMapFile(gofile string) string {
+	return strings.TrimSuffix(gofile, ".go") + ".map.json"
+}
+
+// -----------------------------------------------------------------------------
+
+type cDecl struct {
+	name string
+	kind ast.Kind
+	pos  CPos
+}
+
+type srcMap struct {
+	decls   map[string]*cDecl // Go name => C decl
+	lineDir bool              // keep //line directives in Go files
+}
+
+func newSrcMap(lineDir bool) *srcMap {
+	return &srcMap{decls: make(map[string]*cDecl), lineDir: lineDir}
+}
+
+// recordDecl records that Go declaration goName comes from C declaration decl.
+func (p *blockCtx) recordDecl(goName, cName string, decl *ast.Node) {
+	if sm := p.srcmap; sm != nil {
+		if _, ok := sm.decls[goName]; !ok {
+			sm.decls[goName] = &cDecl{name: cName, kind: decl.Kind, pos: p.cPos(p.position(decl))}
+		}
+	}
+}
+
+func (p *blockCtx) cPos(pos token.Position) CPos {
+	return CPos{File: pathutil.Canonical(p.srcdir, pos.Filename), Line: pos.Line, Col: pos.Column}
+}
+
+// WriteFile writes a Go file named fname (the default file if fname is not
+// provided). If conf.SourceMap is set, it also writes a source map file
+// (see SourceMapFile) next to the Go file.
+func (p Package) WriteFile(file string, fname ...string) error {
+	sm := p.srcmap
+	if sm == nil && p.target == nil && !p.lineDir {
+		return p.Package.WriteFile(file, fname...)
+	}
+	b, err := p.goFile(fname...)
+	if err != nil {
+		return err
+	}
+	if p.lineDir {
+		b = fixLineDirectives(b, filepath.Base(file))
+	}
+	if sm == nil {
+		return os.WriteFile(file, b, 0666)
+	}
+	code, ret, err := sm.build(b, filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(file, code, 0666); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ret, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(SourceMapFile(file), data, 0666)
+}
+
+func (p *srcMap) build(src []byte, file string) (code []byte, ret *SourceMap, err error) {
+	const prefix = "//line "
+	var b bytes.Buffer
+	var lines []*LineMapping
+	var goLine int
+	for len(src) > 0 {
+		var line []byte
+		if pos := bytes.IndexByte(src, '\n'); pos >= 0 {
+			line, src = src[:pos+1], src[pos+1:]
+		} else {
+			line, src = src, nil
+		}
+		if bytes.HasPrefix(line, []byte(prefix)) {
+			if pos, ok := parseLineDirective(string(bytes.TrimSpace(line[len(prefix):]))); ok {
+				if p.lineDir {
+					b.WriteString(prefix + pos.File + ":" + strconv.Itoa(pos.Line) + "\n")
+					goLine++
+				}
+				if pos.File != file { // not back to the Go file, see fixLineDirectives
+					lines = append(lines, &LineMapping{Start: goLine + 1, CPos: pos})
+				}
+				continue
+			}
+		}
+		b.Write(line)
+		goLine++
+	}
+	code = b.Bytes()
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, code, parser.SkipObjectResolution)
+	if err != nil {
+		return
+	}
+	ret = &SourceMap{File: file, Decls: []*DeclMapping{}, Lines: []*LineMapping{}}
+	var funcs [][2]int
+	addDecl := func(name string, start, end token.Pos) {
+		if d, ok := p.decls[name]; ok {
+			ret.Decls = append(ret.Decls, &DeclMapping{
+				Name: name, Start: goLineOf(fset, start), End: goLineOf(fset, end),
+				CName: d.name, CKind: d.kind, CPos: d.pos,
+			})
+		}
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *goast.FuncDecl:
+			addDecl(d.Name.Name, d.Pos(), d.End())
+			funcs = append(funcs, [2]int{goLineOf(fset, d.Pos()), goLineOf(fset, d.End())})
+		case *goast.GenDecl:
+			for _, spec := range d.Specs {
+				start, end := spec.Pos(), spec.End()
+				if !d.Lparen.IsValid() {
+					start, end = d.Pos(), d.End()
+				}
+				switch s := spec.(type) {
+				case *goast.TypeSpec:
+					addDecl(s.Name.Name, start, end)
+				case *goast.ValueSpec:
+					for _, name := range s.Names {
+						addDecl(name.Name, start, end)
+					}
+				}
+			}
+		}
+	}
+
+	// a line mapping ends before the next one or at the end of its function
+	for i, l := range lines {
+		l.End = goLine
+		if i+1 < len(lines) {
+			if l.End = lines[i+1].Start - 1; p.lineDir {
+				l.End--
+			}
+		}
+		for _, fn := range funcs {
+			if l.Start >= fn[0] && l.Start <= fn[1] && l.End > fn[1] {
+				l.End = fn[1]
+			}
+		}
+		if l.End >= l.Start {
+			ret.Lines = append(ret.Lines, l)
+		}
+	}
+	return
+}
+
+// goLineOf returns line of pos in the Go file, ignoring //line directives.
+func goLineOf(fset *token.FileSet, pos token.Pos) int {
+	return fset.PositionFor(pos, false).Line
+}
+
+// parseLineDirective parses `file:line[:col]`.
+func parseLineDirective(s string) (pos CPos, ok bool) {
+	pos.File = s
+	for i := 0; i < 2; i++ {
+		colon := strings.LastIndexByte(pos.File, ':')
+		if colon < 0 {
+			break
+		}
+		n, err := strconv.Atoi(pos.File[colon+1:])
+		if err != nil {
+			break
+		}
+		pos.File, pos.Col, pos.Line = pos.File[:colon], pos.Line, n
+		ok = true
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
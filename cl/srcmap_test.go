@@ -0,0 +1,65 @@
+package cl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	doc, src := parse(`#line 1 "foo.c"
+struct point {
+    int x, y;
+};
+
+static int add(int a, int b) {
+    int c = a + b;
+    return c;
+}
+`, nil)
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, SourceMap: true})
+	check(err)
+
+	gofile := filepath.Join(t.TempDir(), "foo.c.i.go")
+	err = pkg.WriteFile(gofile)
+	check(err)
+	code, err := os.ReadFile(gofile)
+	check(err)
+	if strings.Contains(string(code), "//line") {
+		t.Fatal("unexpected //line directives:\n", string(code))
+	}
+	b, err := os.ReadFile(SourceMapFile(gofile))
+	check(err)
+	var sm SourceMap
+	err = json.Unmarshal(b, &sm)
+	check(err)
+	if sm.File != "foo.c.i.go" || len(sm.Decls) != 2 {
+		t.Fatal("SourceMap:", string(b))
+	}
+	lines := strings.Split(string(code), "\n")
+	for _, d := range sm.Decls {
+		switch d.CName {
+		case "point":
+			if d.Name != "struct_point" || d.Line != 1 || d.CKind != "RecordDecl" {
+				t.Fatal("struct point:", *d)
+			}
+		case "add":
+			if !strings.HasPrefix(d.Name, "_cgos_add") || d.Line != 5 || d.Col != 12 {
+				t.Fatal("func add:", *d)
+			}
+			if !strings.HasPrefix(lines[d.Start-1], "func "+d.Name) || lines[d.End-1] != "}" {
+				t.Fatal("func add: Go lines", d.Start, d.End)
+			}
+		default:
+			t.Fatal("unexpected decl:", *d)
+		}
+	}
+	if len(sm.Lines) != 3 {
+		t.Fatal("SourceMap lines:", string(b))
+	}
+	if l := sm.Lines[1]; l.Line != 6 || l.Col != 5 || !strings.Contains(lines[l.Start-1], "var c int32") {
+		t.Fatal("SourceMap line:", *l)
+	}
+}
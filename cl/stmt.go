@@ -5,6 +5,8 @@ import (
 	"go/types"
 	"log"
 
+	ctypes "github.com/goplus/c2go/clang/types"
+
 	"github.com/goplus/c2go/clang/ast"
 	"github.com/goplus/gogen"
 )
@@ -12,6 +14,12 @@ import (
 // -----------------------------------------------------------------------------
 
 func compileStmt(ctx *blockCtx, stmt *ast.Node) {
+	if jmp := ctx.curfn.jmp; jmp != nil {
+		if l, ok := jmp.labels[stmt]; ok { // longjmp resumes here
+			ctx.cb.Label(l)
+		}
+	}
+	ctx.curnode = stmt
 	switch stmt.Kind {
 	case ast.IfStmt:
 		compileIfStmt(ctx, stmt)
@@ -26,15 +34,24 @@ func compileStmt(ctx *blockCtx, stmt *ast.Node) {
 	case ast.ReturnStmt:
 		compileReturnStmt(ctx, stmt)
 	case ast.BreakStmt:
+		ctx.setLineDirective(stmt)
 		compileBreakStmt(ctx, stmt)
 	case ast.ContinueStmt:
+		ctx.setLineDirective(stmt)
 		compileContinueStmt(ctx, stmt)
 	case ast.DeclStmt:
+		ctx.setLineDirective(stmt)
 		compileDeclStmt(ctx, stmt, false)
 	case ast.CompoundStmt:
 		compileCompoundStmt(ctx, stmt)
+	case ast.StmtExpr: // its value is unused, so it's just a block
+		compileCompoundStmt(ctx, stmt.Inner[0])
 	case ast.GotoStmt:
+		ctx.setLineDirective(stmt)
 		compileGotoStmt(ctx, stmt)
+	case ast.IndirectGotoStmt:
+		ctx.setLineDirective(stmt)
+		compileIndirectGotoStmt(ctx, stmt)
 	case ast.LabelStmt:
 		compileLabelStmt(ctx, stmt)
 	case ast.CaseStmt, ast.DefaultStmt:
@@ -43,6 +60,7 @@ func compileStmt(ctx *blockCtx, stmt *ast.Node) {
 	case ast.GCCAsmStmt:
 		// TODO: skip asm
 	default:
+		ctx.setLineDirective(stmt)
 		compileExprEx(ctx, stmt, "compileStmt: unknown kind =", flagIgnoreResult)
 		ctx.cb.EndStmt()
 	}
@@ -78,8 +96,9 @@ func compileDoStmt(ctx *blockCtx, stmt *ast.Node) {
 		castToBoolExpr(cb)
 		cb.UnaryOp(token.NOT).Then().
 			Break(nil).
-			End().
 			End()
+		ctx.setLineDirective(stmt)
+		cb.End()
 	}
 }
 
@@ -130,6 +149,7 @@ func compileWhileStmt(ctx *blockCtx, stmt *ast.Node) {
 	castToBoolExpr(cb)
 	cb.Then()
 	compileSub(ctx, stmt.Inner[1])
+	ctx.setLineDirective(stmt)
 	cb.End()
 }
 
@@ -143,7 +163,9 @@ func compileComplicatedWhileStmt(ctx *blockCtx, stmt *ast.Node) {
 	compileExpr(ctx, stmt.Inner[0])
 	castToBoolExpr(cb)
 	done := loop.EndLabel(ctx)
-	cb.UnaryOp(token.NOT).Then().Goto(done).End()
+	cb.UnaryOp(token.NOT).Then().Goto(done)
+	ctx.setLineDirective(stmt)
+	cb.End()
 
 	compileSub(ctx, stmt.Inner[1])
 	cb.Goto(loop.start).Label(done)
@@ -166,7 +188,9 @@ func compileComplicatedIfStmt(ctx *blockCtx, stmt *ast.Node) {
 	cb := ctx.cb.If()
 	compileExpr(ctx, stmt.Inner[0])
 	castToBoolExpr(cb)
-	cb.UnaryOp(token.NOT).Then().Goto(label).End()
+	cb.UnaryOp(token.NOT).Then().Goto(label)
+	ctx.setLineDirective(stmt)
+	cb.End()
 	compileSub(ctx, stmt.Inner[1])
 
 	if stmt.HasElse {
@@ -194,6 +218,7 @@ func compileIfStmt(ctx *blockCtx, stmt *ast.Node) {
 		cb.Else()
 		compileSub(ctx, stmt.Inner[2])
 	}
+	ctx.setLineDirective(stmt)
 	cb.End()
 }
 
@@ -212,6 +237,104 @@ func compileCompoundStmt(ctx *blockCtx, cStmt *ast.Node) {
 	cb.End()
 }
 
+// compileStmtExpr compiles a GNU statement expression ({ ...; expr; }) as
+//
+//	func() T {
+//		...
+//		return expr
+//	}()
+//
+// The closure is compiled as a function of its own (labels, complicated
+// flows), so jumps out of the statement expression aren't supported.
+func compileStmtExpr(ctx *blockCtx, v *ast.Node) {
+	body := v.Inner[0]
+	checkStmtExpr(ctx, body)
+
+	pkg, cb := ctx.pkg, ctx.cb
+	pos := ctx.goNodePos(v)
+	t := toType(ctx, v.Type, 0)
+	var results *types.Tuple
+	if t != ctypes.Void {
+		results = types.NewTuple(pkg.NewParam(pos, "", t))
+	}
+	cb.NewClosure(nil, results, false).BodyStart(pkg)
+
+	outer, flow, curnode := ctx.curfn, ctx.curflow, ctx.curnode
+	fn := newFuncCtx(pkg, ctx.markComplicated("stmtExpr", body), outer.orgName)
+	fn.basev, fn.addrs, fn.lblv = outer.basev, outer.addrs, outer.lblv
+	ctx.curfn, ctx.curflow = fn, nil
+	defer func() {
+		outer.basev = fn.basev
+		ctx.curfn, ctx.curflow, ctx.curnode = outer, flow, curnode
+	}()
+
+	stmts := body.Inner
+	n := len(stmts)
+	if results != nil {
+		n--
+	}
+	for _, stmt := range stmts[:n] {
+		compileStmt(ctx, stmt)
+	}
+	if results != nil {
+		last := stmts[n]
+		for last.Kind == ast.LabelStmt { // ({ ...; label: expr; })
+			cb.Label(ctx.getLabel(ctx.goNodePos(last), last.Name))
+			last = last.Inner[0]
+		}
+		ctx.curnode = last
+		compileExpr(ctx, last)
+		typeCast(ctx, t, cb.Get(-1))
+		cb.Return(1)
+	}
+	cb.End().CallWith(0, 0, ctx.goNode(v))
+}
+
+// checkStmtExpr reports return, goto, break and continue statements which jump
+// out of the statement expression body.
+func checkStmtExpr(ctx *blockCtx, body *ast.Node) {
+	labels := make(map[string]bool)
+	var collect func(v *ast.Node)
+	collect = func(v *ast.Node) {
+		if v.Kind == ast.LabelStmt {
+			labels[v.Name] = true
+		}
+		for _, item := range v.Inner {
+			collect(item)
+		}
+	}
+	collect(body)
+	var check func(v *ast.Node, inLoop, inSwitch bool)
+	check = func(v *ast.Node, inLoop, inSwitch bool) {
+		switch v.Kind {
+		case ast.ReturnStmt:
+			ctx.panicf(v, "return in statement expression is not supported")
+		case ast.IndirectGotoStmt:
+			ctx.panicf(v, "computed goto in statement expression is not supported")
+		case ast.GotoStmt:
+			if label := ctx.labelOfGoto(v); !labels[label] {
+				ctx.panicf(v, "goto %s out of statement expression is not supported", label)
+			}
+		case ast.BreakStmt:
+			if !inLoop && !inSwitch {
+				ctx.panicf(v, "break out of statement expression is not supported")
+			}
+		case ast.ContinueStmt:
+			if !inLoop {
+				ctx.panicf(v, "continue out of statement expression is not supported")
+			}
+		case ast.ForStmt, ast.WhileStmt, ast.DoStmt:
+			inLoop = true
+		case ast.SwitchStmt:
+			inSwitch = true
+		}
+		for _, item := range v.Inner {
+			check(item, inLoop, inSwitch)
+		}
+	}
+	check(body, false, false)
+}
+
 // -----------------------------------------------------------------------------
 
 func compileComplicatedForStmt(ctx *blockCtx, stmt *ast.Node) {
@@ -224,20 +347,24 @@ func compileComplicatedForStmt(ctx *blockCtx, stmt *ast.Node) {
 	}
 
 	loop.labelStart(ctx)
-	done := loop.EndLabel(ctx)
 
 	cb := ctx.cb
 	if cond := stmt.Inner[2]; cond.Kind != "" {
 		cb = cb.If()
 		compileExpr(ctx, stmt.Inner[2])
 		castToBoolExpr(cb)
-		cb.UnaryOp(token.NOT).Then().Goto(done).End()
+		cb.UnaryOp(token.NOT).Then().Goto(loop.EndLabel(ctx))
+		ctx.setLineDirective(stmt)
+		cb.End()
 	}
 	compileSub(ctx, stmt.Inner[4])
 	if postStmt := stmt.Inner[3]; postStmt.Kind != "" {
 		compileStmt(ctx, postStmt)
 	}
-	cb.Goto(loop.start).Label(done)
+	cb.Goto(loop.start)
+	if loop.done != nil { // for (;;) without break doesn't need it
+		cb.Label(loop.done)
+	}
 }
 
 func compileForStmt(ctx *blockCtx, stmt *ast.Node) {
@@ -257,7 +384,9 @@ func compileForStmt(ctx *blockCtx, stmt *ast.Node) {
 		cb = cb.For()
 	} else {
 		cb = cb.For()
+		lineDir := ctx.suspendLineDir()
 		compileInitStmt(ctx, stmt.Inner[0])
+		ctx.lineDir = lineDir
 	}
 
 	if stmt := stmt.Inner[1]; stmt.Kind != "" {
@@ -273,8 +402,11 @@ func compileForStmt(ctx *blockCtx, stmt *ast.Node) {
 	compileSub(ctx, stmt.Inner[4])
 	if postStmt := stmt.Inner[3]; postStmt.Kind != "" {
 		cb.Post()
+		lineDir := ctx.suspendLineDir()
 		compileStmt(ctx, postStmt)
+		ctx.lineDir = lineDir
 	}
+	ctx.setLineDirective(stmt)
 	cb.End()
 }
 
@@ -323,6 +455,7 @@ func compileComplicatedSwitchStmt(ctx *blockCtx, switchStmt *ast.Node) {
 	sw.tag = gogen.Lookup(scope, tagNamePrefix)
 	sw.notmat = gogen.Lookup(scope, notMatchedNamePrefix)
 
+	ctx.setLineDirective(switchStmt)
 	cb := ctx.cb.VarRef(sw.tag).VarRef(sw.notmat).Val(tag).Val(true).Assign(2)
 
 	body := switchStmt.Inner[1]
@@ -425,6 +558,7 @@ func compileSimpleSwitchStmt(ctx *blockCtx, switchStmt *ast.Node) {
 	if hasCase {
 		cb.End() // case
 	}
+	ctx.setLineDirective(switchStmt)
 	cb.End() // switch
 }
 
@@ -458,6 +592,68 @@ func compileGotoStmt(ctx *blockCtx, stmt *ast.Node) {
 	ctx.cb.Goto(l)
 }
 
+// compileAddrLabelExpr compiles &&label to the address of its byte in a static
+// array of the function, which has one byte for each address-taken label:
+//
+//	unsafe.Pointer(&_cgo_labels_fn[n])
+//
+// So it's a valid pointer for the Go runtime, unlike a small integer.
+func compileAddrLabelExpr(ctx *blockCtx, v *ast.Node) {
+	n, ok := ctx.curfn.addrs[v.Name]
+	if !ok {
+		ctx.panicf(v, "address of label %s: label not found", v.Name)
+	}
+	cb := ctx.cb
+	cb.Typ(ctypes.UnsafePointer).Val(ctx.curfn.lblv).Val(n).Index(1, false).UnaryOp(token.AND)
+	cb.CallWith(1, 0, ctx.goNode(v))
+}
+
+// newLabelsVar declares the static array of n bytes whose addresses are the
+// addresses of labels of the current function (see compileAddrLabelExpr).
+func newLabelsVar(ctx *blockCtx, n int) *types.Var {
+	pkg := ctx.pkg
+	scope := pkg.Types.Scope()
+	name := "_cgo_labels_" + ctx.curfn.orgName + ctx.baseOF
+	typ := types.NewArray(types.Typ[types.Byte], int64(n))
+	pkg.NewVarDefs(scope).New(token.NoPos, typ, name)
+	return scope.Lookup(name).(*types.Var)
+}
+
+// compileIndirectGotoStmt compiles `goto *addr` to a dispatch on the offsets of
+// the address-taken labels in their static array (see compileAddrLabelExpr):
+//
+//	switch uintptr(addr) - uintptr(unsafe.Pointer(&_cgo_labels_fn[0])) {
+//	case 0:
+//		goto label0
+//	...
+//	default:
+//		panic("c2go: goto *addr: invalid label address")
+//	}
+func compileIndirectGotoStmt(ctx *blockCtx, stmt *ast.Node) {
+	addrs := ctx.curfn.addrs
+	names := make([]string, len(addrs))
+	for name, n := range addrs {
+		names[n] = name
+	}
+	pos := ctx.goNodePos(stmt)
+	cb := ctx.cb.Switch()
+	cb.Typ(tyUintptr)
+	compileExpr(ctx, stmt.Inner[0])
+	cb.Call(1)
+	if lblv := ctx.curfn.lblv; lblv != nil {
+		cb.Typ(tyUintptr).Typ(ctypes.UnsafePointer).Val(lblv).Val(0).Index(1, false).UnaryOp(token.AND).
+			Call(1).Call(1).BinaryOp(token.SUB)
+	}
+	cb.Then()
+	for i, name := range names {
+		cb.Case().Val(i).Then().Goto(ctx.getLabel(pos, name)).End()
+	}
+	cb.Case().Then().
+		Val(ctx.pkg.Builtin().Ref("panic")).Val("c2go: goto *addr: invalid label address").Call(1).EndStmt().
+		End()
+	cb.End()
+}
+
 func compileReturnStmt(ctx *blockCtx, stmt *ast.Node) {
 	n := len(stmt.Inner)
 	if n > 0 {
@@ -466,6 +662,7 @@ func compileReturnStmt(ctx *blockCtx, stmt *ast.Node) {
 		cb := ctx.cb
 		typeCast(ctx, getRetType(cb), cb.Get(-1))
 	}
+	ctx.setLineDirective(stmt)
 	ctx.cb.Return(n, ctx.goNode(stmt))
 }
 
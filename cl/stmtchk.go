@@ -1,6 +1,7 @@
 package cl
 
 import (
+	"fmt"
 	"log"
 	"time"
 
@@ -125,6 +126,7 @@ type markCtx struct {
 	current   *blockMarkCtx
 	owner     *ownerStmtCtx
 	labels    map[string]*labelCtx
+	addrs     map[string]int // address-taken labels
 	complicat bool
 }
 
@@ -180,6 +182,7 @@ func (p *markCtx) markBody(ctx *blockCtx, stmt *ast.Node) {
 }
 
 func (p *markCtx) mark(ctx *blockCtx, stmt *ast.Node) {
+	p.markSetjmp(stmt)
 	switch stmt.Kind {
 	case ast.IfStmt:
 		ret := p.enterOwner(stmt)
@@ -208,15 +211,38 @@ func (p *markCtx) mark(ctx *blockCtx, stmt *ast.Node) {
 	case ast.GotoStmt:
 		name := ctx.labelOfGoto(stmt)
 		p.reqLabel(name).useLabel(name, p.current)
+	case ast.IndirectGotoStmt: // goto *addr may jump to any address-taken label
+		for name := range p.addrs {
+			p.reqLabel(name).useLabel(name, p.current)
+		}
 	case ast.CompoundStmt:
 		ret := p.enterOwner(stmt)
 		defer p.leaveOwner(ret)
 		p.markSub(ctx, "blockBody", stmt)
+	case ast.StmtExpr: // ({ ... }) as a statement is a block
+		p.mark(ctx, stmt.Inner[0])
 	case ast.CaseStmt, ast.DefaultStmt:
 		p.markSwitchComplicated()
 	}
 }
 
+// markSetjmp models a longjmp to a setjmp call in stmt as a goto from the
+// function body to the statement (see compileSetjmpBody).
+func (p *markCtx) markSetjmp(stmt *ast.Node) {
+	for {
+		if setjmpsIn(stmt) != nil {
+			name := fmt.Sprintf("setjmp@%p", stmt)
+			l := p.reqLabel(name)
+			l.defineLabel(name, p.current)
+			l.useLabel(name, nil)
+		}
+		if stmt.Kind != ast.LabelStmt { // labeled statements aren't marked
+			return
+		}
+		stmt = stmt.Inner[0]
+	}
+}
+
 func (p *markCtx) markSwitchComplicated() {
 	owner := p.owner
 	for owner != nil {
@@ -296,10 +322,37 @@ func (p *blockCtx) markComplicated(name string, body *ast.Node) bool {
 		}()
 	}
 	labels := make(map[string]*labelCtx)
-	marker := &markCtx{labels: labels}
+	marker := &markCtx{labels: labels, addrs: addrLabelsOf(body)}
 	marker.markBody(p, body)
 	marker.markEnd()
 	return marker.complicat
 }
 
 // -----------------------------------------------------------------------------
+
+// addrLabelsOf numbers the labels whose addresses are taken (&&label) in body,
+// from 0 in order of appearance.
+func addrLabelsOf(body *ast.Node) map[string]int {
+	var labels map[string]int
+	var walk func(v *ast.Node)
+	walk = func(v *ast.Node) {
+		if v.Kind == ast.AddrLabelExpr {
+			if _, ok := labels[v.Name]; !ok {
+				if labels == nil {
+					labels = make(map[string]int)
+				}
+				labels[v.Name] = len(labels)
+			}
+		}
+		for _, item := range v.Inner {
+			walk(item)
+		}
+		for _, item := range v.ArrayFiller {
+			walk(item)
+		}
+	}
+	walk(body)
+	return labels
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,103 @@
+package cl
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/goplus/c2go/clang/ast"
+	"github.com/goplus/c2go/clang/parser"
+	"github.com/goplus/c2go/clang/preprocessor"
+)
+
+func TestNewPackageStream(t *testing.T) {
+	idx := atomic.AddInt64(&tmpFileIdx, 1)
+	infile := tmpDir + strconv.FormatInt(idx, 10) + ".c"
+	err := os.WriteFile(infile, []byte(`
+struct {
+	int x;
+} a, b;
+
+typedef struct {
+	int y;
+} foo;
+
+foo c;
+
+int add(int x, int y) {
+	return x + y + a.x + c.y;
+}
+`), 0666)
+	check(err)
+	defer os.Remove(infile)
+
+	outfile := infile + ".i"
+	err = preprocessor.Do(infile, outfile, nil)
+	check(err)
+	defer os.Remove(outfile)
+
+	var json []byte
+	doc, _, err := parser.ParseFileEx(outfile, 0, &parser.Config{Json: &json})
+	check(err)
+	expected := writeStreamPkg(t, func() (Package, error) {
+		return NewPackage("", "main", doc, &Config{SrcFile: outfile})
+	})
+
+	cacheDir, err := os.MkdirTemp("", "c2go-cache")
+	check(err)
+	defer os.RemoveAll(cacheDir)
+	for i := 0; i < 2; i++ { // the second time reads the AST cache
+		n := 0
+		out := writeStreamPkg(t, func() (Package, error) {
+			return NewPackageStream("", "main", func(fn func(decl *ast.Node) error) error {
+				_, _, err := parser.ParseFileStream(outfile, 0, &parser.Config{CacheDir: cacheDir}, func(decl *ast.Node) error {
+					n++
+					return fn(decl)
+				})
+				return err
+			}, &Config{SrcFile: outfile})
+		})
+		if out != expected {
+			t.Fatalf("NewPackageStream:\n%s\n==> Expected:\n%s\n", out, expected)
+		}
+		if n != len(doc.Inner) {
+			t.Fatal("ParseFileStream: decls =", n, "expected:", len(doc.Inner))
+		}
+	}
+
+	jsonfile := infile + ".json"
+	err = os.WriteFile(jsonfile, json, 0666)
+	check(err)
+	defer os.Remove(jsonfile)
+	out := writeStreamPkg(t, func() (Package, error) {
+		return NewPackageStream("", "main", func(fn func(decl *ast.Node) error) error {
+			_, err := parser.ParseJSONStream(jsonfile, 0, fn)
+			return err
+		}, &Config{SrcFile: outfile})
+	})
+	if out != expected {
+		t.Fatalf("ParseJSONStream:\n%s\n==> Expected:\n%s\n", out, expected)
+	}
+
+	errStop := errors.New("stop")
+	_, _, err = parser.ParseFileStream(outfile, 0, nil, func(decl *ast.Node) error {
+		return errStop
+	})
+	if err != errStop {
+		t.Fatal("ParseFileStream:", err)
+	}
+}
+
+func writeStreamPkg(t *testing.T, newPkg func() (Package, error)) string {
+	pkg, err := newPkg()
+	if err != nil {
+		t.Fatal("newPkg:", err)
+	}
+	var w bytes.Buffer
+	err = pkg.WriteTo(&w)
+	check(err)
+	return w.String()
+}
@@ -7,6 +7,7 @@ import (
 	"go/types"
 	"log"
 	"strconv"
+	"strings"
 
 	ctypes "github.com/goplus/c2go/clang/types"
 
@@ -25,17 +26,22 @@ func toType(ctx *blockCtx, typ *ast.Type, flags int) types.Type {
 func toTypeEx(ctx *blockCtx, scope *types.Scope, tyAnonym types.Type, typ *ast.Type, flags int, pub bool) (t types.Type, kind int) {
 	t, kind, err := parseType(ctx, scope, tyAnonym, typ, flags, pub)
 	if err != nil {
-		log.Panicln("toType:", err, "-", typ.QualType)
+		ctx.panicf(nil, "toType: %v - %v", err, typ.QualType)
 	}
 	return
 }
 
 func parseType(ctx *blockCtx, scope *types.Scope, tyAnonym types.Type, typ *ast.Type, flags int, pub bool) (t types.Type, kind int, err error) {
 	conf := &parser.Config{
-		Scope: scope, Flags: flags, Anonym: tyAnonym, ParseEnv: ctx,
+		Scope: scope, Flags: flags, Anonym: tyAnonym, ParseEnv: ctx, Target: ctx.target,
+		LongDouble: ctx.tyLDbl,
+	}
+	qualType := typ.QualType
+	if typ.DesugaredQualType != "" && hasTypeofExpr(qualType) {
+		qualType = typ.DesugaredQualType
 	}
 retry:
-	t, kind, err = parser.ParseType(typ.QualType, conf)
+	t, kind, err = parser.ParseType(qualType, conf)
 	if err != nil {
 		if e, ok := err.(*parser.TypeNotFound); ok && e.StructOrUnion {
 			name := e.Literal
@@ -52,6 +58,27 @@ retry:
 	return
 }
 
+// hasTypeofExpr checks if qualType has a `typeof (expr)` or `__typeof__(expr)`
+// specifier, which can't be parsed without the expression.
+func hasTypeofExpr(qualType string) bool {
+	for i := 0; ; {
+		pos := strings.Index(qualType[i:], "typeof")
+		if pos < 0 {
+			return false
+		}
+		start, end := i+pos, i+pos+6
+		if strings.HasPrefix(qualType[end:], "__") && strings.HasSuffix(qualType[:start], "__") {
+			start, end = start-2, end+2
+		}
+		if start == 0 || !isIdentChar(rune(qualType[start-1])) {
+			if strings.HasPrefix(strings.TrimLeft(qualType[end:], " "), "(") {
+				return true
+			}
+		}
+		i = end
+	}
+}
+
 func toAnonymType(ctx *blockCtx, src goast.Node, decl *ast.Node) (ret *types.Named) {
 	scope := types.NewScope(ctx.cb.Scope(), token.NoPos, token.NoPos, "")
 	switch decl.Kind {
@@ -76,7 +103,7 @@ func checkFieldName(pname *string, pub bool) {
 }
 
 func toStructType(ctx *blockCtx, t *types.Named, struc *ast.Node, pub bool) (ret *types.Struct, dels delfunc) {
-	b := newStructBuilder()
+	b := newStructBuilder(ctx, struc)
 	scope := types.NewScope(ctx.cb.Scope(), token.NoPos, token.NoPos, "")
 	n := len(struc.Inner)
 	for i := 0; i < n; i++ {
@@ -93,9 +120,9 @@ func toStructType(ctx *blockCtx, t *types.Named, struc *ast.Node, pub bool) (ret
 			typ, _ := toTypeEx(ctx, scope, nil, decl.Type, parser.FlagIsStructField, false)
 			if decl.IsBitfield {
 				bits := toInt64(ctx, decl.Inner[0], "non-constant bit field")
-				b.BitField(ctx, typ, name, int(bits))
+				b.BitField(ctx, decl, typ, name, int(bits))
 			} else {
-				b.Field(ctx, ctx.goNodePos(decl), typ, name, false)
+				b.Field(ctx, decl, typ, name, false)
 			}
 		case ast.RecordDecl:
 			name, suKind := ctx.getSuName(decl, decl.TagUsed)
@@ -109,11 +136,11 @@ func toStructType(ctx *blockCtx, t *types.Named, struc *ast.Node, pub bool) (ret
 				next := struc.Inner[i+1]
 				if next.Kind == ast.FieldDecl {
 					if next.IsImplicit {
-						b.Field(ctx, ctx.goNodePos(decl), typ, name, true)
+						b.Field(ctx, next, typ, name, true)
 						i++
 					} else if ret, ok := checkAnonymous(ctx, scope, typ, next); ok {
 						checkFieldName(&next.Name, pub)
-						b.Field(ctx, ctx.goNodePos(next), ret, next.Name, false)
+						b.Field(ctx, next, ret, next.Name, false)
 						i++
 						continue
 					}
@@ -130,7 +157,7 @@ func toStructType(ctx *blockCtx, t *types.Named, struc *ast.Node, pub bool) (ret
 }
 
 func toUnionType(ctx *blockCtx, t *types.Named, unio *ast.Node, pub bool) (ret types.Type, dels delfunc) {
-	b := newUnionBuilder()
+	b := newUnionBuilder(ctx, unio)
 	scope := types.NewScope(ctx.cb.Scope(), token.NoPos, token.NoPos, "")
 	n := len(unio.Inner)
 	for i := 0; i < n; i++ {
@@ -143,7 +170,7 @@ func toUnionType(ctx *blockCtx, t *types.Named, unio *ast.Node, pub bool) (ret t
 			}
 			checkFieldName(&name, pub)
 			typ, _ := toTypeEx(ctx, scope, nil, decl.Type, 0, false)
-			b.Field(ctx, ctx.goNodePos(decl), typ, name, false)
+			b.Field(ctx, decl, typ, name, false)
 		case ast.RecordDecl:
 			name, suKind := ctx.getSuName(decl, decl.TagUsed)
 			typ, del := compileStructOrUnion(ctx, name, decl, pub)
@@ -156,11 +183,11 @@ func toUnionType(ctx *blockCtx, t *types.Named, unio *ast.Node, pub bool) (ret t
 				next := unio.Inner[i+1]
 				if next.Kind == ast.FieldDecl {
 					if next.IsImplicit {
-						b.Field(ctx, ctx.goNodePos(decl), typ, name, true)
+						b.Field(ctx, next, typ, name, true)
 						i++
 					} else if ret, ok := checkAnonymous(ctx, scope, typ, next); ok {
 						checkFieldName(&next.Name, pub)
-						b.Field(ctx, ctx.goNodePos(next), ret, next.Name, false)
+						b.Field(ctx, next, ret, next.Name, false)
 						i++
 						continue
 					}
@@ -270,6 +297,7 @@ func compileStructOrUnion(ctx *blockCtx, name string, decl *ast.Node, pub bool)
 		}
 	}
 	if decl.CompleteDefinition {
+		ctx.recordDecl(t.Type().Obj().Name(), decl.Name, decl)
 		var inner types.Type
 		var del delfunc
 		switch decl.TagUsed {
@@ -319,6 +347,7 @@ func compileEnumConst(ctx *blockCtx, cdecl *gogen.ConstDefs, v *ast.Node, iotav
 		return 1
 	}
 	cdecl.New(fn, iotav, ctx.goNodePos(v), ctypes.Int, v.Name)
+	ctx.recordDecl(v.Name, v.Name, v)
 	return iotav + 1
 }
 
@@ -350,7 +379,7 @@ func compileVarDecl(ctx *blockCtx, decl *ast.Node, global bool) {
 		if gblStatic && parser.IsArrayWithoutLen(err) {
 			return
 		}
-		log.Panicln("parseType:", err, "-", decl.Type)
+		ctx.panicf(decl, "parseType: %v - %v", err, decl.Type.QualType)
 	}
 	avoidKeyword(&decl.Name)
 	if flags == parser.FlagIsExtern {
@@ -363,6 +392,9 @@ func compileVarDecl(ctx *blockCtx, decl *ast.Node, global bool) {
 			return
 		}
 		newVarAndInit(ctx, scope, typ, decl, global)
+		if scope == ctx.pkg.Types.Scope() {
+			ctx.recordDecl(decl.Name, origName, decl)
+		}
 		if rewritten {
 			substObj(ctx.pkg.Types, ctx.cb.Scope(), origName, scope.Lookup(decl.Name))
 		} else if kind == parser.KindFVolatile && !global {
@@ -423,9 +455,10 @@ func newVarAndInit(ctx *blockCtx, scope *types.Scope, typ types.Type, decl *ast.
 	}
 	if len(inner) > 0 {
 		initExpr := inner[0]
-		if ufs, ok := checkUnion(ctx, typ); ok {
-			if inVBlock {
-				log.Panicln("TODO: initUnionVar inVBlock")
+		if ufs, ok := checkUnion(ctx, typ); ok && initExpr.Kind == ast.InitListExpr {
+			if inVBlock { // initUnionVar assigns one field only
+				addr := gogen.Lookup(scope, decl.Name)
+				ctx.cb.VarRef(addr).ZeroLit(typ).Assign(1)
 			}
 			initUnionVar(ctx, decl.Name, ufs, initExpr)
 			return
@@ -487,14 +520,6 @@ func initLit(ctx *blockCtx, typ types.Type, initExpr *ast.Node) int {
 		}
 	case *types.Named:
 		structLit(ctx, t, initExpr)
-	case *bfType:
-		if initExpr.Kind != ast.ImplicitValueInitExpr {
-			log.Panicln("initLit bfType: TODO")
-		}
-		if !t.first {
-			return 0
-		}
-		ctx.cb.ZeroLit(t.Type)
 	default:
 		compileExpr(ctx, initExpr)
 	}
@@ -520,14 +545,122 @@ func arrayLit(ctx *blockCtx, t *types.Array, decl *ast.Node) {
 }
 
 func structLit(ctx *blockCtx, typ *types.Named, decl *ast.Node) {
+	if vfs, ok := ctx.pkg.VFields(typ); ok {
+		if sf, ok := vfs.(*structFields); ok {
+			structLitOf(ctx, typ, sf.fields, decl)
+			return
+		}
+	}
 	t := ctx.getVStruct(typ)
-	n := 0
-	for i, initExpr := range decl.Inner {
-		n += initLit(ctx, t.Field(i).Type(), initExpr)
+	n, inits := 0, decl.Inner
+	for i, nf := 0, t.NumFields(); i < nf; i++ { // trailing paddings are zero
+		fld := t.Field(i)
+		switch ft := fld.Type().(type) {
+		case *bfType: // bit fields in the same storage field
+			j := i + 1
+			for j < nf {
+				if next, ok := t.Field(j).Type().(*bfType); !ok || next.FldName != ft.FldName {
+					break
+				}
+				j++
+			}
+			k := j - i
+			if k > len(inits) {
+				k = len(inits)
+			}
+			bitFieldsLit(ctx, t, i, inits[:k])
+			i, inits = j-1, inits[k:]
+		default:
+			if isPadding(fld) || len(inits) == 0 {
+				ctx.cb.ZeroLit(ft)
+			} else {
+				initLit(ctx, ft, inits[0])
+				inits = inits[1:]
+			}
+		}
+		n++
 	}
 	ctx.cb.StructLit(typ, n, false)
 }
 
+// structLitOf pushes value of struct typ with fields flds of C, which can't be
+// a composite literal because of unaligned fields (see structFields), as
+//
+//	func() (_cgo_ret typ) {
+//		_cgo_ret.fld = ...
+//		return
+//	}()
+func structLitOf(ctx *blockCtx, typ *types.Named, flds []*types.Var, decl *ast.Node) {
+	pkg, cb := ctx.pkg, ctx.cb
+	ret := pkg.NewParam(ctx.goNodePos(decl), "_cgo_ret", typ)
+	cb.NewClosure(nil, types.NewTuple(ret), false).BodyStart(pkg)
+	for i, initExpr := range decl.Inner {
+		if initExpr.Kind == ast.ImplicitValueInitExpr {
+			continue
+		}
+		fld := flds[i]
+		cb.Val(ret).MemberRef(fld.Name())
+		initLit(ctx, fld.Type(), initExpr)
+		assign(ctx, ctx.goNode(initExpr))
+	}
+	cb.Return(0).End().Call(0)
+}
+
+// bitFieldsLit pushes value of the storage field of bit fields t.Field(i), ...,
+// which are initialized by inits.
+func bitFieldsLit(ctx *blockCtx, t *types.Struct, i int, inits []*ast.Node) {
+	cb := ctx.cb
+	typ := t.Field(i).Type().(*bfType).Type
+	utyp := intType(ctx.sizeof(typ), true)
+	var cval uint64
+	var n, nconst int
+	for k, initExpr := range inits {
+		if initExpr.Kind == ast.ImplicitValueInitExpr {
+			continue
+		}
+		bf := t.Field(i + k).Type().(*bfType)
+		mask := uint64(1)<<bf.Bits - 1
+		compileExpr(ctx, initExpr)
+		if v := cb.Get(-1); v.CVal != nil { // put constants together
+			if x, ok := constant.Int64Val(constant.ToInt(v.CVal)); ok {
+				cb.InternalStack().Pop()
+				cval |= (uint64(x) & mask) << bf.Off
+				nconst++
+				continue
+			}
+		}
+		typeCast(ctx, utyp, cb.Get(-1))
+		cb.Val(uintLit(mask)).BinaryOp(token.AND)
+		if bf.Off != 0 {
+			cb.Val(bf.Off).BinaryOp(token.SHL)
+		}
+		if n > 0 {
+			cb.BinaryOp(token.OR)
+		}
+		n++
+	}
+	if n == 0 {
+		if nconst == 0 {
+			cb.ZeroLit(typ)
+			return
+		}
+		if isUnsigned(typ) {
+			cb.Val(uintLit(cval))
+		} else { // cval as a signed value
+			shift := 64 - ctx.sizeof(typ)<<3
+			val := int64(cval<<shift) >> shift
+			cb.Val(&goast.BasicLit{Kind: token.INT, Value: strconv.FormatInt(val, 10)})
+		}
+	} else if cval != 0 {
+		cb.Val(uintLit(cval)).BinaryOp(token.OR)
+	}
+	typeCast(ctx, typ, cb.Get(-1))
+}
+
+func uintLit(v uint64) *goast.BasicLit {
+	return &goast.BasicLit{Kind: token.INT, Value: strconv.FormatUint(v, 10)}
+}
+
 func checkUnion(ctx *blockCtx, typ types.Type) (ufs *gogen.UnionFields, is bool) {
 	if t, ok := typ.(*types.Named); ok {
 		if vft, ok := ctx.pkg.VFields(t); ok {
@@ -539,6 +672,9 @@ func checkUnion(ctx *blockCtx, typ types.Type) (ufs *gogen.UnionFields, is bool)
 }
 
 func initUnionVar(ctx *blockCtx, name string, ufs *gogen.UnionFields, decl *ast.Node) {
+	if len(decl.Inner) == 0 { // {}
+		return
+	}
 	initExpr := decl.Inner[0]
 	t := toType(ctx, initExpr.Type, 0)
 	for i, n := 0, ufs.Len(); i < n; i++ {
@@ -605,11 +741,9 @@ func isNumber(typ types.Type) bool {
 	return isKind(typ, types.IsInteger|types.IsFloat)
 }
 
-/*
 func isUnsigned(typ types.Type) bool {
 	return isKind(typ, types.IsUnsigned)
 }
-*/
 
 func isInteger(typ types.Type) bool {
 	return isKind(typ, types.IsInteger)
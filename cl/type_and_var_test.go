@@ -1,10 +1,13 @@
 package cl
 
 import (
+	"bytes"
 	"go/token"
 	"go/types"
+	"reflect"
 	"testing"
 
+	"github.com/goplus/c2go/clang/ast"
 	ctypes "github.com/goplus/c2go/clang/types"
 	"github.com/goplus/gogen"
 )
@@ -260,9 +263,212 @@ void test() {
 		x     float64
 	}
 	var a struct_foo = struct_foo{int32(1), 0, 0}
+}`)
+	testFunc(t, "testBFDesignated", `
+void test(int n) {
+	struct foo {
+		char a :4;
+		int b :4;
+		char c;
+		unsigned d :3;
+	} a = {.b = -1, .d = n};
+}
+`, `func test(n int32) {
+	type struct_foo struct {
+		_     [0]int32
+		Xbf_0 int8
+		c     int8
+		Xbf_1 uint8
+	}
+	var a struct_foo = struct_foo{[0]int32{}, int8(-16), 0, uint8(uint32(n)) & 7}
+}`)
+	testFunc(t, "testBFZeroWidth", `
+void test() {
+	struct foo {
+		char a :3;
+		int :0;
+		char b :3;
+	} a = {1, 2};
+}
+`, `func test() {
+	type struct_foo struct {
+		Xbf_0 int8
+		_     [3]uint8
+		Xbf_1 int8
+	}
+	var a struct_foo = struct_foo{int8(1), [3]uint8{}, int8(2)}
+}`)
+}
+
+func TestBitFieldLayout(t *testing.T) {
+	doc, src := parse(`
+struct foo {
+	char x;
+	char a :4;
+	int b :12;
+};
+`, nil)
+	_, err := NewPackage("", "main", doc, &Config{Src: src})
+	diags, ok := err.(ErrorList)
+	if !ok || len(diags) != 1 ||
+		diags[0].Msg != "layout of bit field b is not supported" || diags[0].Pos.Line != 5 {
+		t.Fatal("NewPackage:", err)
+	}
+}
+
+func TestPacked(t *testing.T) {
+	testFunc(t, "testPackedAttr", `
+void test() {
+	struct foo {
+		char a;
+		int b;
+		short c;
+	} __attribute__((packed)) x = {1, 2};
+	x.b = x.c;
+}
+`, `func test() {
+	type struct_foo struct {
+		a int8
+		_ [6]uint8
+	}
+	var x struct_foo = func() (_cgo_ret struct_foo) {
+		_cgo_ret.a = int8(1)
+		*(*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(&_cgo_ret)) + 1)) = int32(2)
+		return
+	}()
+	*(*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(&x)) + 1)) = int32(*(*int16)(unsafe.Pointer(uintptr(unsafe.Pointer(&x)) + 5)))
+}`)
+	testFunc(t, "testPragmaPack", `
+void test() {
+#pragma pack(push, 2)
+	struct foo {
+		char a;
+		int b;
+		char c __attribute__((aligned(8)));
+	} x;
+#pragma pack(pop)
+	int n = sizeof(x);
+}
+`, `func test() {
+	type struct_foo struct {
+		_ [0]int16
+		a int8
+		_ [5]uint8
+		c int8
+	}
+	var x struct_foo
+	var n int32 = int32(8)
+}`)
+	testFunc(t, "testAligned", `
+void test() {
+	struct foo {
+		char a;
+		short b;
+	} __attribute__((aligned(16)));
+	struct bar {
+		char a;
+		struct foo b;
+	} x;
+	int n = sizeof(x);
+}
+`, `func test() {
+	type struct_foo struct {
+		_ [0]int64
+		a int8
+		b int16
+		_ [12]uint8
+	}
+	type struct_bar struct {
+		a int8
+		_ [15]uint8
+		b struct_foo
+	}
+	var x struct_bar
+	var n int32 = int32(32)
 }`)
 }
 
+func TestPackedLayout(t *testing.T) {
+	doc, src := parse(`
+#pragma pack(__SIZEOF_SHORT__)
+struct foo {
+	char a;
+	int b;
+};
+`, nil)
+	_, err := NewPackage("", "main", doc, &Config{Src: src})
+	diags, ok := err.(ErrorList)
+	if !ok || len(diags) != 1 ||
+		diags[0].Msg != "#pragma pack of foo not found" || diags[0].Pos.Line != 3 {
+		t.Fatal("NewPackage:", err)
+	}
+}
+
+func TestAlignedLayout(t *testing.T) {
+	code := `#include <stddef.h> // max_align_t in a system header isn't reported
+
+struct foo {
+	char a;
+} __attribute__((aligned));
+
+struct bar {
+	char a;
+} __attribute__((aligned(4)));
+
+int n = sizeof(struct foo);
+`
+	doc, src := parseEx(code, nil, "x86_64-pc-linux-gnu")
+	pkg, err := NewPackage("", "main", doc, &Config{Src: src, Target: "x86_64-pc-linux-gnu"})
+	check(err)
+	diags := pkg.Diagnostics()
+	if len(diags) != 1 || diags[0].Severity != SevWarning || diags[0].Pos.Line != 3 ||
+		diags[0].Msg != "alignment 16 of struct_foo is not supported, it's aligned to 8 in Go" {
+		t.Fatal("Diagnostics:", diags)
+	}
+	if b, _ := pkg.goFile(); !bytes.Contains(b, []byte("var n int32 = int32(16)")) {
+		t.Fatal("sizeof:", string(b))
+	}
+
+	doc, src = parseEx(code, nil, "arm-pc-linux-gnueabi") // __BIGGEST_ALIGNMENT__ is 8
+	pkg, err = NewPackage("", "main", doc, &Config{Src: src, Target: "arm-pc-linux-gnueabi"})
+	check(err)
+	diags = pkg.Diagnostics()
+	if len(diags) != 1 || diags[0].Msg != "alignment 8 of struct_foo is not supported, it's aligned to 4 in Go" {
+		t.Fatal("Diagnostics:", diags)
+	}
+	if b, _ := pkg.goFile(); !bytes.Contains(b, []byte("var n int32 = int32(8)")) {
+		t.Fatal("sizeof:", string(b))
+	}
+}
+
+func TestPragmaPacks(t *testing.T) {
+	src := []byte(`struct a;
+#pragma pack(push, 2)
+struct b;
+  #pragma pack(4)
+struct c;
+#pragma pack(pop)
+struct d;
+#pragma pack(FOO)
+#pragma pack(1)
+struct e;
+`)
+	packs := pragmaPacks(src)
+	expected := []pragmaPack{{10, 2}, {42, 4}, {70, 0}, {98, -1}}
+	if !reflect.DeepEqual(packs, expected) {
+		t.Fatal("pragmaPacks:", packs)
+	}
+	ctx := &blockCtx{src: src}
+	for i, want := range []int{0, 2, 4, 0, -1} {
+		name := string(rune('a' + i))
+		off := bytes.Index(src, []byte("struct "+name))
+		decl := &ast.Node{Loc: &ast.Loc{Offset: int64(off), Col: 1}}
+		if pack := ctx.packOf(decl); pack != want {
+			t.Fatal("packOf:", name, pack)
+		}
+	}
+}
+
 // -----------------------------------------------------------------------------
 
 func TestVoid(t *testing.T) {
@@ -694,6 +900,50 @@ _cgol_3:
 }`)
 }
 
+func TestUnionInVblock(t *testing.T) {
+	testFunc(t, "testUnionInVblock", `
+union U {
+	int i;
+	double d;
+};
+
+void test(int n) {
+	if (n) {
+		goto next;
+	}
+	while (n < 3) {
+		union U u = {.d = n};
+		union U v = u;
+	next:
+		n++;
+	}
+}`, `func test(n int32) {
+	var (
+		u_cgo1 union_U
+		v_cgo2 union_U
+	)
+	if !(n != 0) {
+		goto _cgol_1
+	}
+	goto next
+_cgol_1:
+	;
+_cgol_2:
+	if !(n < int32(3)) {
+		goto _cgol_3
+	}
+	u_cgo1 = struct {
+		d float64
+	}{}
+	u_cgo1.d = float64(n)
+	v_cgo2 = u_cgo1
+next:
+	n++
+	goto _cgol_2
+_cgol_3:
+}`)
+}
+
 func TestStaticAliasInFunc(t *testing.T) {
 	testFunc(t, "testStaticAliasInFunc", `
 void test() {
@@ -770,3 +1020,29 @@ void test() {
 }
 
 // -----------------------------------------------------------------------------
+
+func TestHasTypeofExpr(t *testing.T) {
+	cases := map[string]bool{
+		"typeof (a)":           true,
+		"__typeof__(a) *":      true,
+		"const typeof (a + b)": true,
+		"my_typeof_t":          false,
+		"typeof_t *":           false,
+		"struct __typeof__x":   false,
+	}
+	for qualType, want := range cases {
+		if ret := hasTypeofExpr(qualType); ret != want {
+			t.Fatal("hasTypeofExpr:", qualType, ret)
+		}
+	}
+	testFunc(t, "typeofAfterTypedef", `
+typedef int my_typeof_t;
+void test() {
+	my_typeof_t x = 1;
+	__typeof__(x) y = x;
+}
+`, `func test() {
+	var x int32 = int32(1)
+	var y int32 = x
+}`)
+}
@@ -0,0 +1,19 @@
+package clang
+
+// -----------------------------------------------------------------------------
+
+// CStrings returns strs as a NULL terminated array of C strings, like argv and
+// envp passed to main.
+func CStrings(strs []string) **Char {
+	arr := make([]*Char, len(strs)+1)
+	for i, s := range strs {
+		b := make([]Char, len(s)+1)
+		for j := 0; j < len(s); j++ {
+			b[j] = Char(s[j])
+		}
+		arr[i] = &b[0]
+	}
+	return &arr[0]
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,20 @@
+package clang
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestCStrings(t *testing.T) {
+	argv := (*[3]*Char)(unsafe.Pointer(CStrings([]string{"prog", ""})))
+	if argv[2] != nil || *argv[1] != 0 {
+		t.Fatal("CStrings:", argv)
+	}
+	prog := (*[5]Char)(unsafe.Pointer(argv[0]))
+	if string([]byte{byte(prog[0]), byte(prog[1]), byte(prog[2]), byte(prog[3])}) != "prog" || prog[4] != 0 {
+		t.Fatal("CStrings:", prog)
+	}
+	if envp := CStrings(nil); *envp != nil {
+		t.Fatal("CStrings(nil):", *envp)
+	}
+}
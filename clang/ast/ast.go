@@ -61,6 +61,7 @@ const (
 	BuiltinAttr              Kind = "BuiltinAttr"
 	FormatAttr               Kind = "FormatAttr"
 	FormatArgAttr            Kind = "FormatArgAttr"
+	OverloadableAttr         Kind = "OverloadableAttr"
 	ColdAttr                 Kind = "ColdAttr"
 	ConstAttr                Kind = "ConstAttr"
 	PureAttr                 Kind = "PureAttr"
@@ -92,6 +93,7 @@ const (
 	WhileStmt                Kind = "WhileStmt"
 	DoStmt                   Kind = "DoStmt"
 	GotoStmt                 Kind = "GotoStmt"
+	IndirectGotoStmt         Kind = "IndirectGotoStmt"
 	BreakStmt                Kind = "BreakStmt"
 	ContinueStmt             Kind = "ContinueStmt"
 	LabelStmt                Kind = "LabelStmt"
@@ -120,6 +122,9 @@ const (
 	UnaryOperator            Kind = "UnaryOperator"
 	ConditionalOperator      Kind = "ConditionalOperator"
 	CompoundLiteralExpr      Kind = "CompoundLiteralExpr"
+	StmtExpr                 Kind = "StmtExpr"
+	GenericSelectionExpr     Kind = "GenericSelectionExpr"
+	AddrLabelExpr            Kind = "AddrLabelExpr"
 	PredefinedExpr           Kind = "PredefinedExpr"
 	CharacterLiteral         Kind = "CharacterLiteral"
 	IntegerLiteral           Kind = "IntegerLiteral"
@@ -177,6 +182,8 @@ const (
 	ToVoid                   CastKind = "ToVoid"
 	NullToPointer            CastKind = "NullToPointer"
 	NoOp                     CastKind = "NoOp"
+	AtomicToNonAtomic        CastKind = "AtomicToNonAtomic"
+	NonAtomicToAtomic        CastKind = "NonAtomicToAtomic"
 )
 
 type (
@@ -222,6 +229,8 @@ type Node struct {
 	StorageClass         StorageClass  `json:"storageClass,omitempty"`
 	TagUsed              string        `json:"tagUsed,omitempty"` // struct | union
 	HasElse              bool          `json:"hasElse,omitempty"`
+	AssociationKind      string        `json:"associationKind,omitempty"` // case | default (of _Generic)
+	Selected             bool          `json:"selected,omitempty"`        // is this _Generic association selected
 	CompleteDefinition   bool          `json:"completeDefinition,omitempty"`
 	Complicated          bool          `json:"-"` // complicated statement
 	Variadic             bool          `json:"variadic,omitempty"`
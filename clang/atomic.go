@@ -0,0 +1,115 @@
+package clang
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// -----------------------------------------------------------------------------
+
+// sync/atomic has no 8-bit and 16-bit operations, so the functions below
+// complement it: they work on the aligned 32-bit word that contains the value,
+// with compare-and-swap. Their names and signatures mirror sync/atomic ones.
+
+var bigEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 0
+}()
+
+// subword locates a 1 or 2-byte value inside its aligned 32-bit word.
+type subword struct {
+	word  *uint32
+	shift uint
+	mask  uint32
+}
+
+func subwordOf(addr unsafe.Pointer, size uintptr) subword {
+	off := uintptr(addr) & 3
+	shift := uint(off * 8)
+	if bigEndian {
+		shift = uint((4 - size - off) * 8)
+	}
+	word := (*uint32)(unsafe.Add(addr, -int(off)))
+	return subword{word, shift, uint32(1<<(size*8)-1) << shift}
+}
+
+func (p subword) load() uint32 {
+	return (atomic.LoadUint32(p.word) & p.mask) >> p.shift
+}
+
+// update replaces the value v with f(v) and returns the old value.
+func (p subword) update(f func(v uint32) uint32) uint32 {
+	for {
+		w := atomic.LoadUint32(p.word)
+		old := (w & p.mask) >> p.shift
+		if atomic.CompareAndSwapUint32(p.word, w, w&^p.mask|(f(old)<<p.shift)&p.mask) {
+			return old
+		}
+	}
+}
+
+func (p subword) compareAndSwap(old, new uint32) bool {
+	for {
+		w := atomic.LoadUint32(p.word)
+		if (w&p.mask)>>p.shift != old {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(p.word, w, w&^p.mask|(new<<p.shift)&p.mask) {
+			return true
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func LoadUint8(addr *uint8) uint8 {
+	return uint8(subwordOf(unsafe.Pointer(addr), 1).load())
+}
+
+func StoreUint8(addr *uint8, val uint8) {
+	SwapUint8(addr, val)
+}
+
+func SwapUint8(addr *uint8, new uint8) (old uint8) {
+	return uint8(subwordOf(unsafe.Pointer(addr), 1).update(func(uint32) uint32 {
+		return uint32(new)
+	}))
+}
+
+func CompareAndSwapUint8(addr *uint8, old, new uint8) (swapped bool) {
+	return subwordOf(unsafe.Pointer(addr), 1).compareAndSwap(uint32(old), uint32(new))
+}
+
+func AddUint8(addr *uint8, delta uint8) (new uint8) {
+	return uint8(subwordOf(unsafe.Pointer(addr), 1).update(func(v uint32) uint32 {
+		return v + uint32(delta)
+	})) + delta
+}
+
+// -----------------------------------------------------------------------------
+
+func LoadUint16(addr *uint16) uint16 {
+	return uint16(subwordOf(unsafe.Pointer(addr), 2).load())
+}
+
+func StoreUint16(addr *uint16, val uint16) {
+	SwapUint16(addr, val)
+}
+
+func SwapUint16(addr *uint16, new uint16) (old uint16) {
+	return uint16(subwordOf(unsafe.Pointer(addr), 2).update(func(uint32) uint32 {
+		return uint32(new)
+	}))
+}
+
+func CompareAndSwapUint16(addr *uint16, old, new uint16) (swapped bool) {
+	return subwordOf(unsafe.Pointer(addr), 2).compareAndSwap(uint32(old), uint32(new))
+}
+
+func AddUint16(addr *uint16, delta uint16) (new uint16) {
+	return uint16(subwordOf(unsafe.Pointer(addr), 2).update(func(v uint32) uint32 {
+		return v + uint32(delta)
+	})) + delta
+}
+
+// -----------------------------------------------------------------------------
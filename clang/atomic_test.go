@@ -0,0 +1,39 @@
+package clang
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAtomicSubword(t *testing.T) {
+	var mem struct {
+		b [4]uint8
+		h [2]uint16
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 1000; n++ {
+				AddUint8(&mem.b[i], 1)
+				AddUint16(&mem.h[i&1], 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if mem.b != [4]uint8{1000 & 0xff, 1000 & 0xff, 1000 & 0xff, 1000 & 0xff} || mem.h != [2]uint16{2000, 2000} {
+		t.Fatal("Add:", mem.b, mem.h)
+	}
+	if old := SwapUint8(&mem.b[1], 7); old != 1000&0xff || LoadUint8(&mem.b[1]) != 7 || mem.b[0] != 1000&0xff {
+		t.Fatal("SwapUint8:", old, mem.b)
+	}
+	if CompareAndSwapUint16(&mem.h[0], 1, 2) || !CompareAndSwapUint16(&mem.h[0], 2000, 3) || LoadUint16(&mem.h[0]) != 3 {
+		t.Fatal("CompareAndSwapUint16:", mem.h)
+	}
+	StoreUint8(&mem.b[3], 0xff)
+	StoreUint16(&mem.h[1], 0xffff)
+	if AddUint8(&mem.b[3], 1) != 0 || AddUint16(&mem.h[1], 2) != 1 || mem.b[2] != 1000&0xff || mem.h[0] != 3 {
+		t.Fatal("overflow:", mem.b, mem.h)
+	}
+}
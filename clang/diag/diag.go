@@ -0,0 +1,100 @@
+package diag
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+
+type Severity string
+
+const (
+	Note    Severity = "note"
+	Remark  Severity = "remark"
+	Warning Severity = "warning"
+	Error   Severity = "error"
+	Fatal   Severity = "fatal error"
+)
+
+// Diagnostic represents a diagnostic message of clang, such as:
+//
+//	foo.c:3:10: error: use of undeclared identifier 'y'
+type Diagnostic struct {
+	File     string // empty if the diagnostic has no location
+	Line     int    // 1-based, 0 if unknown
+	Column   int    // 1-based, 0 if unknown
+	Severity Severity
+	Message  string
+	Option   string        // option controlling the diagnostic, eg. -Wunused-variable
+	Notes    []*Diagnostic // notes attached to the diagnostic
+}
+
+func (p *Diagnostic) String() string {
+	var b strings.Builder
+	if p.File != "" {
+		b.WriteString(p.File)
+		if p.Line > 0 {
+			fmt.Fprintf(&b, ":%d", p.Line)
+			if p.Column > 0 {
+				fmt.Fprintf(&b, ":%d", p.Column)
+			}
+		}
+		b.WriteString(": ")
+	}
+	b.WriteString(string(p.Severity))
+	b.WriteString(": ")
+	b.WriteString(p.Message)
+	if p.Option != "" {
+		b.WriteString(" [" + p.Option + "]")
+	}
+	return b.String()
+}
+
+// IsError checks if this is an error or a fatal error.
+func (p *Diagnostic) IsError() bool {
+	return p.Severity == Error || p.Severity == Fatal
+}
+
+var (
+	diagRE   = regexp.MustCompile(`^(?:(.+?):(\d+):(?:(\d+):)?|[^\s:]+:)? ?(fatal error|error|warning|note|remark): (.*)$`)
+	optionRE = regexp.MustCompile(` \[(-W[^\]]+)\]$`)
+)
+
+// Parse parses diagnostics of clang in its standard output format:
+//
+//	file:line:col: severity: message [option]
+//
+// Source lines and carets are skipped. A note is attached to the previous
+// diagnostic which isn't a note.
+func Parse(stderr []byte) (diags []*Diagnostic) {
+	var last *Diagnostic
+	scanner := bufio.NewScanner(bytes.NewReader(stderr))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		m := diagRE.FindStringSubmatch(strings.TrimRight(scanner.Text(), "\r"))
+		if m == nil {
+			continue
+		}
+		d := &Diagnostic{File: m[1], Severity: Severity(m[4]), Message: m[5]}
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Column, _ = strconv.Atoi(m[3])
+		if opt := optionRE.FindStringSubmatchIndex(d.Message); opt != nil {
+			d.Option = d.Message[opt[2]:opt[3]]
+			d.Message = d.Message[:opt[0]]
+		}
+		if d.Severity == Note && last != nil {
+			last.Notes = append(last.Notes, d)
+			continue
+		}
+		diags = append(diags, d)
+		last = d
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,41 @@
+package diag
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	diags := Parse([]byte(`In file included from foo.c:1:
+./foo.h:3:5: warning: unused variable 'x' [-Wunused-variable]
+    int x;
+        ^
+foo.c:5:21: error: use of undeclared identifier 'y'
+int main(){ int x = y; }
+                    ^
+foo.c:2:6: note: previous definition is here
+void f(void);
+     ^
+foo.c:7:10: fatal error: 'nope.h' file not found
+#include "nope.h"
+         ^~~~~~~~
+clang: error: no input files
+2 errors generated.
+`))
+	if len(diags) != 4 {
+		t.Fatal("Parse:", diags)
+	}
+	if d := diags[0]; d.File != "./foo.h" || d.Line != 3 || d.Column != 5 || d.Severity != Warning ||
+		d.Message != "unused variable 'x'" || d.Option != "-Wunused-variable" || d.IsError() {
+		t.Fatal("Parse:", d)
+	}
+	if d := diags[1]; d.String() != "foo.c:5:21: error: use of undeclared identifier 'y'" || !d.IsError() ||
+		len(d.Notes) != 1 || d.Notes[0].String() != "foo.c:2:6: note: previous definition is here" {
+		t.Fatal("Parse:", d, d.Notes)
+	}
+	if d := diags[2]; d.Severity != Fatal || d.Line != 7 || d.Message != "'nope.h' file not found" || !d.IsError() {
+		t.Fatal("Parse:", d)
+	}
+	if d := diags[3]; d.File != "" || d.Line != 0 || d.String() != "error: no input files" {
+		t.Fatal("Parse:", d)
+	}
+}
@@ -0,0 +1,519 @@
+package clang
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// -----------------------------------------------------------------------------
+
+// floatFormat describes an IEEE-like binary floating point format.
+type floatFormat struct {
+	prec uint // bits of significand, including the integer bit
+	emax int  // biased exponent of Inf and NaN
+}
+
+func (p floatFormat) bias() int {
+	return p.emax >> 1
+}
+
+func (p floatFormat) newFloat() *big.Float {
+	return new(big.Float).SetPrec(p.prec).SetMode(big.ToNearestEven)
+}
+
+// decode returns value of a finite number, whose significand is an integer
+// (including the integer bit).
+func (p floatFormat) decode(neg bool, exp int, sig *big.Int) *big.Float {
+	if exp == 0 { // zero or subnormal
+		exp = 1
+	}
+	x := p.newFloat().SetInt(sig)
+	x.SetMantExp(x, exp-p.bias()-int(p.prec-1))
+	if neg {
+		x.Neg(x)
+	}
+	return x
+}
+
+// encode rounds x to the format. It returns the biased exponent and the
+// significand (including the integer bit). exp is p.emax if x overflows.
+func (p floatFormat) encode(x *big.Float) (neg bool, exp int, sig *big.Int) {
+	neg, sig = x.Signbit(), new(big.Int)
+	if x.IsInf() {
+		return neg, p.emax, sig
+	}
+	if x.Sign() == 0 {
+		return
+	}
+	v := p.newFloat().Abs(x) // rounded to p.prec bits
+	exp = v.MantExp(nil) - 1 + p.bias()
+	if exp >= p.emax {
+		return neg, p.emax, sig
+	}
+	if exp <= 0 { // subnormal: round to less bits
+		bits := int(p.prec) - 1 + exp
+		if bits <= 0 {
+			half := new(big.Float).SetMantExp(big.NewFloat(1), 1-p.bias()-int(p.prec))
+			if v.Cmp(half) > 0 {
+				sig.SetInt64(1)
+			}
+		} else {
+			v.SetPrec(uint(bits)) // rounds to nearest even
+			v.SetMantExp(v, p.bias()+int(p.prec)-2)
+			v.Int(sig)
+		}
+		if sig.BitLen() == int(p.prec) { // rounded up to a normal number
+			return neg, 1, sig
+		}
+		return neg, 0, sig
+	}
+	v.SetMantExp(v, int(p.prec)-v.MantExp(nil))
+	v.Int(sig)
+	return
+}
+
+type bigOp = func(z, x, y *big.Float) *big.Float
+
+// binaryOp returns x op y. A nil *big.Float means NaN.
+func (p floatFormat) binaryOp(x, y *big.Float, op bigOp) (z *big.Float) {
+	if x == nil || y == nil {
+		return nil
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			if _, ok := e.(big.ErrNaN); !ok {
+				panic(e)
+			}
+			z = nil // Inf-Inf, 0*Inf, 0/0, Inf/Inf
+		}
+	}()
+	return op(p.newFloat(), x, y)
+}
+
+func cmpFloat(x, y *big.Float) (int, bool) {
+	if x == nil || y == nil {
+		return 0, false
+	}
+	return x.Cmp(y), true
+}
+
+// toInt64 truncates x toward zero. If x is NaN or out of range, it returns
+// MinInt64 like x86 does.
+func toInt64(x *big.Float) int64 {
+	if x == nil || x.IsInf() || x.MantExp(nil) > 63 {
+		return math.MinInt64
+	}
+	v, _ := x.Int64()
+	return v
+}
+
+func toUint64(x *big.Float) uint64 {
+	if x == nil {
+		return 0
+	}
+	if x.Sign() < 0 {
+		return uint64(toInt64(x))
+	}
+	v, _ := x.Uint64()
+	return v
+}
+
+// toInt128 truncates x toward zero. If x is NaN or out of range, it returns
+// the minimum Int128 like toInt64 does.
+func toInt128(x *big.Float) Int128 {
+	if x == nil || x.IsInf() || x.MantExp(nil) > 127 {
+		return Int128{Hi: 1 << 63}
+	}
+	v, _ := x.Int(nil)
+	if v.Sign() < 0 {
+		return Int128(uint128FromBig(v.Neg(v))).Neg()
+	}
+	return Int128(uint128FromBig(v))
+}
+
+func toUint128(x *big.Float) Uint128 {
+	if x == nil {
+		return Uint128{}
+	}
+	if x.Sign() < 0 {
+		return Uint128(toInt128(x))
+	}
+	if x.IsInf() || x.MantExp(nil) > 128 {
+		return Uint128{Lo: math.MaxUint64, Hi: math.MaxUint64}
+	}
+	v, _ := x.Int(nil)
+	return uint128FromBig(v)
+}
+
+// uint128FromBig returns v, which is in range [0, 1<<128).
+func uint128FromBig(v *big.Int) Uint128 {
+	mask := new(big.Int).SetUint64(math.MaxUint64)
+	lo := new(big.Int).And(v, mask).Uint64()
+	return Uint128{Lo: lo, Hi: v.Rsh(v, 64).Uint64()}
+}
+
+func bigFromUint128(v Uint128) *big.Int {
+	x := new(big.Int).SetUint64(v.Hi)
+	return x.Lsh(x, 64).Or(x, new(big.Int).SetUint64(v.Lo))
+}
+
+func bigFromInt128(v Int128) *big.Int {
+	if v.Sign() < 0 {
+		x := bigFromUint128(v.abs())
+		return x.Neg(x)
+	}
+	return bigFromUint128(Uint128(v))
+}
+
+func toFloat64(x *big.Float) float64 {
+	if x == nil {
+		return math.NaN()
+	}
+	v, _ := x.Float64()
+	return v
+}
+
+func fromFloat64(p floatFormat, v float64) *big.Float {
+	if math.IsNaN(v) {
+		return nil
+	}
+	return p.newFloat().SetFloat64(v)
+}
+
+func formatFloat(s fmt.State, verb rune, x *big.Float) {
+	if x == nil {
+		w, _ := s.Width()
+		fmt.Fprintf(s, "%*s", w, "NaN")
+		return
+	}
+	x.Format(s, verb)
+}
+
+// -----------------------------------------------------------------------------
+
+var f80 = floatFormat{prec: 64, emax: 0x7fff}
+
+// Float80 represents C long double of x87, an 80-bit extended precision float
+// with an explicit integer bit. Its layout matches the one in memory on x86.
+type Float80 struct {
+	Lo uint64 // significand
+	Hi uint16 // sign and biased exponent
+}
+
+func float80FromBig(x *big.Float) Float80 {
+	if x == nil {
+		return Float80{Lo: 0xc000000000000000, Hi: 0x7fff} // quiet NaN
+	}
+	neg, exp, sig := f80.encode(x)
+	ret := Float80{Hi: uint16(exp)}
+	if exp == f80.emax {
+		ret.Lo = 1 << 63 // Inf
+	} else {
+		ret.Lo = sig.Uint64()
+	}
+	if neg {
+		ret.Hi |= 0x8000
+	}
+	return ret
+}
+
+// big returns value of x. It returns nil if x is NaN.
+func (x Float80) big() *big.Float {
+	neg, exp := x.Hi&0x8000 != 0, int(x.Hi&0x7fff)
+	if exp == f80.emax {
+		if x.Lo<<1 != 0 {
+			return nil
+		}
+		return new(big.Float).SetInf(neg)
+	}
+	return f80.decode(neg, exp, new(big.Int).SetUint64(x.Lo))
+}
+
+func Float80FromFloat64(v float64) Float80 {
+	return float80FromBig(fromFloat64(f80, v))
+}
+
+func Float80FromInt64(v int64) Float80 {
+	return float80FromBig(f80.newFloat().SetInt64(v))
+}
+
+func Float80FromUint64(v uint64) Float80 {
+	return float80FromBig(f80.newFloat().SetUint64(v))
+}
+
+func Float80FromInt128(v Int128) Float80 {
+	return float80FromBig(f80.newFloat().SetInt(bigFromInt128(v)))
+}
+
+func Float80FromUint128(v Uint128) Float80 {
+	return float80FromBig(f80.newFloat().SetInt(bigFromUint128(v)))
+}
+
+// ParseFloat80 converts s, a decimal or hexadecimal floating point number, into
+// the nearest Float80.
+func ParseFloat80(s string) (Float80, error) {
+	x, _, err := f80.newFloat().Parse(s, 0)
+	if err != nil {
+		return Float80{}, err
+	}
+	return float80FromBig(x), nil
+}
+
+func (x Float80) Add(y Float80) Float80 {
+	return float80FromBig(f80.binaryOp(x.big(), y.big(), (*big.Float).Add))
+}
+
+func (x Float80) Sub(y Float80) Float80 {
+	return float80FromBig(f80.binaryOp(x.big(), y.big(), (*big.Float).Sub))
+}
+
+func (x Float80) Mul(y Float80) Float80 {
+	return float80FromBig(f80.binaryOp(x.big(), y.big(), (*big.Float).Mul))
+}
+
+func (x Float80) Quo(y Float80) Float80 {
+	return float80FromBig(f80.binaryOp(x.big(), y.big(), (*big.Float).Quo))
+}
+
+func (x Float80) Neg() Float80 {
+	return Float80{x.Lo, x.Hi ^ 0x8000}
+}
+
+func (x Float80) Eq(y Float80) bool {
+	ret, ok := cmpFloat(x.big(), y.big())
+	return ok && ret == 0
+}
+
+func (x Float80) Ne(y Float80) bool {
+	return !x.Eq(y)
+}
+
+func (x Float80) Lt(y Float80) bool {
+	ret, ok := cmpFloat(x.big(), y.big())
+	return ok && ret < 0
+}
+
+func (x Float80) Le(y Float80) bool {
+	ret, ok := cmpFloat(x.big(), y.big())
+	return ok && ret <= 0
+}
+
+func (x Float80) Gt(y Float80) bool {
+	return y.Lt(x)
+}
+
+func (x Float80) Ge(y Float80) bool {
+	return y.Le(x)
+}
+
+func (x Float80) IsZero() bool {
+	return x.Lo == 0 && x.Hi&0x7fff == 0
+}
+
+func (x Float80) IsNaN() bool {
+	return x.Hi&0x7fff == 0x7fff && x.Lo<<1 != 0
+}
+
+// Int64 truncates x toward zero.
+func (x Float80) Int64() int64 {
+	return toInt64(x.big())
+}
+
+// Uint64 truncates x toward zero.
+func (x Float80) Uint64() uint64 {
+	return toUint64(x.big())
+}
+
+// Int128 truncates x toward zero.
+func (x Float80) Int128() Int128 {
+	return toInt128(x.big())
+}
+
+// Uint128 truncates x toward zero.
+func (x Float80) Uint128() Uint128 {
+	return toUint128(x.big())
+}
+
+func (x Float80) Float64() float64 {
+	return toFloat64(x.big())
+}
+
+// Format implements fmt.Formatter, so %e, %f and %g of fmt print x in full
+// precision.
+func (x Float80) Format(s fmt.State, verb rune) {
+	formatFloat(s, verb, x.big())
+}
+
+func (x Float80) String() string {
+	return fmt.Sprint(x)
+}
+
+// -----------------------------------------------------------------------------
+
+var f128 = floatFormat{prec: 113, emax: 0x7fff}
+
+// Float128 represents C long double of IEEE 754 binary128, such as the one on
+// linux/arm64.
+type Float128 struct {
+	Lo, Hi uint64
+}
+
+const (
+	f128FracHi = 1<<48 - 1 // fraction bits in Hi
+)
+
+func float128FromBig(x *big.Float) Float128 {
+	if x == nil {
+		return Float128{Hi: 0x7fff800000000000} // quiet NaN
+	}
+	neg, exp, sig := f128.encode(x)
+	var ret Float128
+	if exp != f128.emax {
+		ret.Lo = sig.Uint64()
+		ret.Hi = sig.Rsh(sig, 64).Uint64() & f128FracHi
+	}
+	ret.Hi |= uint64(exp) << 48
+	if neg {
+		ret.Hi |= 1 << 63
+	}
+	return ret
+}
+
+// big returns value of x. It returns nil if x is NaN.
+func (x Float128) big() *big.Float {
+	neg, exp, frac := x.Hi>>63 != 0, int(x.Hi>>48&0x7fff), x.Hi&f128FracHi
+	if exp == f128.emax {
+		if frac != 0 || x.Lo != 0 {
+			return nil
+		}
+		return new(big.Float).SetInf(neg)
+	}
+	if exp != 0 {
+		frac |= 1 << 48 // integer bit
+	}
+	sig := new(big.Int).SetUint64(frac)
+	sig.Lsh(sig, 64).Or(sig, new(big.Int).SetUint64(x.Lo))
+	return f128.decode(neg, exp, sig)
+}
+
+func Float128FromFloat64(v float64) Float128 {
+	return float128FromBig(fromFloat64(f128, v))
+}
+
+func Float128FromInt64(v int64) Float128 {
+	return float128FromBig(f128.newFloat().SetInt64(v))
+}
+
+func Float128FromUint64(v uint64) Float128 {
+	return float128FromBig(f128.newFloat().SetUint64(v))
+}
+
+func Float128FromInt128(v Int128) Float128 {
+	return float128FromBig(f128.newFloat().SetInt(bigFromInt128(v)))
+}
+
+func Float128FromUint128(v Uint128) Float128 {
+	return float128FromBig(f128.newFloat().SetInt(bigFromUint128(v)))
+}
+
+// ParseFloat128 converts s, a decimal or hexadecimal floating point number,
+// into the nearest Float128.
+func ParseFloat128(s string) (Float128, error) {
+	x, _, err := f128.newFloat().Parse(s, 0)
+	if err != nil {
+		return Float128{}, err
+	}
+	return float128FromBig(x), nil
+}
+
+func (x Float128) Add(y Float128) Float128 {
+	return float128FromBig(f128.binaryOp(x.big(), y.big(), (*big.Float).Add))
+}
+
+func (x Float128) Sub(y Float128) Float128 {
+	return float128FromBig(f128.binaryOp(x.big(), y.big(), (*big.Float).Sub))
+}
+
+func (x Float128) Mul(y Float128) Float128 {
+	return float128FromBig(f128.binaryOp(x.big(), y.big(), (*big.Float).Mul))
+}
+
+func (x Float128) Quo(y Float128) Float128 {
+	return float128FromBig(f128.binaryOp(x.big(), y.big(), (*big.Float).Quo))
+}
+
+func (x Float128) Neg() Float128 {
+	return Float128{x.Lo, x.Hi ^ 1<<63}
+}
+
+func (x Float128) Eq(y Float128) bool {
+	ret, ok := cmpFloat(x.big(), y.big())
+	return ok && ret == 0
+}
+
+func (x Float128) Ne(y Float128) bool {
+	return !x.Eq(y)
+}
+
+func (x Float128) Lt(y Float128) bool {
+	ret, ok := cmpFloat(x.big(), y.big())
+	return ok && ret < 0
+}
+
+func (x Float128) Le(y Float128) bool {
+	ret, ok := cmpFloat(x.big(), y.big())
+	return ok && ret <= 0
+}
+
+func (x Float128) Gt(y Float128) bool {
+	return y.Lt(x)
+}
+
+func (x Float128) Ge(y Float128) bool {
+	return y.Le(x)
+}
+
+func (x Float128) IsZero() bool {
+	return x.Lo == 0 && x.Hi<<1 == 0
+}
+
+func (x Float128) IsNaN() bool {
+	return x.Hi>>48&0x7fff == 0x7fff && (x.Hi&f128FracHi != 0 || x.Lo != 0)
+}
+
+// Int64 truncates x toward zero.
+func (x Float128) Int64() int64 {
+	return toInt64(x.big())
+}
+
+// Uint64 truncates x toward zero.
+func (x Float128) Uint64() uint64 {
+	return toUint64(x.big())
+}
+
+// Int128 truncates x toward zero.
+func (x Float128) Int128() Int128 {
+	return toInt128(x.big())
+}
+
+// Uint128 truncates x toward zero.
+func (x Float128) Uint128() Uint128 {
+	return toUint128(x.big())
+}
+
+func (x Float128) Float64() float64 {
+	return toFloat64(x.big())
+}
+
+// Format implements fmt.Formatter, so %e, %f and %g of fmt print x in full
+// precision.
+func (x Float128) Format(s fmt.State, verb rune) {
+	formatFloat(s, verb, x.big())
+}
+
+func (x Float128) String() string {
+	return fmt.Sprint(x)
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,86 @@
+package clang
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestFloat80(t *testing.T) {
+	third := Float80FromInt64(1).Quo(Float80FromInt64(3))
+	if third != (Float80{0xaaaaaaaaaaaaaaab, 0x3ffd}) {
+		t.Fatalf("1/3: %#x %#x\n", third.Lo, third.Hi)
+	}
+	v, err := ParseFloat80("1.1")
+	if err != nil || v != (Float80{0x8ccccccccccccccd, 0x3fff}) {
+		t.Fatalf("ParseFloat80(1.1): %#x %#x %v\n", v.Lo, v.Hi, err)
+	}
+	if s := fmt.Sprintf("%.20f", v); s != "1.10000000000000000002" {
+		t.Fatal("Format:", s)
+	}
+	if v.Float64() != 1.1 || Float80FromFloat64(0.1).Float64() != 0.1 {
+		t.Fatal("Float64:", v.Float64())
+	}
+	zero := Float80{}
+	inf, nan := Float80FromInt64(1).Quo(zero), zero.Quo(zero)
+	if !math.IsInf(inf.Float64(), 1) || !math.IsInf(inf.Neg().Float64(), -1) {
+		t.Fatal("Inf:", inf)
+	}
+	if !nan.IsNaN() || nan.Eq(nan) || !nan.Ne(nan) || nan.Lt(zero) || nan.Ge(zero) {
+		t.Fatal("NaN:", nan)
+	}
+	if inf.Int64() != math.MinInt64 || Float80FromFloat64(1e30).Int64() != math.MinInt64 {
+		t.Fatal("Int64: out of range")
+	}
+	if v := Float80FromInt64(-7).Quo(Float80FromInt64(2)); v.Int64() != -3 || !v.Lt(zero) {
+		t.Fatal("Int64:", v)
+	}
+	if v := Float80FromUint64(math.MaxUint64); v.Uint64() != math.MaxUint64 {
+		t.Fatal("Uint64:", v)
+	}
+	if v, _ := ParseFloat80("1e-4940"); v.Hi != 0 || v.Lo == 0 || v.IsZero() {
+		t.Fatalf("subnormal: %#x %#x\n", v.Lo, v.Hi)
+	}
+}
+
+func TestFloat128(t *testing.T) {
+	third := Float128FromInt64(1).Quo(Float128FromInt64(3))
+	if third != (Float128{0x5555555555555555, 0x3ffd555555555555}) {
+		t.Fatalf("1/3: %#x %#x\n", third.Lo, third.Hi)
+	}
+	v, err := ParseFloat128("1.1")
+	if err != nil || v != (Float128{0x999999999999999a, 0x3fff199999999999}) {
+		t.Fatalf("ParseFloat128(1.1): %#x %#x %v\n", v.Lo, v.Hi, err)
+	}
+	if v.Float64() != 1.1 || !v.Lt(Float128FromFloat64(1.1)) {
+		t.Fatal("Float64:", v)
+	}
+	zero := Float128{}
+	inf, nan := Float128FromInt64(-1).Quo(zero), zero.Quo(zero)
+	if !math.IsInf(inf.Float64(), -1) || !nan.IsNaN() || nan.Eq(nan) {
+		t.Fatal("Inf/NaN:", inf, nan)
+	}
+	if s := fmt.Sprint(Float128FromInt64(5).Mul(Float128FromFloat64(0.5))); s != "2.5" {
+		t.Fatal("String:", s)
+	}
+	if v := Float128FromInt64(math.MinInt64); v.Int64() != math.MinInt64 || !v.Neg().Gt(zero) {
+		t.Fatal("Int64:", v)
+	}
+}
+
+func TestFloatInt128(t *testing.T) {
+	big := Int128{Lo: 1, Hi: 1 << 48} // needs 113 bits
+	if v := Float128FromInt128(big.Neg()); v.Int128() != big.Neg() {
+		t.Fatal("Float128FromInt128:", v)
+	}
+	if v := Float80FromInt128(big); v.Int128() != (Int128{Hi: 1 << 48}) {
+		t.Fatal("Float80FromInt128: not rounded -", v)
+	}
+	max := Uint128{Lo: math.MaxUint64, Hi: math.MaxUint64}
+	if v := Float128FromUint128(max); v.Uint128() != max || v.Int128() != (Int128{Hi: 1 << 63}) {
+		t.Fatal("Float128FromUint128:", v)
+	}
+	if v := Float80FromFloat64(-2.5); v.Int128() != Int128FromInt64(-2) || v.Uint128() != Uint128FromInt64(-2) {
+		t.Fatal("Int128:", v)
+	}
+}
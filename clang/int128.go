@@ -0,0 +1,305 @@
+package clang
+
+import (
+	"math"
+	"math/bits"
+)
+
+// -----------------------------------------------------------------------------
+
+// Uint128 represents C unsigned __int128.
+type Uint128 struct {
+	Lo, Hi uint64
+}
+
+func Uint128FromUint64(v uint64) Uint128 {
+	return Uint128{Lo: v}
+}
+
+func Uint128FromInt64(v int64) Uint128 {
+	return Uint128{Lo: uint64(v), Hi: uint64(v >> 63)}
+}
+
+func Uint128FromFloat64(v float64) Uint128 {
+	if v < 1<<64 {
+		return Uint128{Lo: uint64(v)}
+	}
+	frac, exp := math.Frexp(v)
+	return Uint128{Lo: uint64(frac * (1 << 53))}.Lsh(uint(exp - 53))
+}
+
+func (x Uint128) Add(y Uint128) Uint128 {
+	lo, carry := bits.Add64(x.Lo, y.Lo, 0)
+	hi, _ := bits.Add64(x.Hi, y.Hi, carry)
+	return Uint128{lo, hi}
+}
+
+func (x Uint128) Sub(y Uint128) Uint128 {
+	lo, borrow := bits.Sub64(x.Lo, y.Lo, 0)
+	hi, _ := bits.Sub64(x.Hi, y.Hi, borrow)
+	return Uint128{lo, hi}
+}
+
+func (x Uint128) Mul(y Uint128) Uint128 {
+	hi, lo := bits.Mul64(x.Lo, y.Lo)
+	hi += x.Hi*y.Lo + x.Lo*y.Hi
+	return Uint128{lo, hi}
+}
+
+// QuoRem returns x/y and x%y. It panics if y is zero.
+func (x Uint128) QuoRem(y Uint128) (q, r Uint128) {
+	if y.Hi == 0 {
+		var rem uint64
+		if x.Hi < y.Lo {
+			q.Lo, rem = bits.Div64(x.Hi, x.Lo, y.Lo)
+		} else {
+			q.Hi, rem = bits.Div64(0, x.Hi, y.Lo)
+			q.Lo, rem = bits.Div64(rem, x.Lo, y.Lo)
+		}
+		return q, Uint128{Lo: rem}
+	}
+	// see Hacker's Delight, 9-5: divlu
+	n := uint(bits.LeadingZeros64(y.Hi))
+	x1 := x.Rsh(1)
+	tq, _ := bits.Div64(x1.Hi, x1.Lo, y.Lsh(n).Hi)
+	tq >>= 63 - n
+	if tq != 0 {
+		tq--
+	}
+	q = Uint128{Lo: tq}
+	r = x.Sub(y.Mul(q))
+	if r.Cmp(y) >= 0 {
+		q = q.Add(Uint128{Lo: 1})
+		r = r.Sub(y)
+	}
+	return
+}
+
+func (x Uint128) Quo(y Uint128) Uint128 {
+	q, _ := x.QuoRem(y)
+	return q
+}
+
+func (x Uint128) Rem(y Uint128) Uint128 {
+	_, r := x.QuoRem(y)
+	return r
+}
+
+func (x Uint128) And(y Uint128) Uint128 {
+	return Uint128{x.Lo & y.Lo, x.Hi & y.Hi}
+}
+
+func (x Uint128) Or(y Uint128) Uint128 {
+	return Uint128{x.Lo | y.Lo, x.Hi | y.Hi}
+}
+
+func (x Uint128) Xor(y Uint128) Uint128 {
+	return Uint128{x.Lo ^ y.Lo, x.Hi ^ y.Hi}
+}
+
+func (x Uint128) Not() Uint128 {
+	return Uint128{^x.Lo, ^x.Hi}
+}
+
+func (x Uint128) Neg() Uint128 {
+	return Uint128{}.Sub(x)
+}
+
+func (x Uint128) Lsh(n uint) Uint128 {
+	if n >= 64 {
+		return Uint128{Hi: x.Lo << (n - 64)}
+	}
+	return Uint128{x.Lo << n, x.Hi<<n | x.Lo>>(64-n)}
+}
+
+func (x Uint128) Rsh(n uint) Uint128 {
+	if n >= 64 {
+		return Uint128{Lo: x.Hi >> (n - 64)}
+	}
+	return Uint128{x.Lo>>n | x.Hi<<(64-n), x.Hi >> n}
+}
+
+// Cmp returns -1 if x < y, 0 if x == y, and +1 if x > y.
+func (x Uint128) Cmp(y Uint128) int {
+	switch {
+	case x.Hi < y.Hi:
+		return -1
+	case x.Hi > y.Hi:
+		return 1
+	case x.Lo < y.Lo:
+		return -1
+	case x.Lo > y.Lo:
+		return 1
+	}
+	return 0
+}
+
+func (x Uint128) IsZero() bool {
+	return x.Lo == 0 && x.Hi == 0
+}
+
+func (x Uint128) Int128() Int128 {
+	return Int128(x)
+}
+
+// Uint64 returns the low 64 bits of x. Use it to convert x to a narrower
+// integer type.
+func (x Uint128) Uint64() uint64 {
+	return x.Lo
+}
+
+func (x Uint128) Float64() float64 {
+	if x.Hi == 0 {
+		return float64(x.Lo)
+	}
+	n := uint(bits.LeadingZeros64(x.Hi))
+	m := x.Lsh(n)
+	if m.Lo != 0 { // sticky bit, for correct rounding
+		m.Hi |= 1
+	}
+	return math.Ldexp(float64(m.Hi), int(64-n))
+}
+
+// -----------------------------------------------------------------------------
+
+// Int128 represents C __int128 in two's complement.
+type Int128 struct {
+	Lo, Hi uint64
+}
+
+func Int128FromUint64(v uint64) Int128 {
+	return Int128{Lo: v}
+}
+
+func Int128FromInt64(v int64) Int128 {
+	return Int128{Lo: uint64(v), Hi: uint64(v >> 63)}
+}
+
+func Int128FromFloat64(v float64) Int128 {
+	if v < 0 {
+		return Int128(Uint128FromFloat64(-v).Neg())
+	}
+	return Int128(Uint128FromFloat64(v))
+}
+
+func (x Int128) Add(y Int128) Int128 {
+	return Int128(Uint128(x).Add(Uint128(y)))
+}
+
+func (x Int128) Sub(y Int128) Int128 {
+	return Int128(Uint128(x).Sub(Uint128(y)))
+}
+
+func (x Int128) Mul(y Int128) Int128 {
+	return Int128(Uint128(x).Mul(Uint128(y)))
+}
+
+// QuoRem returns x/y and x%y like C does: the quotient is truncated toward
+// zero. It panics if y is zero.
+func (x Int128) QuoRem(y Int128) (q, r Int128) {
+	uq, ur := x.abs().QuoRem(y.abs())
+	q, r = Int128(uq), Int128(ur)
+	if x.Sign() < 0 {
+		r = r.Neg()
+		if y.Sign() >= 0 {
+			q = q.Neg()
+		}
+	} else if y.Sign() < 0 {
+		q = q.Neg()
+	}
+	return
+}
+
+func (x Int128) Quo(y Int128) Int128 {
+	q, _ := x.QuoRem(y)
+	return q
+}
+
+func (x Int128) Rem(y Int128) Int128 {
+	_, r := x.QuoRem(y)
+	return r
+}
+
+func (x Int128) And(y Int128) Int128 {
+	return Int128{x.Lo & y.Lo, x.Hi & y.Hi}
+}
+
+func (x Int128) Or(y Int128) Int128 {
+	return Int128{x.Lo | y.Lo, x.Hi | y.Hi}
+}
+
+func (x Int128) Xor(y Int128) Int128 {
+	return Int128{x.Lo ^ y.Lo, x.Hi ^ y.Hi}
+}
+
+func (x Int128) Not() Int128 {
+	return Int128{^x.Lo, ^x.Hi}
+}
+
+func (x Int128) Neg() Int128 {
+	return Int128(Uint128(x).Neg())
+}
+
+func (x Int128) Lsh(n uint) Int128 {
+	return Int128(Uint128(x).Lsh(n))
+}
+
+// Rsh is an arithmetic shift, like C does on signed integers with gcc/clang.
+func (x Int128) Rsh(n uint) Int128 {
+	if n >= 64 {
+		return Int128{uint64(int64(x.Hi) >> (n - 64)), uint64(int64(x.Hi) >> 63)}
+	}
+	return Int128{x.Lo>>n | x.Hi<<(64-n), uint64(int64(x.Hi) >> n)}
+}
+
+// Cmp returns -1 if x < y, 0 if x == y, and +1 if x > y.
+func (x Int128) Cmp(y Int128) int {
+	if x.Hi != y.Hi {
+		if int64(x.Hi) < int64(y.Hi) {
+			return -1
+		}
+		return 1
+	}
+	return Uint128(x).Cmp(Uint128(y))
+}
+
+// Sign returns -1 if x < 0, 0 if x == 0, and +1 if x > 0.
+func (x Int128) Sign() int {
+	if int64(x.Hi) < 0 {
+		return -1
+	}
+	if x.IsZero() {
+		return 0
+	}
+	return 1
+}
+
+func (x Int128) IsZero() bool {
+	return x.Lo == 0 && x.Hi == 0
+}
+
+func (x Int128) Uint128() Uint128 {
+	return Uint128(x)
+}
+
+// Uint64 returns the low 64 bits of x. Use it to convert x to a narrower
+// integer type.
+func (x Int128) Uint64() uint64 {
+	return x.Lo
+}
+
+func (x Int128) Float64() float64 {
+	if x.Sign() < 0 {
+		return -Uint128(x.Neg()).Float64()
+	}
+	return Uint128(x).Float64()
+}
+
+func (x Int128) abs() Uint128 {
+	if x.Sign() < 0 {
+		return Uint128(x.Neg())
+	}
+	return Uint128(x)
+}
+
+// -----------------------------------------------------------------------------
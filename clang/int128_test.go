@@ -0,0 +1,121 @@
+package clang
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+var (
+	two128 = new(big.Int).Lsh(big.NewInt(1), 128)
+	two127 = new(big.Int).Lsh(big.NewInt(1), 127)
+)
+
+func (x Uint128) big() *big.Int {
+	v := new(big.Int).SetUint64(x.Hi)
+	return v.Lsh(v, 64).Or(v, new(big.Int).SetUint64(x.Lo))
+}
+
+func (x Int128) big() *big.Int {
+	v := Uint128(x).big()
+	if v.Cmp(two127) >= 0 {
+		v.Sub(v, two128)
+	}
+	return v
+}
+
+func wrapU(v *big.Int) *big.Int {
+	return v.Mod(v, two128)
+}
+
+func wrapI(v *big.Int) *big.Int {
+	if v = wrapU(v); v.Cmp(two127) >= 0 {
+		v.Sub(v, two128)
+	}
+	return v
+}
+
+func randU128(r *rand.Rand) Uint128 {
+	x := Uint128{r.Uint64(), r.Uint64()}
+	switch r.Intn(4) { // test small values too
+	case 0:
+		x.Hi = 0
+	case 1:
+		x.Hi = uint64(r.Intn(3))
+	case 2:
+		x.Hi, x.Lo = ^uint64(0), ^uint64(r.Intn(3))
+	}
+	return x
+}
+
+func TestUint128(t *testing.T) {
+	r := rand.New(rand.NewSource(128))
+	for i := 0; i < 10000; i++ {
+		x, y := randU128(r), randU128(r)
+		bx, by := x.big(), y.big()
+		n := uint(r.Intn(130))
+		check := func(op string, ret Uint128, expected *big.Int) {
+			if ret.big().Cmp(wrapU(expected)) != 0 {
+				t.Fatalf("%v %s %v (n = %d): got %v, expected %v\n", bx, op, by, n, ret.big(), expected)
+			}
+		}
+		check("+", x.Add(y), new(big.Int).Add(bx, by))
+		check("-", x.Sub(y), new(big.Int).Sub(bx, by))
+		check("*", x.Mul(y), new(big.Int).Mul(bx, by))
+		check("&", x.And(y), new(big.Int).And(bx, by))
+		check("<<", x.Lsh(n), new(big.Int).Lsh(bx, n))
+		check(">>", x.Rsh(n), new(big.Int).Rsh(bx, n))
+		check("neg", x.Neg(), new(big.Int).Neg(bx))
+		if !y.IsZero() {
+			check("/", x.Quo(y), new(big.Int).Quo(bx, by))
+			check("%", x.Rem(y), new(big.Int).Rem(bx, by))
+		}
+		if x.Cmp(y) != bx.Cmp(by) {
+			t.Fatal("Cmp:", bx, by)
+		}
+		if f, _ := new(big.Float).SetInt(bx).Float64(); x.Float64() != f {
+			t.Fatal("Float64:", bx, x.Float64(), f)
+		}
+		if x.Hi < 1<<52 { // exactly representable if x < 2^116
+			if v := Uint128FromFloat64(x.Float64()); v.Hi != x.Hi {
+				t.Fatal("Uint128FromFloat64:", bx, v.big())
+			}
+		}
+	}
+}
+
+func TestInt128(t *testing.T) {
+	r := rand.New(rand.NewSource(-128))
+	for i := 0; i < 10000; i++ {
+		x, y := Int128(randU128(r)), Int128(randU128(r))
+		bx, by := x.big(), y.big()
+		n := uint(r.Intn(130))
+		check := func(op string, ret Int128, expected *big.Int) {
+			if ret.big().Cmp(wrapI(expected)) != 0 {
+				t.Fatalf("%v %s %v (n = %d): got %v, expected %v\n", bx, op, by, n, ret.big(), expected)
+			}
+		}
+		check("+", x.Add(y), new(big.Int).Add(bx, by))
+		check("-", x.Sub(y), new(big.Int).Sub(bx, by))
+		check("*", x.Mul(y), new(big.Int).Mul(bx, by))
+		check("^", x.Xor(y), new(big.Int).Xor(bx, by))
+		check("<<", x.Lsh(n), new(big.Int).Lsh(bx, n))
+		check(">>", x.Rsh(n), new(big.Int).Rsh(bx, n))
+		if !y.IsZero() {
+			check("/", x.Quo(y), new(big.Int).Quo(bx, by))
+			check("%", x.Rem(y), new(big.Int).Rem(bx, by))
+		}
+		if x.Cmp(y) != bx.Cmp(by) || x.Sign() != bx.Sign() {
+			t.Fatal("Cmp:", bx, by)
+		}
+		if f, _ := new(big.Float).SetInt(bx).Float64(); x.Float64() != f {
+			t.Fatal("Float64:", bx, x.Float64(), f)
+		}
+	}
+	if v := Int128FromInt64(-5); v.big().Int64() != -5 || int64(v.Uint64()) != -5 {
+		t.Fatal("Int128FromInt64:", v)
+	}
+	if v := Int128FromFloat64(-1e30); v.Float64() != -1e30 {
+		t.Fatal("Int128FromFloat64:", v.big())
+	}
+}
@@ -0,0 +1,255 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+const (
+	cacheFormat = "c2go-ast-gob-3" // change it if ast.Node changes
+)
+
+// DefaultCacheDir returns the default directory of AST cache: ~/.c2go/cache.
+func DefaultCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".c2go", "cache")
+}
+
+var (
+	clangVer     string
+	clangVerErr  error
+	clangVerOnce sync.Once
+)
+
+func clangVersion() (string, error) {
+	clangVerOnce.Do(func() {
+		var out []byte
+		out, clangVerErr = exec.Command("clang", "--version").Output()
+		clangVer = string(out)
+	})
+	return clangVer, clangVerErr
+}
+
+// cacheFile returns the cache file of AST of filename. Its name is hash of
+// content of filename, clang version and flags.
+func cacheFile(filename string, conf *Config) (string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	ver, err := clangVersion()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(b)
+	fmt.Fprintf(h, "\x00%s\x00%s\x00%s\x00%s", cacheFormat, ver, conf.Target, strings.Join(conf.Flags, "\x00"))
+	return filepath.Join(conf.CacheDir, hex.EncodeToString(h.Sum(nil))+".gob"), nil
+}
+
+// An AST cache file is a gob stream of cacheRecords: the TranslationUnitDecl
+// node without its inner decls, the inner decls one by one and then output of
+// clang to stderr. So it can be read and written while streaming (see
+// ParseFileStream).
+type cacheRecord struct {
+	Node    *ast.Node // nil in the last record
+	Warning []byte    // output of clang to stderr, only in the last record
+}
+
+func loadCache(file string) (doc *ast.Node, warning []byte, ok bool) {
+	var inner []*ast.Node
+	doc, warning, err := readCache(file, func(decl *ast.Node) error {
+		inner = append(inner, decl)
+		return nil
+	})
+	if doc == nil || err != nil {
+		return nil, nil, false
+	}
+	doc.Inner = inner
+	return doc, warning, true
+}
+
+// readCache reads the cache file and calls fn for each inner decl. It returns
+// nil tu if the cache file doesn't exist or is broken.
+func readCache(file string, fn func(decl *ast.Node) error) (tu *ast.Node, warning []byte, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, nil
+	}
+	defer f.Close()
+	dec := gob.NewDecoder(f)
+	var rec cacheRecord
+	if dec.Decode(&rec) != nil || rec.Node == nil {
+		return nil, nil, nil
+	}
+	tu = rec.Node
+	for {
+		rec = cacheRecord{}
+		if err = dec.Decode(&rec); err != nil {
+			if err == io.EOF { // no last record
+				err = io.ErrUnexpectedEOF
+			}
+			return tu, nil, &ParseError{Err: err}
+		}
+		if rec.Node == nil {
+			return tu, rec.Warning, nil
+		}
+		if err = fn(rec.Node); err != nil {
+			return
+		}
+	}
+}
+
+func saveCache(file string, doc *ast.Node, warning []byte) error {
+	w, err := newCacheWriter(file)
+	if err != nil {
+		return err
+	}
+	tu := *doc
+	tu.Inner = nil
+	w.encode(&tu)
+	for _, decl := range doc.Inner {
+		w.encode(decl)
+	}
+	return w.commit(warning)
+}
+
+// cachedWarning returns warning stored in the cache as DumpAST does: it is
+// printed to os.Stderr instead if conf.Stderr is set.
+func cachedWarning(filename string, conf *Config, warning []byte) []byte {
+	if conf.Stderr && !skipErr(filename) {
+		os.Stderr.Write(warning)
+		return nil
+	}
+	return warning
+}
+
+// trimNode returns a copy of node without the fields c2go doesn't read, to
+// keep cache files small. node isn't changed.
+func trimNode(node *ast.Node) *ast.Node {
+	if node == nil {
+		return nil
+	}
+	ret := *node
+	ret.ReferencedMemberDecl = ""
+	ret.PreviousDecl = ""
+	ret.ParentDeclContextID = ""
+	ret.IsReferenced = false
+	ret.IsArrow = false
+	ret.IsPartOfExplicitCast = false
+	ret.Inline = false
+	ret.AssociationKind = ""
+	ret.CC = ""
+	ret.Decl = nil
+	if loc := node.Loc; loc != nil {
+		ret.Loc = trimLoc(loc)
+	}
+	if rg := node.Range; rg != nil {
+		ret.Range = &ast.Range{Begin: trimPos(rg.Begin), End: trimPos(rg.End)}
+	}
+	if t := node.Type; t != nil && t.TypeAliasDeclID != "" {
+		ret.Type = &ast.Type{QualType: t.QualType, DesugaredQualType: t.DesugaredQualType}
+	}
+	ret.Field = trimNode(node.Field)
+	ret.OwnedTagDecl = trimNode(node.OwnedTagDecl)
+	ret.ReferencedDecl = trimNode(node.ReferencedDecl)
+	ret.Inner = trimNodes(node.Inner)
+	ret.ArrayFiller = trimNodes(node.ArrayFiller)
+	return &ret
+}
+
+func trimNodes(nodes []*ast.Node) []*ast.Node {
+	if nodes == nil {
+		return nil
+	}
+	ret := make([]*ast.Node, len(nodes))
+	for i, node := range nodes {
+		ret[i] = trimNode(node)
+	}
+	return ret
+}
+
+func trimLoc(loc *ast.Loc) *ast.Loc {
+	ret := *loc
+	ret.IncludedFrom = nil
+	return &ret
+}
+
+func trimPos(pos ast.Pos) ast.Pos {
+	pos.IncludedFrom = nil
+	pos.SpellingLoc = nil
+	if loc := pos.ExpansionLoc; loc != nil {
+		pos.ExpansionLoc = trimLoc(loc)
+	}
+	return pos
+}
+
+type cacheWriter struct {
+	f   *os.File
+	enc *gob.Encoder
+	err error
+
+	file string
+}
+
+func newCacheWriter(file string) (*cacheWriter, error) {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "ast-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &cacheWriter{f: f, enc: gob.NewEncoder(f), file: file}, nil
+}
+
+func (p *cacheWriter) encode(node *ast.Node) {
+	if p.err == nil {
+		p.err = p.enc.Encode(&cacheRecord{Node: trimNode(node)})
+	}
+}
+
+// commit writes warning as the last record and moves the cache file to its
+// place if all records are encoded successfully. Otherwise, it removes the
+// cache file.
+func (p *cacheWriter) commit(warning []byte) error {
+	if p.err == nil {
+		p.err = p.enc.Encode(&cacheRecord{Warning: warning})
+	}
+	tmpfile := p.f.Name()
+	err := p.err
+	if e := p.f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmpfile, p.file)
+	}
+	if err != nil {
+		os.Remove(tmpfile)
+	}
+	return err
+}
+
+// abort removes the cache file.
+func (p *cacheWriter) abort() {
+	p.f.Close()
+	os.Remove(p.f.Name())
+}
+
+// -----------------------------------------------------------------------------
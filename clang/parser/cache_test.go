@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/goplus/c2go/clang/ast"
+)
+
+func TestCacheRoundTrip(t *testing.T) {
+	loc := &ast.Loc{Offset: 4, File: "foo.c", Line: 1, Col: 5, TokLen: 3, IncludedFrom: &ast.IncludedFrom{File: "bar.c"}}
+	doc := &ast.Node{
+		Kind: ast.TranslationUnitDecl,
+		Inner: []*ast.Node{{
+			ID: "0x1", Kind: ast.FunctionDecl, Name: "foo", Loc: loc, PreviousDecl: "0x2", IsReferenced: true,
+			Range: &ast.Range{Begin: ast.Pos{Offset: 0, TokLen: 3, SpellingLoc: loc}, End: ast.Pos{Offset: 8}},
+			Type:  &ast.Type{QualType: "int (int)", TypeAliasDeclID: "0x3"},
+			Inner: []*ast.Node{{Kind: ast.ParmVarDecl, Name: "a", IsUsed: true, Value: "1"}},
+		}, {
+			Kind: ast.VarDecl, Name: "bar", Init: "c", CC: "cdecl",
+		}},
+	}
+	file := filepath.Join(t.TempDir(), "foo.gob")
+	if err := saveCache(file, doc, []byte("warning: foo\n")); err != nil {
+		t.Fatal("saveCache:", err)
+	}
+	ret, warning, ok := loadCache(file)
+	if !ok || string(warning) != "warning: foo\n" {
+		t.Fatal("loadCache:", ok, string(warning))
+	}
+	expected := &ast.Node{
+		Kind: ast.TranslationUnitDecl,
+		Inner: []*ast.Node{{
+			ID: "0x1", Kind: ast.FunctionDecl, Name: "foo",
+			Loc:   &ast.Loc{Offset: 4, File: "foo.c", Line: 1, Col: 5, TokLen: 3},
+			Range: &ast.Range{Begin: ast.Pos{Offset: 0, TokLen: 3}, End: ast.Pos{Offset: 8}},
+			Type:  &ast.Type{QualType: "int (int)"},
+			Inner: []*ast.Node{{Kind: ast.ParmVarDecl, Name: "a", IsUsed: true, Value: "1"}},
+		}, {
+			Kind: ast.VarDecl, Name: "bar", Init: "c",
+		}},
+	}
+	if !reflect.DeepEqual(ret, expected) {
+		t.Fatal("loadCache:", ret)
+	}
+	if doc.Inner[0].PreviousDecl != "0x2" || doc.Inner[0].Type.TypeAliasDeclID != "0x3" || loc.IncludedFrom == nil {
+		t.Fatal("saveCache: doc is changed")
+	}
+
+	var names []string
+	tu, warning, err := readCache(file, func(decl *ast.Node) error {
+		names = append(names, decl.Name)
+		return nil
+	})
+	if err != nil || tu == nil || tu.Inner != nil || string(warning) != "warning: foo\n" {
+		t.Fatal("readCache:", tu, string(warning), err)
+	}
+	if !reflect.DeepEqual(names, []string{"foo", "bar"}) {
+		t.Fatal("readCache:", names)
+	}
+}
+
+func TestBrokenCache(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, ok := loadCache(filepath.Join(dir, "none.gob")); ok {
+		t.Fatal("loadCache: no cache file")
+	}
+	file := filepath.Join(dir, "foo.gob")
+	os.WriteFile(file, []byte("not a gob"), 0666)
+	if _, _, ok := loadCache(file); ok {
+		t.Fatal("loadCache: broken cache file")
+	}
+
+	doc := &ast.Node{Kind: ast.TranslationUnitDecl, Inner: []*ast.Node{{Kind: ast.VarDecl, Name: "foo"}}}
+	if err := saveCache(file, doc, nil); err != nil {
+		t.Fatal("saveCache:", err)
+	}
+	b, _ := os.ReadFile(file)
+	for _, n := range []int{len(b) / 2, len(b) - 1} { // truncated
+		os.WriteFile(file, b[:n], 0666)
+		if _, _, ok := loadCache(file); ok {
+			t.Fatal("loadCache: truncated cache file", n)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatal("saveCache: temp file is left")
+	}
+}
+
+func TestCacheFile(t *testing.T) {
+	dir := t.TempDir()
+	infile := filepath.Join(dir, "foo.c")
+	os.WriteFile(infile, []byte("int foo;\n"), 0666)
+	conf := &Config{CacheDir: dir, Flags: []string{"-DFOO"}}
+	cachefile, err := cacheFile(infile, conf)
+	if err != nil {
+		t.Skip("cacheFile:", err)
+	}
+	if filepath.Dir(cachefile) != dir {
+		t.Fatal("cacheFile:", cachefile)
+	}
+	if f, _ := cacheFile(infile, &Config{CacheDir: dir, Flags: []string{"-DFOO"}}); f != cachefile {
+		t.Fatal("cacheFile: not stable")
+	}
+	for _, c := range []*Config{
+		{CacheDir: dir, Flags: []string{"-DBAR"}},
+		{CacheDir: dir, Flags: []string{"-DFOO"}, Target: "x86_64-pc-windows-msvc"},
+	} {
+		if f, _ := cacheFile(infile, c); f == cachefile {
+			t.Fatal("cacheFile: same for", c.Flags, c.Target)
+		}
+	}
+	os.WriteFile(infile, []byte("int bar;\n"), 0666)
+	if f, _ := cacheFile(infile, conf); f == cachefile {
+		t.Fatal("cacheFile: same for changed content")
+	}
+	if _, err = cacheFile(infile+".none", conf); !os.IsNotExist(err) {
+		t.Fatal("cacheFile:", err)
+	}
+}
+
+func TestParseFileCache(t *testing.T) {
+	dir := t.TempDir()
+	infile := filepath.Join(dir, "foo.c")
+	os.WriteFile(infile, []byte("#warning foo\nint foo(int a) { return a; }\n"), 0666)
+	conf := &Config{CacheDir: filepath.Join(dir, "cache")}
+	doc, warning, err := ParseFileEx(infile, 0, conf)
+	if err != nil {
+		t.Skip("ParseFileEx:", err)
+	}
+	if !bytes.Contains(warning, []byte("warning: foo")) {
+		t.Fatal("ParseFileEx:", string(warning))
+	}
+	cachefile, err := cacheFile(infile, conf)
+	if err != nil {
+		t.Fatal("cacheFile:", err)
+	}
+	cached, cachedWarning, ok := loadCache(cachefile)
+	if !ok || len(cached.Inner) != len(doc.Inner) {
+		t.Fatal("ParseFileEx: no cache")
+	}
+	doc2, warning2, err := ParseFileEx(infile, 0, conf)
+	if err != nil || !bytes.Equal(warning2, warning) || !bytes.Equal(cachedWarning, warning) {
+		t.Fatal("ParseFileEx: cache hit:", string(warning2), err)
+	}
+	if !reflect.DeepEqual(doc2, cached) {
+		t.Fatal("ParseFileEx: cache hit: different AST")
+	}
+
+	n := 0
+	_, warning3, err := ParseFileStream(infile, 0, conf, func(decl *ast.Node) error {
+		n++
+		return nil
+	})
+	if err != nil || n != len(doc.Inner) || !bytes.Equal(warning3, warning) {
+		t.Fatal("ParseFileStream: cache hit:", n, string(warning3), err)
+	}
+
+	conf = &Config{CacheDir: filepath.Join(dir, "cache2")}
+	if _, _, err = ParseFileStream(infile, 0, conf, func(decl *ast.Node) error { return nil }); err != nil {
+		t.Fatal("ParseFileStream:", err)
+	}
+	cachefile, _ = cacheFile(infile, conf)
+	if cached2, cachedWarning, ok := loadCache(cachefile); !ok || !bytes.Equal(cachedWarning, warning) || len(cached2.Inner) != len(cached.Inner) {
+		t.Fatal("ParseFileStream: no cache")
+	}
+}
@@ -2,11 +2,13 @@ package parser
 
 import (
 	"bytes"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/goplus/c2go/clang/ast"
+	"github.com/goplus/c2go/clang/diag"
 	jsoniter "github.com/json-iterator/go"
 )
 
@@ -16,7 +18,8 @@ type Mode uint
 
 type ParseError struct {
 	Err    error
-	Stderr []byte
+	Stderr []byte // nil if it has been printed to os.Stderr (see Config.Stderr)
+	Diags  []*diag.Diagnostic
 }
 
 func (p *ParseError) Error() string {
@@ -32,33 +35,79 @@ type Config struct {
 	Json   *[]byte
 	Flags  []string
 	Stderr bool
+	Target string // clang target triple, default: the host
+
+	// CacheDir specifies a directory to cache parsed AST (see DefaultCacheDir).
+	// No cache if empty. Cache isn't used if Json isn't nil.
+	CacheDir string
 }
 
 func DumpAST(filename string, conf *Config) (result []byte, warning []byte, err error) {
 	if conf == nil {
 		conf = new(Config)
 	}
-	skiperr := strings.HasSuffix(filename, "vfprintf.c.i")
+	result, stderr, err := dumpAST(filename, conf)
+	if err != nil {
+		return
+	}
+	return result, stderr.warning(), nil
+}
+
+func dumpAST(filename string, conf *Config) (result []byte, stderr *clangStderr, err error) {
 	stdout := NewPagedWriter()
-	stderr := new(bytes.Buffer)
+	stderr = new(clangStderr)
+	cmd, skiperr := dumpCmd(filename, conf, stderr)
+	cmd.Stdout = stdout
+	err = cmd.Run()
+	if err != nil && !skiperr {
+		return nil, nil, stderr.parseError(err)
+	}
+	return stdout.Bytes(), stderr, nil
+}
+
+// clangStderr collects output of clang to stderr.
+type clangStderr struct {
+	bytes.Buffer
+	printed bool // output is printed to os.Stderr as well
+}
+
+func (p *clangStderr) parseError(err error) *ParseError {
+	e := &ParseError{Err: err, Diags: diag.Parse(p.Bytes())}
+	if !p.printed {
+		e.Stderr = p.Bytes()
+	}
+	return e
+}
+
+func (p *clangStderr) warning() []byte {
+	if p.printed {
+		return nil
+	}
+	return p.Bytes()
+}
+
+func dumpCmd(filename string, conf *Config, stderr *clangStderr) (cmd *exec.Cmd, skiperr bool) {
+	skiperr = skipErr(filename)
 	args := []string{"-Xclang", "-ast-dump=json", "-fsyntax-only", filename}
 	if len(conf.Flags) != 0 {
 		args = append(conf.Flags, args...)
 	}
-	cmd := exec.Command("clang", args...)
+	if conf.Target != "" {
+		args = append([]string{"-target", conf.Target}, args...)
+	}
+	cmd = exec.Command("clang", args...)
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = stdout
 	if conf.Stderr && !skiperr {
-		cmd.Stderr = os.Stderr
+		stderr.printed = true
+		cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
 	} else {
 		cmd.Stderr = stderr
 	}
-	err = cmd.Run()
-	errmsg := stderr.Bytes()
-	if err != nil && !skiperr {
-		return nil, nil, &ParseError{Err: err, Stderr: errmsg}
-	}
-	return stdout.Bytes(), errmsg, nil
+	return
+}
+
+func skipErr(filename string) bool {
+	return strings.HasSuffix(filename, "vfprintf.c.i")
 }
 
 // -----------------------------------------------------------------------------
@@ -66,11 +115,28 @@ func DumpAST(filename string, conf *Config) (result []byte, warning []byte, err
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
 func ParseFileEx(filename string, mode Mode, conf *Config) (file *ast.Node, warning []byte, err error) {
-	out, warning, err := DumpAST(filename, conf)
+	if conf == nil {
+		conf = new(Config)
+	}
+	var stderr *clangStderr
+	if conf.CacheDir != "" && conf.Json == nil {
+		if cachefile, e := cacheFile(filename, conf); e == nil {
+			if doc, warning, ok := loadCache(cachefile); ok {
+				return doc, cachedWarning(filename, conf, warning), nil
+			}
+			defer func() {
+				if err == nil { // ignore errors: it's just a cache
+					saveCache(cachefile, file, stderr.Bytes())
+				}
+			}()
+		}
+	}
+	out, stderr, err := dumpAST(filename, conf)
 	if err != nil {
 		return
 	}
-	if conf != nil && conf.Json != nil {
+	warning = stderr.warning()
+	if conf.Json != nil {
 		*conf.Json = out
 	}
 	file = new(ast.Node)
@@ -81,6 +147,20 @@ func ParseFileEx(filename string, mode Mode, conf *Config) (file *ast.Node, warn
 	return
 }
 
+// ParseJSONFile parses a clang AST file in json format, such as the one dumped
+// via Config.Json. It doesn't run clang.
+func ParseJSONFile(filename string, mode Mode) (file *ast.Node, err error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	file = new(ast.Node)
+	if err = json.Unmarshal(b, file); err != nil {
+		return nil, &ParseError{Err: err}
+	}
+	return
+}
+
 func ParseFile(filename string, mode Mode) (file *ast.Node, warning []byte, err error) {
 	return ParseFileEx(filename, mode, nil)
 }
@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"io"
+	"os"
+
+	"github.com/goplus/c2go/clang/ast"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// -----------------------------------------------------------------------------
+
+const (
+	streamBufSize = 64 * 1024
+)
+
+// ParseFileStream is like ParseFileEx, but it doesn't buffer the whole output
+// of clang. It decodes inner decls of the TranslationUnitDecl one by one from
+// the clang pipe and calls fn for each of them in order, so peak memory is
+// bounded by the largest top-level decl. The returned file has no Inner decls.
+//
+// If fn returns an error, clang is killed and ParseFileStream returns the
+// error. conf.Json is ignored.
+func ParseFileStream(filename string, mode Mode, conf *Config, fn func(decl *ast.Node) error) (file *ast.Node, warning []byte, err error) {
+	if conf == nil {
+		conf = new(Config)
+	}
+	var cache *cacheWriter
+	stderr := new(clangStderr)
+	if conf.CacheDir != "" {
+		if cachefile, e := cacheFile(filename, conf); e == nil {
+			if file, warning, err = readCache(cachefile, fn); file != nil {
+				if err != nil {
+					return nil, nil, err
+				}
+				return file, cachedWarning(filename, conf, warning), nil
+			}
+			cache, _ = newCacheWriter(cachefile) // no cache if it fails
+		}
+	}
+	onTU, onDecl := func(tu *ast.Node) {}, fn
+	if cache != nil {
+		onTU = cache.encode
+		onDecl = func(decl *ast.Node) error {
+			cache.encode(decl)
+			return fn(decl)
+		}
+		defer func() {
+			if err == nil {
+				cache.commit(stderr.Bytes()) // ignore errors: it's just a cache
+			} else {
+				cache.abort()
+			}
+		}()
+	}
+
+	cmd, skiperr := dumpCmd(filename, conf, stderr)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, nil, &ParseError{Err: err}
+	}
+	file, err = decodeTU(stdout, onTU, onDecl)
+	if _, ok := err.(*ParseError); err != nil && !ok { // fn failed
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, nil, err
+	}
+	io.Copy(io.Discard, stdout)
+	errWait := cmd.Wait()
+	if errWait != nil && !skiperr {
+		return nil, nil, stderr.parseError(errWait)
+	}
+	warning = stderr.warning()
+	if err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+// ParseJSONStream is like ParseJSONFile, but it decodes inner decls of the
+// TranslationUnitDecl one by one and calls fn for each of them in order (see
+// ParseFileStream).
+func ParseJSONStream(filename string, mode Mode, fn func(decl *ast.Node) error) (file *ast.Node, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return decodeTU(f, func(tu *ast.Node) {}, fn)
+}
+
+// decodeTU decodes a TranslationUnitDecl from r. It calls onTU when all fields
+// but inner of the TranslationUnitDecl are decoded, and then fn for each of its
+// inner decls.
+func decodeTU(r io.Reader, onTU func(tu *ast.Node), fn func(decl *ast.Node) error) (tu *ast.Node, err error) {
+	iter := jsoniter.Parse(json, r, streamBufSize)
+	fields := make(map[string]jsoniter.RawMessage)
+	initTU := func() {
+		if tu != nil {
+			return
+		}
+		tu = new(ast.Node)
+		if b, e := json.Marshal(fields); e != nil {
+			err = &ParseError{Err: e}
+		} else if e = json.Unmarshal(b, tu); e != nil {
+			err = &ParseError{Err: e}
+		} else {
+			onTU(tu)
+		}
+	}
+	iter.ReadObjectCB(func(iter *jsoniter.Iterator, field string) bool {
+		if field != "inner" {
+			fields[field] = iter.SkipAndReturnBytes()
+			return iter.Error == nil
+		}
+		if initTU(); err != nil {
+			return false
+		}
+		iter.ReadArrayCB(func(iter *jsoniter.Iterator) bool {
+			decl := new(ast.Node)
+			if iter.ReadVal(decl); iter.Error != nil {
+				return false
+			}
+			err = fn(decl)
+			return err == nil
+		})
+		return err == nil && iter.Error == nil
+	})
+	if err != nil {
+		return
+	}
+	if iter.Error != nil {
+		return nil, &ParseError{Err: iter.Error}
+	}
+	initTU()
+	return
+}
+
+// -----------------------------------------------------------------------------
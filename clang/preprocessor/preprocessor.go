@@ -1,11 +1,15 @@
 package preprocessor
 
 import (
+	"bytes"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
+	"github.com/goplus/c2go/clang/diag"
 	"github.com/goplus/c2go/clang/pathutil"
 )
 
@@ -24,6 +28,24 @@ func SetDebug(flags int) {
 
 // -----------------------------------------------------------------------------
 
+// Error represents a failure of running the preprocessor. Its output to stderr
+// has been printed to os.Stderr, and Diags are parsed from it.
+type Error struct {
+	Err    error
+	Infile string
+	Diags  []*diag.Diagnostic
+}
+
+func (p *Error) Error() string {
+	return p.Err.Error()
+}
+
+func (p *Error) Unwrap() error {
+	return p.Err
+}
+
+// -----------------------------------------------------------------------------
+
 type Config struct {
 	Compiler    string // default: clang
 	PPFlag      string // default: -E
@@ -31,6 +53,15 @@ type Config struct {
 	IncludeDirs []string
 	Defines     []string
 	Flags       []string
+	Target      string // clang target triple, default: the host
+
+	// MacroFile specifies a file to dump all macro definitions into (by
+	// running clang -E -dD alongside the normal preprocessing). No dump if empty.
+	MacroFile string
+
+	// DepFile specifies a file to write dependency info (-MD -MF) into, see
+	// ReadDepFile. No dependency info if empty.
+	DepFile string
 }
 
 func Do(infile, outfile string, conf *Config) (err error) {
@@ -57,10 +88,33 @@ func Do(infile, outfile string, conf *Config) (err error) {
 	if ppflag == "" {
 		ppflag = "-E"
 	}
-	n := 4 + len(conf.Flags) + len(conf.IncludeDirs) + len(conf.Defines)
-	args := make([]string, 3, n)
-	args[0] = ppflag
-	args[1], args[2] = "-o", outfile
+	ppflags := []string{ppflag}
+	if depfile := conf.DepFile; depfile != "" {
+		if depfile, err = filepath.Abs(depfile); err != nil {
+			return
+		}
+		ppflags = append(ppflags, "-MD", "-MF", depfile)
+	}
+	if err = run(compiler, base, ppflags, infile, outfile, conf); err != nil {
+		return
+	}
+	if macrofile := conf.MacroFile; macrofile != "" {
+		if macrofile, err = filepath.Abs(macrofile); err != nil {
+			return
+		}
+		err = run(compiler, base, []string{"-E", "-dD"}, infile, macrofile, conf)
+	}
+	return
+}
+
+func run(compiler, base string, ppflags []string, infile, outfile string, conf *Config) error {
+	n := 5 + len(ppflags) + len(conf.Flags) + len(conf.IncludeDirs) + len(conf.Defines)
+	args := make([]string, 0, n)
+	args = append(args, ppflags...)
+	args = append(args, "-o", outfile)
+	if conf.Target != "" {
+		args = append(args, "-target", conf.Target)
+	}
 	args = append(args, conf.Flags...)
 	for _, def := range conf.Defines {
 		args = append(args, "-D"+def)
@@ -72,12 +126,57 @@ func Do(infile, outfile string, conf *Config) (err error) {
 	if debugExecCmd {
 		log.Println("==> runCmd:", compiler, args)
 	}
+	var stderr bytes.Buffer
 	cmd := exec.Command(compiler, args...)
 	cmd.Dir = filepath.Dir(infile)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		return &Error{Err: err, Infile: infile, Diags: diag.Parse(stderr.Bytes())}
+	}
+	return nil
+}
+
+// ReadDepFile reads a dependency file written by Do (see Config.DepFile) and
+// returns all files that the source file depends on (including itself).
+// Relative paths are related to directory of the source file.
+func ReadDepFile(depfile string) (deps []string, err error) {
+	b, err := os.ReadFile(depfile)
+	if err != nil {
+		return
+	}
+	text := string(b)
+	if pos := strings.Index(text, ": "); pos >= 0 { // skip `target: `
+		text = text[pos+2:]
+	}
+	var dep []byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '\\':
+			if i+1 < len(text) {
+				if next := text[i+1]; next == ' ' || next == '#' || next == '\\' {
+					dep = append(dep, next)
+					i++
+					continue
+				} else if next == '\n' || next == '\r' { // line continuation
+					continue
+				}
+			}
+			dep = append(dep, c)
+		case ' ', '\t', '\n', '\r':
+			if len(dep) > 0 {
+				deps = append(deps, string(dep))
+				dep = dep[:0]
+			}
+		default:
+			dep = append(dep, c)
+		}
+	}
+	if len(dep) > 0 {
+		deps = append(deps, string(dep))
+	}
+	return
 }
 
 // -----------------------------------------------------------------------------
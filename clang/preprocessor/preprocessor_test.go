@@ -0,0 +1,48 @@
+package preprocessor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadDepFile(t *testing.T) {
+	depfile := filepath.Join(t.TempDir(), "foo.c.d")
+	err := os.WriteFile(depfile, []byte(`foo.c.o: foo.c /usr/include/stdio.h \
+  ./my\ dir/bar.h a\#b.h \
+  c\\d.h
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps, err := ReadDepFile(depfile)
+	if err != nil {
+		t.Fatal("ReadDepFile:", err)
+	}
+	if expected := []string{"foo.c", "/usr/include/stdio.h", "./my dir/bar.h", "a#b.h", `c\d.h`}; !reflect.DeepEqual(deps, expected) {
+		t.Fatal("ReadDepFile:", deps)
+	}
+	if _, err = ReadDepFile(depfile + ".none"); !os.IsNotExist(err) {
+		t.Fatal("ReadDepFile:", err)
+	}
+}
+
+func TestDepFile(t *testing.T) {
+	dir := t.TempDir()
+	infile := filepath.Join(dir, "foo.c")
+	os.WriteFile(filepath.Join(dir, "foo.h"), []byte("int foo(void);\n"), 0666)
+	os.WriteFile(infile, []byte("#include \"foo.h\"\n"), 0666)
+	depfile := infile + ".d"
+	err := Do(infile, infile+".i", &Config{DepFile: depfile})
+	if err != nil {
+		t.Fatal("Do:", err)
+	}
+	deps, err := ReadDepFile(depfile)
+	if err != nil {
+		t.Fatal("ReadDepFile:", err)
+	}
+	if len(deps) != 2 || deps[0] != infile || filepath.Base(deps[1]) != "foo.h" {
+		t.Fatal("ReadDepFile:", deps)
+	}
+}
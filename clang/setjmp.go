@@ -0,0 +1,79 @@
+package clang
+
+import "unsafe"
+
+// -----------------------------------------------------------------------------
+
+// A LongJmp is the value longjmp(env, val) panics with. It's recovered by the
+// function which called setjmp(env), so that setjmp returns Val once more.
+type LongJmp struct {
+	Env unsafe.Pointer
+	Val int32
+}
+
+func (p *LongJmp) Error() string {
+	return "longjmp: jmp_buf isn't set by an active function"
+}
+
+// Longjmp implements longjmp(env, val).
+func Longjmp(env unsafe.Pointer, val int32) {
+	if val == 0 {
+		val = 1
+	}
+	panic(&LongJmp{Env: env, Val: val})
+}
+
+// A JmpFrame tracks the setjmp call sites (numbered from 1) of a function call.
+// The function body runs with `defer frame.Recover()`, and runs again from the
+// site which set env when a longjmp(env, val) is recovered.
+type JmpFrame struct {
+	envs  []unsafe.Pointer
+	sites []int
+	site  int // site to resume at, 0 if none
+	val   int32
+}
+
+// Setjmp implements setjmp(env) at site. It returns 0, or the value passed to
+// longjmp when the function body resumes at site.
+func (p *JmpFrame) Setjmp(env unsafe.Pointer, site int) (val int32) {
+	val, p.val = p.val, 0
+	for i, e := range p.envs {
+		if e == env {
+			p.sites[i] = site
+			return
+		}
+	}
+	p.envs = append(p.envs, env)
+	p.sites = append(p.sites, site)
+	return
+}
+
+// Recover recovers a LongJmp to a jmp_buf set by this function call, and panics
+// again with anything else.
+func (p *JmpFrame) Recover() {
+	if e := recover(); e != nil {
+		if jmp, ok := e.(*LongJmp); ok {
+			for i, env := range p.envs {
+				if env == jmp.Env {
+					p.site, p.val = p.sites[i], jmp.Val
+					return
+				}
+			}
+		}
+		panic(e)
+	}
+}
+
+// Resuming reports whether a LongJmp is recovered, so the function body should
+// run again.
+func (p *JmpFrame) Resuming() bool {
+	return p.site != 0
+}
+
+// Resume returns the site to resume at (0 if none), and clears it.
+func (p *JmpFrame) Resume() (site int) {
+	site, p.site = p.site, 0
+	return
+}
+
+// -----------------------------------------------------------------------------
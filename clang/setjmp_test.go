@@ -0,0 +1,44 @@
+package clang
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestJmpFrame(t *testing.T) {
+	var env, other [8]int64
+	var frame JmpFrame
+	var trace []int32
+	runs := 0
+	for {
+		func() {
+			defer frame.Recover()
+			runs++
+			switch frame.Resume() {
+			case 1:
+				goto site1
+			}
+		site1:
+			val := frame.Setjmp(unsafe.Pointer(&env), 1)
+			trace = append(trace, val)
+			if val < 3 {
+				Longjmp(unsafe.Pointer(&env), val+1)
+			}
+		}()
+		if !frame.Resuming() {
+			break
+		}
+	}
+	if runs != 4 || len(trace) != 4 || trace[0] != 0 || trace[1] != 1 || trace[3] != 3 {
+		t.Fatal("JmpFrame:", runs, trace)
+	}
+	defer func() {
+		if e, ok := recover().(*LongJmp); !ok || e.Env != unsafe.Pointer(&other) || e.Val != 1 {
+			t.Fatal("Recover:", e)
+		}
+	}()
+	func() {
+		defer frame.Recover()
+		Longjmp(unsafe.Pointer(&other), 0)
+	}()
+}
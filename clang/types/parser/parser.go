@@ -72,6 +72,9 @@ type Config struct {
 	Scope  *types.Scope
 	Anonym types.Type
 	Flags  int
+	Target *ctypes.Target // nil means the host
+
+	LongDouble types.Type // nil means ctypes.LongDouble
 }
 
 const (
@@ -85,6 +88,7 @@ const (
 //   - unsigned int
 //   - struct ConstantString
 //   - volatile uint32_t
+//   - _Atomic(int) *
 //   - int (*)(void *, int, char **, char **)
 //   - int (*)(const char *, ...)
 //   - int (*)(void)
@@ -196,7 +200,12 @@ func (p *parser) lookupType(tylit string, flags int) (t types.Type, err error) {
 	if o == nil {
 		return nil, &TypeNotFound{Literal: tylit, StructOrUnion: structOrUnion}
 	}
-	t = o.Type()
+	switch t = o.Type(); t {
+	case ctypes.Int128:
+		t = p.conf.Int128()
+	case ctypes.Uint128:
+		t = p.conf.Uint128()
+	}
 	if !structOrUnion && flags != 0 {
 		tt, ok := t.(*types.Basic)
 		if !ok {
@@ -221,7 +230,7 @@ func (p *parser) lookupType(tylit string, flags int) (t types.Type, err error) {
 		} else {
 			switch tt.Kind() {
 			case types.Int:
-				if t = intTypes[flags&^flagSigned]; t != nil {
+				if t = p.intType(flags &^ flagSigned); t != nil {
 					return
 				}
 			case types.Int8:
@@ -234,6 +243,9 @@ func (p *parser) lookupType(tylit string, flags int) (t types.Type, err error) {
 			case types.Float64:
 				switch flags {
 				case flagLong:
+					if p.conf.LongDouble != nil {
+						return p.conf.LongDouble, nil
+					}
 					return ctypes.LongDouble, nil
 				}
 			}
@@ -259,6 +271,18 @@ var intTypes = [...]types.Type{
 	flagShort | flagLong | flagLongLong | flagUnsigned: nil,
 }
 
+func (p *parser) intType(flags int) types.Type {
+	if target := p.conf.Target; target != nil {
+		switch flags {
+		case flagLong:
+			return target.Long()
+		case flagLong | flagUnsigned:
+			return target.Ulong()
+		}
+	}
+	return intTypes[flags]
+}
+
 func (p *parser) parseArray(t types.Type, inFlags int) (types.Type, error) {
 	var n int64
 	var err error
@@ -372,6 +396,18 @@ func (p *parser) parse(inFlags int) (t types.Type, kind int, err error) {
 			case "_Complex":
 				flags |= flagComplex
 			case "restrict", "_Nullable", "_Nonnull":
+			case "_Atomic": // _Atomic(T) is T: cl lowers accesses to it to sync/atomic
+				if p.peek() != token.LPAREN {
+					continue
+				}
+				p.next()
+				if t != nil {
+					return nil, 0, p.newError("illegal syntax: multiple types?")
+				}
+				if t, _, err = p.parse(0); err != nil {
+					return
+				}
+				continue
 			case "enum":
 				if err = p.expect(token.IDENT); err != nil {
 					return
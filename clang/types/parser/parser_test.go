@@ -120,6 +120,9 @@ var cases = []testCase{
 	{qualType: "struct ConstantString", typ: tyConstantString},
 	{qualType: "union arg", typ: tyArg},
 	{qualType: "volatile signed int", typ: tyInt},
+	{qualType: "_Atomic(int)", typ: tyInt},
+	{qualType: "_Atomic(unsigned long) *", typ: types.NewPointer(ctypes.Ulong)},
+	{qualType: "_Atomic(char *)", typ: tyCharPtr},
 	{qualType: "__int128", typ: tyInt128},
 	{qualType: "signed", typ: tyInt},
 	{qualType: "signed short", typ: tyInt16},
@@ -0,0 +1,158 @@
+package types
+
+import (
+	"errors"
+	"go/types"
+	"runtime"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+
+// A DataModel specifies sizes of long and pointers (int is always 32 bits).
+type DataModel int
+
+const (
+	LP64  DataModel = iota // long, pointers: 64 bits (64-bit Unix)
+	ILP32                  // int, long, pointers: 32 bits
+	LLP64                  // long: 32 bits, pointers: 64 bits (64-bit Windows)
+)
+
+func (p DataModel) String() string {
+	switch p {
+	case ILP32:
+		return "ILP32"
+	case LLP64:
+		return "LLP64"
+	}
+	return "LP64"
+}
+
+// Target represents the platform that C code is compiled for.
+type Target struct {
+	Triple string // clang target triple, eg. i386-pc-linux-gnu
+	GOARCH string // GOARCH of the generated Go code
+	GOOS   string // GOOS of the triple, empty if unknown (eg. bare metal)
+	Model  DataModel
+}
+
+var goarchs = []struct {
+	prefix string
+	goarch string
+	bits   int
+}{
+	{"x86_64", "amd64", 64},
+	{"amd64", "amd64", 64},
+	{"aarch64_be", "arm64be", 64},
+	{"aarch64", "arm64", 64},
+	{"arm64", "arm64", 64},
+	{"armeb", "armbe", 32},
+	{"arm", "arm", 32},
+	{"thumb", "arm", 32},
+	{"i386", "386", 32},
+	{"i486", "386", 32},
+	{"i586", "386", 32},
+	{"i686", "386", 32},
+	{"x86", "386", 32},
+	{"riscv64", "riscv64", 64},
+	{"powerpc64le", "ppc64le", 64},
+	{"ppc64le", "ppc64le", 64},
+	{"powerpc64", "ppc64", 64},
+	{"ppc64", "ppc64", 64},
+	{"mips64el", "mips64le", 64},
+	{"mips64", "mips64", 64},
+	{"mipsel", "mipsle", 32},
+	{"mips", "mips", 32},
+	{"s390x", "s390x", 64},
+	{"loongarch64", "loong64", 64},
+}
+
+var gooses = []struct {
+	prefix string
+	goos   string
+}{
+	{"android", "android"},
+	{"linux", "linux"},
+	{"windows", "windows"},
+	{"win32", "windows"},
+	{"mingw32", "windows"},
+	{"darwin", "darwin"},
+	{"macos", "darwin"},
+	{"freebsd", "freebsd"},
+	{"netbsd", "netbsd"},
+	{"openbsd", "openbsd"},
+	{"dragonfly", "dragonfly"},
+	{"solaris", "solaris"},
+}
+
+func goosOf(triple string) string {
+	parts := strings.Split(triple, "-")[1:]
+	for _, v := range gooses {
+		for _, part := range parts {
+			if strings.HasPrefix(part, v.prefix) {
+				return v.goos
+			}
+		}
+	}
+	return ""
+}
+
+// ParseTarget parses a clang target triple, such as x86_64-pc-windows-msvc.
+func ParseTarget(triple string) (*Target, error) {
+	arch, _, _ := strings.Cut(triple, "-")
+	for _, v := range goarchs {
+		if strings.HasPrefix(arch, v.prefix) {
+			if types.SizesFor("gc", v.goarch) == nil {
+				break
+			}
+			goos, model := goosOf(triple), LP64
+			if v.bits == 32 {
+				model = ILP32
+			} else if goos == "windows" {
+				model = LLP64
+			}
+			return &Target{Triple: triple, GOARCH: v.goarch, GOOS: goos, Model: model}, nil
+		}
+	}
+	return nil, errors.New("unsupported target: " + triple)
+}
+
+// Long returns Go type of C long.
+func (p *Target) Long() types.Type {
+	if p.Model == LP64 {
+		return types.Typ[types.Int64]
+	}
+	return types.Typ[types.Int32]
+}
+
+// Ulong returns Go type of C unsigned long.
+func (p *Target) Ulong() types.Type {
+	if p.Model == LP64 {
+		return types.Typ[types.Uint64]
+	}
+	return types.Typ[types.Uint32]
+}
+
+// BiggestAlign returns __BIGGEST_ALIGNMENT__ of the target, which is the
+// alignment of __attribute__((aligned)) without an argument.
+func (p *Target) BiggestAlign() int {
+	return biggestAlign(p.GOARCH)
+}
+
+// BiggestAlign is __BIGGEST_ALIGNMENT__ of the host.
+var BiggestAlign = biggestAlign(runtime.GOARCH)
+
+func biggestAlign(goarch string) int {
+	switch goarch {
+	case "arm", "armbe", "mips", "mipsle", "s390x":
+		return 8
+	}
+	return 16
+}
+
+// Sizes returns sizes of Go types on the target.
+func (p *Target) Sizes() types.Sizes {
+	return types.SizesFor("gc", p.GOARCH)
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,32 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	for _, c := range []struct {
+		triple, goarch, goos string
+		model                DataModel
+	}{
+		{"x86_64-pc-linux-gnu", "amd64", "linux", LP64},
+		{"x86_64-pc-windows-msvc", "amd64", "windows", LLP64},
+		{"x86_64-w64-mingw32", "amd64", "windows", LLP64},
+		{"aarch64-pc-win32", "arm64", "windows", LLP64},
+		{"i686-w64-mingw32", "386", "windows", ILP32},
+		{"aarch64-linux-android", "arm64", "android", LP64},
+		{"arm64-apple-macos", "arm64", "darwin", LP64},
+		{"arm-none-eabi", "arm", "", ILP32},
+	} {
+		p, err := ParseTarget(c.triple)
+		if err != nil {
+			t.Fatal("ParseTarget:", c.triple, err)
+		}
+		if p.Triple != c.triple || p.GOARCH != c.goarch || p.GOOS != c.goos || p.Model != c.model {
+			t.Fatal("ParseTarget:", c.triple, *p)
+		}
+	}
+	if _, err := ParseTarget("foo-bar"); err == nil {
+		t.Fatal("ParseTarget: no error for unsupported target")
+	}
+}
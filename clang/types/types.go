@@ -38,6 +38,19 @@ var (
 	Valist    types.Type = types.NewSlice(gogen.TyEmptyInterface)
 )
 
+// Int128 and Uint128 are placeholders of __int128 and unsigned __int128 in a
+// scope. The type parser replaces them with Config.Int128() and Uint128(), so
+// a runtime type of them can be imported lazily.
+var (
+	Int128  types.Type = newPlaceholder("__int128")
+	Uint128 types.Type = newPlaceholder("__uint128")
+)
+
+func newPlaceholder(name string) types.Type {
+	o := types.NewTypeName(token.NoPos, nil, name, nil)
+	return types.NewNamed(o, types.NewStruct(nil, nil), nil)
+}
+
 func init() {
 	vaTag := types.NewTypeName(token.NoPos, types.Unsafe, MangledName("struct", "__va_list_tag"), nil)
 	ValistTag = types.NewNamed(vaTag, types.NewStruct(nil, nil), nil)
@@ -11,7 +11,7 @@ import (
 )
 
 const (
-	ShortUsage = "c2go [-test -testmain -ff -pp -json -sel selectfile -gendeps -v] [pkgname] source\n"
+	ShortUsage = "c2go [-test -testmain -ff -pp -json -fromjson -nocache -stub -line -srcmap -sel selectfile -gendeps -v] [pkgname] source\n"
 )
 
 func isDir(name string) bool {
@@ -28,6 +28,11 @@ func Main(flag *flag.FlagSet, args []string) {
 		preprocess = flag.Bool("pp", false, "force to run preprocessor")
 		gendeps    = flag.Bool("gendeps", false, "generate dependencies automatically")
 		json       = flag.Bool("json", false, "dump C AST to a file in json format")
+		fromjson   = flag.Bool("fromjson", false, "compile from C AST dumped by -json instead of running clang")
+		nocache    = flag.Bool("nocache", false, "don't use the C AST cache (~/.c2go/cache)")
+		stub       = flag.Bool("stub", false, "emit a panic stub for functions failed to compile")
+		linedir    = flag.Bool("line", false, "emit //line directives that refer to C source")
+		srcmap     = flag.Bool("srcmap", false, "write a source map file (*.map.json) next to each Go file")
 		test       = flag.Bool("test", false, "run test")
 		testmain   = flag.Bool("testmain", false, "generate TestMain as entry instead of main (only for cmd/test_xxx)")
 		runcmd     = flag.String("run", "", "select a command to run (only available in project mode)")
@@ -69,6 +74,21 @@ func Main(flag *flag.FlagSet, args []string) {
 	if *json {
 		flags |= c2go.FlagDumpJson
 	}
+	if *fromjson {
+		flags |= c2go.FlagFromJson
+	}
+	if *nocache {
+		flags |= c2go.FlagNoASTCache
+	}
+	if *stub {
+		flags |= c2go.FlagFuncStub
+	}
+	if *linedir {
+		flags |= c2go.FlagLineDirective
+	}
+	if *srcmap {
+		flags |= c2go.FlagSourceMap
+	}
 	conf := &c2go.Config{
 		SelectFile: *selfile,
 		SelectCmd:  *runcmd,
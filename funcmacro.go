@@ -0,0 +1,434 @@
+/*
+ * Copyright (c) 2022 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package c2go
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/c2go/cl"
+	"github.com/goplus/c2go/clang/ast"
+	"github.com/goplus/c2go/clang/diag"
+	"github.com/goplus/c2go/clang/parser"
+	"github.com/goplus/c2go/clang/pathutil"
+	"github.com/goplus/c2go/clang/preprocessor"
+	"github.com/goplus/gogen"
+)
+
+const (
+	funcMacrosFile     = "c2go_macros.c"
+	macroProbePrefix   = "__c2go_probe_"
+	macroWrapperPrefix = "__c2go_macro_"
+	macroParamType     = "long"
+)
+
+// execFuncMacros translates function-like macros of public header files into
+// exported Go functions. For each macro, such as `#define MIN(a, b) ...`, it
+// synthesizes a wrapper C function:
+//
+//	T __c2go_macro_MIN(long a, long b) { return MIN(a, b); }
+//
+// where T is type of the macro body, and compiles these wrappers by cl into
+// the shared package. A parameter is of type long, unless the macro body passes
+// it to a function or macro whose parameter type is known (see inferParamTypes).
+// Macros whose bodies don't type-check as a C expression over their parameters
+// are skipped and reported.
+func execFuncMacros(conf *c2goConf, flags int) {
+	macros, incs := loadFuncMacros(conf)
+	if len(macros) == 0 {
+		return
+	}
+	dir, err := os.MkdirTemp("", "c2go")
+	check(err)
+	defer os.RemoveAll(dir)
+
+	infile := filepath.Join(dir, funcMacrosFile)
+	params, err := inferFuncMacroParams(infile, incs, macros, conf)
+	if err == nil {
+		var rets []string
+		macros, rets, err = probeFuncMacros(infile, incs, macros, params, conf)
+		if err == nil && len(macros) > 0 {
+			err = compileFuncMacros(infile, incs, macros, params, rets, conf, flags)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "c2go: skip function-like macros:", err)
+	}
+}
+
+// loadFuncMacros returns public function-like macros which aren't defined in
+// Go and header files where they are defined.
+func loadFuncMacros(conf *c2goConf) (macros []*cl.FuncMacro, incs []string) {
+	pubFrom := make([]string, len(conf.Public.From))
+	for i, from := range conf.Public.From {
+		pubFrom[i] = pathutil.Canonical(conf.dir, from)
+	}
+	ignored := make(map[string]bool)
+	for _, name := range conf.Source.Ignore.Names {
+		ignored[name] = true
+	}
+	scope := conf.Reused.Pkg().Types.Scope()
+	found := make(map[string]bool)
+	for _, file := range conf.macroFiles {
+		src, err := os.ReadFile(file)
+		check(err)
+		for _, m := range cl.FuncMacros(src, filepath.Dir(file), pubFrom) {
+			if found[m.Name] || ignored[m.Name] || isVariadicMacro(m) {
+				continue
+			}
+			found[m.Name] = true
+			if scope.Lookup(funcMacroGoName(conf, m.Name)) != nil {
+				continue
+			}
+			if !found[m.File] {
+				found[m.File] = true
+				incs = append(incs, m.File)
+			}
+			macros = append(macros, m)
+		}
+	}
+	return
+}
+
+func isVariadicMacro(m *cl.FuncMacro) bool {
+	n := len(m.Params)
+	return n > 0 && strings.HasSuffix(m.Params[n-1], "...")
+}
+
+func funcMacroGoName(conf *c2goConf, name string) string {
+	if goName := conf.public[name]; goName != "" {
+		return goName
+	}
+	return gogen.CPubName(name)
+}
+
+// inferFuncMacroParams returns parameter types of macros, keyed by macro name
+// (see inferParamTypes). Functions are looked up in header files incs.
+func inferFuncMacroParams(infile string, incs []string, macros []*cl.FuncMacro, conf *c2goConf) (
+	map[string][]string, error) {
+	var b bytes.Buffer
+	writeIncludes(&b, incs)
+	doc, _, err := preprocessAndParse(infile, b.Bytes(), conf)
+	if err != nil {
+		return nil, err
+	}
+	funcs := make(map[string][]string)
+	for _, decl := range doc.Inner {
+		if decl.Kind != ast.FunctionDecl {
+			continue
+		}
+		var params []string
+		for _, item := range decl.Inner {
+			if item.Kind == ast.ParmVarDecl {
+				params = append(params, paramType(item.Type.QualType))
+			}
+		}
+		funcs[decl.Name] = params
+	}
+	byName := make(map[string]*cl.FuncMacro, len(macros))
+	for _, m := range macros {
+		byName[m.Name] = m
+	}
+	params := make(map[string][]string, len(macros))
+	for _, m := range macros {
+		inferParamTypes(m, funcs, byName, params)
+	}
+	return params, nil
+}
+
+// paramType returns typ if it can be the type of a named parameter, or "".
+func paramType(typ string) string {
+	if strings.ContainsAny(typ, "([") { // function pointers, unnamed types
+		return ""
+	}
+	return typ
+}
+
+// inferParamTypes infers parameter types of macro m from calls in its body,
+// such as `fill(p)` or `(fill)((p))`: if p is a parameter of m, it's of the
+// type of the corresponding parameter of function or macro fill. Unknown
+// types are "". The result is stored in params, keyed by macro name.
+func inferParamTypes(m *cl.FuncMacro, funcs map[string][]string, macros map[string]*cl.FuncMacro,
+	params map[string][]string) []string {
+	if types, ok := params[m.Name]; ok {
+		return types
+	}
+	params[m.Name] = nil // in case of recursive macros
+	types := make([]string, len(m.Params))
+	toks := macroTokens(m.Body)
+	for i, tok := range toks {
+		if i+1 >= len(toks) || toks[i+1] != "(" || !isIdentToken(tok) {
+			continue
+		}
+		ptypes, ok := funcs[tok]
+		if !ok {
+			if callee := macros[tok]; callee != nil {
+				ptypes = inferParamTypes(callee, funcs, macros, params)
+			}
+		}
+		for k, arg := range macroArgs(toks[i+2:]) {
+			for len(arg) > 2 && arg[0] == "(" && arg[len(arg)-1] == ")" {
+				arg = arg[1 : len(arg)-1]
+			}
+			if k >= len(ptypes) || ptypes[k] == "" || len(arg) != 1 {
+				continue
+			}
+			for j, param := range m.Params {
+				if param == arg[0] && types[j] == "" {
+					types[j] = ptypes[k]
+				}
+			}
+		}
+	}
+	params[m.Name] = types
+	return types
+}
+
+// macroTokens splits body of a macro into tokens. It only cares about
+// identifiers and parentheses: other punctuations are single-char tokens, and
+// literals are single tokens.
+func macroTokens(body string) (toks []string) {
+	for i := 0; i < len(body); {
+		c := body[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case c == '"' || c == '\'':
+			for i++; i < len(body) && body[i] != c; i++ {
+				if body[i] == '\\' {
+					i++
+				}
+			}
+			i++
+		case isIdentChar(c): // identifiers and numbers
+			for i++; i < len(body) && (isIdentChar(body[i]) || body[i] == '.' && !isIdentToken(body[start:i])); i++ {
+			}
+		default:
+			i++
+		}
+		if i > len(body) {
+			i = len(body)
+		}
+		toks = append(toks, body[start:i])
+	}
+	return
+}
+
+// macroArgs returns arguments of a call, where toks follow the "(".
+func macroArgs(toks []string) (args [][]string) {
+	depth, start := 0, 0
+	for i, tok := range toks {
+		switch tok {
+		case "(":
+			depth++
+		case ")":
+			if depth == 0 {
+				if i > start {
+					args = append(args, toks[start:i])
+				}
+				return
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				args = append(args, toks[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return nil // unbalanced
+}
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+func isIdentToken(tok string) bool {
+	return isIdentChar(tok[0]) && (tok[0] < '0' || tok[0] > '9')
+}
+
+// probeFuncMacros finds out type of each macro body. It drops and reports
+// macros which fail to type-check, and returns the remaining ones.
+func probeFuncMacros(infile string, incs []string, macros []*cl.FuncMacro, params map[string][]string,
+	conf *c2goConf) (_ []*cl.FuncMacro, rets []string, err error) {
+	for len(macros) > 0 {
+		var b bytes.Buffer
+		base := writeIncludes(&b, incs)
+		for _, m := range macros {
+			fmt.Fprintf(&b, "void %s%s(%s) { (void)(%s); }\n",
+				macroProbePrefix, m.Name, macroParams(m, params[m.Name]), macroCall(m))
+		}
+		doc, diags, e := preprocessAndParse(infile, b.Bytes(), conf)
+		if e != nil {
+			if diags == nil {
+				return nil, nil, e
+			}
+			failed := errorLines(diags, funcMacrosFile)
+			n := 0
+			for i, m := range macros {
+				if d, ok := failed[base+i+1]; ok {
+					skipFuncMacro(m, d.Message)
+				} else {
+					macros[n] = m
+					n++
+				}
+			}
+			if n == len(macros) { // errors not in probe functions
+				return nil, nil, e
+			}
+			macros = macros[:n]
+			continue
+		}
+		type probe struct {
+			ret string
+			ok  bool
+		}
+		probes := make(map[string]probe)
+		for _, decl := range doc.Inner {
+			if decl.Kind == ast.FunctionDecl && strings.HasPrefix(decl.Name, macroProbePrefix) {
+				ret, ok := probeRetType(decl)
+				probes[decl.Name[len(macroProbePrefix):]] = probe{ret, ok}
+			}
+		}
+		n := 0
+		rets = make([]string, 0, len(macros))
+		for _, m := range macros {
+			if p := probes[m.Name]; p.ok {
+				macros[n] = m
+				rets = append(rets, p.ret)
+				n++
+			} else if p.ret != "" {
+				skipFuncMacro(m, "can't return "+p.ret)
+			} else {
+				skipFuncMacro(m, "unknown type")
+			}
+		}
+		return macros[:n], rets, nil
+	}
+	return
+}
+
+func skipFuncMacro(m *cl.FuncMacro, reason string) {
+	fmt.Fprintf(os.Stderr, "c2go: skip function-like macro %s: %s\n", m.Name, reason)
+}
+
+// probeRetType returns type of expr in `void __c2go_probe_xxx(...) { (void)(expr); }`.
+func probeRetType(fn *ast.Node) (ret string, ok bool) {
+	for _, item := range fn.Inner {
+		if item.Kind == ast.CompoundStmt && len(item.Inner) == 1 {
+			if cast := item.Inner[0]; cast.Kind == ast.CStyleCastExpr && len(cast.Inner) == 1 {
+				if t := cast.Inner[0].Type; t != nil {
+					ret = t.QualType
+					// function types, array types and unnamed types can't be a return type
+					return ret, !strings.ContainsAny(ret, "([")
+				}
+			}
+		}
+	}
+	return
+}
+
+func compileFuncMacros(infile string, incs []string, macros []*cl.FuncMacro, params map[string][]string,
+	rets []string, conf *c2goConf, flags int) error {
+	var b bytes.Buffer
+	writeIncludes(&b, incs)
+	for i, m := range macros {
+		ret, retStmt := rets[i], "return "
+		if ret == "void" {
+			retStmt = ""
+		}
+		fmt.Fprintf(&b, "%s %s%s(%s) { %s%s; }\n",
+			ret, macroWrapperPrefix, m.Name, macroParams(m, params[m.Name]), retStmt, macroCall(m))
+		conf.public[macroWrapperPrefix+m.Name] = funcMacroGoName(conf, m.Name)
+	}
+	defer func() { // wrappers aren't visible to C code of dependent packages
+		for _, m := range macros {
+			delete(conf.public, macroWrapperPrefix+m.Name)
+		}
+	}()
+	doc, _, err := preprocessAndParse(infile, b.Bytes(), conf)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("==> Compiling %d function-like macros ...\n", len(macros))
+	pkg, err := cl.NewPackage("", conf.Target.Name, doc, newClConfig(conf, flags, infile+".i"))
+	showWarnings(pkg)
+	return err
+}
+
+func preprocessAndParse(infile string, src []byte, conf *c2goConf) (doc *ast.Node, diags []*diag.Diagnostic, err error) {
+	if err = os.WriteFile(infile, src, 0666); err != nil {
+		return
+	}
+	outfile := infile + ".i"
+	if err = preprocessor.Do(infile, outfile, newPPConfig(conf)); err != nil {
+		return
+	}
+	doc, _, err = parser.ParseFileEx(outfile, 0, &parser.Config{Flags: conf.Flags, Target: conf.Target.Triple})
+	if e, ok := err.(*parser.ParseError); ok {
+		diags = e.Diags
+	}
+	return
+}
+
+func writeIncludes(b *bytes.Buffer, incs []string) (lines int) {
+	for _, inc := range incs {
+		fmt.Fprintf(b, "#include %s\n", strconv.Quote(inc))
+	}
+	return len(incs)
+}
+
+// macroParams returns parameters of a wrapper of macro m, where types are
+// inferred ones (see inferParamTypes).
+func macroParams(m *cl.FuncMacro, types []string) string {
+	if len(m.Params) == 0 {
+		return "void"
+	}
+	params := make([]string, len(m.Params))
+	for i, name := range m.Params {
+		typ := macroParamType
+		if i < len(types) && types[i] != "" {
+			typ = types[i]
+		}
+		params[i] = typ + " " + name
+	}
+	return strings.Join(params, ", ")
+}
+
+func macroCall(m *cl.FuncMacro) string {
+	return m.Name + "(" + strings.Join(m.Params, ", ") + ")"
+}
+
+// errorLines returns lines of file which have errors in diags, and the first
+// error of each line.
+func errorLines(diags []*diag.Diagnostic, file string) map[int]*diag.Diagnostic {
+	lines := make(map[int]*diag.Diagnostic)
+	for _, d := range diags {
+		if d.IsError() && filepath.Base(d.File) == file {
+			if _, ok := lines[d.Line]; !ok {
+				lines[d.Line] = d
+			}
+		}
+	}
+	return lines
+}
@@ -21,13 +21,14 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/goplus/c2go/cl"
 	"github.com/goplus/c2go/clang/cmod"
-	"github.com/goplus/c2go/clang/parser"
 	"github.com/goplus/c2go/clang/pathutil"
 	"github.com/goplus/c2go/clang/preprocessor"
+	ctypes "github.com/goplus/c2go/clang/types"
 	"github.com/goplus/gogen"
 	"github.com/goplus/gogen/cpackages"
 
@@ -53,13 +54,15 @@ type c2goCmd struct {
 }
 
 type c2goTarget struct {
-	Name string    `json:"name"`
-	Dir  string    `json:"dir"`
-	Cmds []c2goCmd `json:"cmds"`
+	Name   string    `json:"name"`
+	Dir    string    `json:"dir"`
+	Cmds   []c2goCmd `json:"cmds"`
+	Triple string    `json:"triple"` // clang target triple, default: the host
 }
 
 type c2goPublic struct {
-	From []string `json:"from"`
+	From       []string `json:"from"`
+	FuncMacros bool     `json:"funcMacros"` // translate function-like macros of From into Go funcs
 }
 
 type c2goConf struct {
@@ -77,6 +80,8 @@ type c2goConf struct {
 
 	depPkgs    []*cmod.Package `json:"-"`
 	allIncDirs []string        `json:"-"`
+	macroFiles []string        `json:"-"`
+	cache      *buildCache     `json:"-"`
 
 	dir         string            `json:"-"` // should be absolute path
 	public      map[string]string `json:"-"`
@@ -86,6 +91,10 @@ type c2goConf struct {
 	InLibC bool `json:"libc"` // bfm = BFM_InLibC
 
 	SimpleProj bool `json:"simpleProj"` // bfm = BFM_Default
+
+	LongDouble string `json:"longDouble"` // float64 (default), x87 or binary128
+
+	Builtins map[string]*cl.BuiltinFunc `json:"builtins"` // extra builtin functions
 }
 
 func clearDepsCache(conf *c2goConf) {
@@ -108,6 +117,7 @@ func execProj(projfile string, flags int, in *Config) {
 	conf.needPkgInfo = (flags & FlagDepsAutoGen) != 0
 	conf.dir, err = filepath.Abs(base)
 	check(err)
+	conf.cache = loadBuildCache(conf.dir)
 
 	noSource := len(conf.Source.Dirs) == 0 && len(conf.Source.Files) == 0
 	if noSource {
@@ -127,12 +137,13 @@ func execProj(projfile string, flags int, in *Config) {
 
 		if in != nil && in.SelectFile != "" {
 			execProjFile(pathutil.Canonical(base, in.SelectFile), &conf, appFlags)
+			check(conf.cache.save())
 			return
 		}
-		execProjSource(base, appFlags, &conf)
-
-		err = cpackages.WritePubFile(base+"c2go.a.pub", conf.public)
-		check(err)
+		if execProjSource(base, appFlags, &conf) {
+			err = cpackages.WritePubFile(base+"c2go.a.pub", conf.public)
+			check(err)
+		}
 	}
 	if cmds := conf.Target.Cmds; len(cmds) != 0 {
 		conf.Target.Cmds = nil
@@ -160,6 +171,9 @@ func execProj(projfile string, flags int, in *Config) {
 				fname := filepath.Base(cmd.Dir)
 				if !strings.HasPrefix(fname, "test_") { // only test cmd/test_xxx
 					appFlags &= ^FlagRunTest
+				} else if _, host := targetEnv(conf.Target.Triple); !host {
+					fmt.Printf("==> Skip running %s: %s isn't the host\n", cmd.Dir, conf.Target.Triple)
+					appFlags &= ^FlagRunTest
 				}
 			}
 			fmt.Printf("==> Building %s ...\n", cmd.Dir)
@@ -219,34 +233,85 @@ func substTexts(tpl []string, it string) []string {
 	return tpl
 }
 
-func execProjSource(base string, flags int, conf *c2goConf) {
+// execProjSource compiles the current target of conf. It returns false if
+// the target is up to date (see buildCache) and so isn't compiled again.
+func execProjSource(base string, flags int, conf *c2goConf) (built bool) {
 	conf.Reused = cl.Reused{}
+	conf.macroFiles = nil
 	for i, file := range conf.Source.Ignore.Files {
 		if absf, e := filepath.Abs(file); e == nil {
 			conf.Source.Ignore.Files[i] = absf
 		}
 	}
+	var files []string
 	for _, dir := range conf.Source.Dirs {
 		recursively := strings.HasSuffix(dir, "/...")
 		if recursively {
 			dir = dir[:len(dir)-4]
 		}
-		execProjDir(pathutil.Canonical(base, dir), conf, flags, recursively)
+		files = collectProjDir(pathutil.Canonical(base, dir), conf, recursively, files)
 	}
 	for _, file := range conf.Source.Files {
-		execProjFile(pathutil.Canonical(base, file), conf, flags)
+		files = append(files, pathutil.Canonical(base, file))
+	}
+	for _, infile := range files {
+		preprocessProjFile(infile, conf, flags)
+	}
+	cache := conf.cache
+	dir := pathutil.Canonical(base, conf.Target.Dir)
+	key, units := cache.targetKeys(conf, flags, files)
+	if (flags&FlagForcePreprocess) == 0 && cache.Targets[dir] == key && isDir(dir) {
+		fmt.Printf("==> %s is up to date\n", dir)
+		buildProjTarget(dir, flags, conf)
+		return false
+	}
+	kept := make(map[string]bool) // Go files of translation units which are up to date
+	var errs cl.ErrorList
+	for i, infile := range files {
+		gofile := goFileName(filepath.Base(infile) + ".i.go")
+		upToDate := (flags&FlagForcePreprocess) == 0 && !conf.needPkgInfo && // PkgInfo needs all function bodies
+			cache.Units[filepath.Join(dir, gofile)] == units[i] && isFile(filepath.Join(dir, gofile))
+		if upToDate {
+			kept[gofile] = true
+		}
+		errs = append(errs, compileProjFile(infile, conf, flags, upToDate)...)
+	}
+	// problems of all translation units are reported at once
+	check(errs.Err())
+	if conf.Public.FuncMacros && conf.public != nil { // not building a cmd
+		if (flags & FlagFromJson) != 0 {
+			fmt.Fprintln(os.Stderr, "c2go: skip function-like macros: clang is required")
+		} else {
+			execFuncMacros(conf, flags)
+		}
 	}
-	execProjDone(base, flags, conf)
+	execProjDone(base, flags, conf, kept)
+	for i, infile := range files {
+		cache.Units[filepath.Join(dir, goFileName(filepath.Base(infile)+".i.go"))] = units[i]
+	}
+	cache.Targets[dir] = key
+	check(cache.save())
+	return true
+}
+
+// goFileName returns name of the Go file written for file fname of a package.
+func goFileName(fname string) string {
+	if strings.HasPrefix(fname, "_") {
+		return "x2g" + fname
+	}
+	return fname
 }
 
-func execProjDone(base string, flags int, conf *c2goConf) {
+// execProjDone writes Go files of the target, except kept ones which are up
+// to date, and builds it.
+func execProjDone(base string, flags int, conf *c2goConf, kept map[string]bool) {
 	if pkg := conf.Reused.Pkg(); pkg.IsValid() {
 		dir := pathutil.Canonical(base, conf.Target.Dir)
 		os.MkdirAll(dir, 0777)
 		pkg.ForEachFile(func(fname string, file *gogen.File) {
-			gofile := fname
-			if strings.HasPrefix(fname, "_") {
-				gofile = "x2g" + fname
+			gofile := goFileName(fname)
+			if kept[gofile] {
+				return
 			}
 			err := pkg.WriteFile(filepath.Join(dir, gofile), fname)
 			check(err)
@@ -255,24 +320,49 @@ func execProjDone(base string, flags int, conf *c2goConf) {
 			err := pkg.WriteDepFile(filepath.Join(dir, "c2go_autogen.go"))
 			check(err)
 		}
-		var cmd *exec.Cmd
-		if (flags&FlagRunTest) != 0 && conf.Target.Name == "main" {
-			cmd = exec.Command("go", "build", "-o", clangOut, ".")
-		} else {
-			cmd = exec.Command("go", "install", ".")
-		}
-		cmd.Dir = dir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		check(cmd.Run())
+		buildProjTarget(dir, flags, conf)
 	} else {
 		fatalf("empty project: no *.c files in this directory.\n")
 	}
 }
 
-func execProjDir(dir string, conf *c2goConf, flags int, recursively bool) {
+func buildProjTarget(dir string, flags int, conf *c2goConf) {
+	var cmd *exec.Cmd
+	env, host := targetEnv(conf.Target.Triple)
+	if (flags&FlagRunTest) != 0 && conf.Target.Name == "main" {
+		cmd = exec.Command("go", "build", "-o", clangOut, ".")
+	} else if !host { // go install doesn't install cross-compiled binaries into GOBIN
+		cmd = exec.Command("go", "build", "-o", os.DevNull, ".")
+	} else {
+		cmd = exec.Command("go", "install", ".")
+	}
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	check(cmd.Run())
+}
+
+// targetEnv returns environment variables to build Go files generated for the
+// clang target triple (see cl.Config.Target), and whether the target is the
+// host. It returns nil env for the host if triple is empty.
+func targetEnv(triple string) (env []string, host bool) {
+	if triple == "" {
+		return nil, true
+	}
+	t, err := ctypes.ParseTarget(triple)
+	check(err)
+	goos := t.GOOS
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	env = append(os.Environ(), "GOARCH="+t.GOARCH, "GOOS="+goos)
+	return env, t.GOARCH == runtime.GOARCH && goos == runtime.GOOS
+}
+
+func collectProjDir(dir string, conf *c2goConf, recursively bool, files []string) []string {
 	if strings.HasPrefix(dir, "_") {
-		return
+		return files
 	}
 	fis, err := os.ReadDir(dir)
 	check(err)
@@ -281,7 +371,7 @@ func execProjDir(dir string, conf *c2goConf, flags int, recursively bool) {
 		if fi.IsDir() {
 			if recursively {
 				pkgDir := filepath.Join(dir, fname)
-				execProjDir(pkgDir, conf, flags, true)
+				files = collectProjDir(pkgDir, conf, true, files)
 			}
 			continue
 		}
@@ -290,9 +380,10 @@ func execProjDir(dir string, conf *c2goConf, flags int, recursively bool) {
 			if ignoreFile(pkgFile, conf) {
 				continue
 			}
-			execProjFile(pkgFile, conf, flags)
+			files = append(files, pkgFile)
 		}
 	}
+	return files
 }
 
 func ignoreFile(infile string, conf *c2goConf) bool {
@@ -305,8 +396,21 @@ func ignoreFile(infile string, conf *c2goConf) bool {
 }
 
 func execProjFile(infile string, conf *c2goConf, flags int) {
-	fmt.Printf("==> Compiling %s ...\n", infile)
+	preprocessProjFile(infile, conf, flags)
+	errs := compileProjFile(infile, conf, flags, false)
+	check(errs.Err())
+}
 
+// projMacroFile returns the macro file of infile ("" if macros aren't needed).
+func projMacroFile(infile string, conf *c2goConf) string {
+	if len(conf.Public.From) > 0 || len(conf.public) > 0 { // public macros => Go consts
+		return infile + ".macros"
+	}
+	return ""
+}
+
+// preprocessProjFile preprocesses infile if it isn't up to date (see buildCache).
+func preprocessProjFile(infile string, conf *c2goConf, flags int) {
 	var err error
 	if len(conf.allIncDirs) == 0 {
 		if len(conf.depPkgs) == 0 && len(conf.Deps) > 0 {
@@ -330,32 +434,72 @@ func execProjFile(infile string, conf *c2goConf, flags int) {
 		}
 		conf.allIncDirs = allIncDirs
 	}
+	if (flags & FlagFromJson) != 0 { // preprocessed when dumping the AST (see compileProjFile)
+		return
+	}
 
 	outfile := infile + ".i"
-	if (flags&FlagForcePreprocess) != 0 || !isFile(outfile) {
-		err := preprocessor.Do(infile, outfile, &preprocessor.Config{
-			BaseDir:     conf.dir,
-			IncludeDirs: conf.allIncDirs,
-			Defines:     conf.Define,
-			Flags:       conf.Flags,
-			PPFlag:      conf.PPFlag,
-			Compiler:    conf.Compiler,
-		})
+	macrofile := projMacroFile(infile, conf)
+	ppconf := newPPConfig(conf)
+	ppconf.MacroFile = macrofile
+	key := hashOf(ppconf)
+	if (flags&FlagForcePreprocess) != 0 || !isFile(outfile) || (macrofile != "" && !isFile(macrofile)) ||
+		!conf.cache.upToDate(infile, key) {
+		fmt.Printf("==> Preprocessing %s ...\n", infile)
+		depfile := infile + ".d"
+		ppconf.DepFile = depfile
+		err = preprocessor.Do(infile, outfile, ppconf)
+		check(err)
+		err = conf.cache.update(infile, key, depfile)
 		check(err)
 	}
+}
+
+// compileProjFile compiles infile into the shared package. If upToDate, its Go
+// file is kept, so only its decls are needed (see cl.Config.SkipFuncBodies).
+// It returns diagnostics of infile if there are errors, so that the caller can
+// report them together with problems of other translation units.
+func compileProjFile(infile string, conf *c2goConf, flags int, upToDate bool) cl.ErrorList {
+	if upToDate {
+		fmt.Printf("==> Loading %s (up to date) ...\n", infile)
+	} else {
+		fmt.Printf("==> Compiling %s ...\n", infile)
+	}
+
+	outfile := infile + ".i"
+	macrofile := projMacroFile(infile, conf)
+	if macrofile != "" && (flags&FlagFromJson) != 0 && !isFile(macrofile) {
+		macrofile = "" // macros weren't dumped with the AST
+	}
+	if macrofile != "" {
+		conf.macroFiles = append(conf.macroFiles, macrofile)
+	}
 
-	var json []byte
-	doc, _, err := parser.ParseFileEx(outfile, 0, &parser.Config{
-		Json:   &json,
-		Flags:  conf.Flags,
-		Stderr: true,
-	})
+	clconf := newClConfig(conf, flags, outfile)
+	clconf.MacroFile = macrofile
+	clconf.SkipFuncBodies = upToDate
+	pkg, err := newPackage(conf.Target.Name, outfile, infile+".json", conf.Flags, flags, clconf)
+	if errs, ok := err.(cl.ErrorList); ok {
+		return errs
+	}
 	check(err)
+	showWarnings(pkg)
+	return nil
+}
 
-	if (flags & FlagDumpJson) != 0 {
-		os.WriteFile(infile+".json", json, 0666)
+func newPPConfig(conf *c2goConf) *preprocessor.Config {
+	return &preprocessor.Config{
+		BaseDir:     conf.dir,
+		IncludeDirs: conf.allIncDirs,
+		Defines:     conf.Define,
+		Flags:       conf.Flags,
+		PPFlag:      conf.PPFlag,
+		Compiler:    conf.Compiler,
+		Target:      conf.Target.Triple,
 	}
+}
 
+func newClConfig(conf *c2goConf, flags int, outfile string) *cl.Config {
 	procDepPkg := func(pkgDir string) {
 		headerFile := pkgDir + "/c2go_header.i.go"
 		if !isFile(headerFile) {
@@ -368,7 +512,17 @@ func execProjFile(infile string, conf *c2goConf, flags int) {
 	} else if !conf.SimpleProj {
 		bfm = cl.BFM_FromLibC
 	}
-	_, err = cl.NewPackage("", conf.Target.Name, doc, &cl.Config{
+	var ldm cl.LDMode
+	switch conf.LongDouble {
+	case "", "float64":
+	case "x87":
+		ldm = cl.LDM_X87
+	case "binary128":
+		ldm = cl.LDM_Binary128
+	default:
+		fatalf("c2go.cfg: invalid longDouble %q, expect float64, x87 or binary128\n", conf.LongDouble)
+	}
+	return &cl.Config{
 		SrcFile:     outfile,
 		ProcDepPkg:  procDepPkg,
 		Public:      conf.public,
@@ -383,6 +537,11 @@ func execProjFile(infile string, conf *c2goConf, flags int) {
 		// BuiltinFuncMode: compiling mode of builtin functions
 		BuiltinFuncMode: bfm,
 		SkipLibcHeader:  conf.skipLibcH,
-	})
-	check(err)
+		FuncStubOnError: (flags & FlagFuncStub) != 0,
+		LineDirectives:  (flags & FlagLineDirective) != 0,
+		SourceMap:       (flags & FlagSourceMap) != 0,
+		Target:          conf.Target.Triple,
+		LongDouble:      ldm,
+		Builtins:        conf.Builtins,
+	}
 }
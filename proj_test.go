@@ -0,0 +1,66 @@
+package c2go
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestTargetEnv(t *testing.T) {
+	if env, host := targetEnv(""); env != nil || !host {
+		t.Fatal("targetEnv: no triple")
+	}
+	env, host := targetEnv("x86_64-pc-windows-msvc")
+	if n := len(env); n < 2 || env[n-2] != "GOARCH=amd64" || env[n-1] != "GOOS=windows" {
+		t.Fatal("targetEnv:", env)
+	}
+	if host != (runtime.GOARCH == "amd64" && runtime.GOOS == "windows") {
+		t.Fatal("targetEnv: host")
+	}
+	env, _ = targetEnv("arm-none-eabi") // unknown OS
+	if n := len(env); n < 2 || env[n-2] != "GOARCH=arm" || env[n-1] != "GOOS="+runtime.GOOS {
+		t.Fatal("targetEnv:", env)
+	}
+}
+
+func TestBuildCrossTarget(t *testing.T) {
+	triple, goarch := "aarch64-unknown-linux-gnu", "arm64"
+	if runtime.GOARCH == "arm64" {
+		triple, goarch = "x86_64-unknown-linux-gnu", "amd64"
+	}
+	if _, host := targetEnv(triple); host {
+		t.Fatal("targetEnv:", triple, "is the host")
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module foo\n\ngo 1.18\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "foo.go"), []byte("//go:build "+goarch+"\n\npackage main\n\nfunc main() {}\n"), 0666)
+	conf := &c2goConf{Target: c2goTarget{Name: "main", Triple: triple}}
+	buildProjTarget(dir, 0, conf)
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Fatal("buildProjTarget: output is written into", dir)
+	}
+}
+
+func TestProjErrors(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "c2go.cfg"), []byte(`{
+	"target": {"name": "foo", "dir": "out"},
+	"source": {"files": ["a.c", "b.c"]}
+}`), 0666)
+	os.WriteFile(filepath.Join(dir, "a.c"), []byte("__attribute__((used)) int a(int x) { return x; }\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "b.c"), []byte("__attribute__((used)) int b(int x) { return x; }\n"), 0666)
+	defer func() {
+		e := recover()
+		msg := fmt.Sprint(e)
+		if !strings.Contains(msg, "a.c:1:") || !strings.Contains(msg, "b.c:1:") {
+			t.Fatal("execProj:", msg)
+		}
+		if isDir(filepath.Join(dir, "out")) {
+			t.Fatal("execProj: Go files are written")
+		}
+	}()
+	execProj(filepath.Join(dir, "c2go.cfg"), FlagNoASTCache, nil)
+}
@@ -1,5 +1,13 @@
 #include <stdio.h>
 
+struct counter {
+    _Atomic int n;
+    _Atomic(char *) p;
+};
+
+_Atomic unsigned long total;
+_Atomic short small;
+
 int main() {
     long long a = 3;
     int b = 0;
@@ -7,5 +15,64 @@ int main() {
     printf("atomic: %lld\n", a);
     __atomic_store_n(&b, a!=0, 0);
     printf("atomic: %d\n", __atomic_load_n(&b, 0));
+
+    int old = __atomic_fetch_add(&b, 5, 5);
+    int new = __atomic_add_fetch(&b, 5, 5);
+    printf("fetch_add: %d %d %d\n", old, new, b);
+    printf("fetch_sub: %lld %lld\n", __atomic_fetch_sub(&a, 1, 5), __atomic_sub_fetch(&a, 1, 5));
+    printf("fetch_and/or/xor: %d %d %d\n", __atomic_fetch_and(&b, 6, 5), __atomic_or_fetch(&b, 9, 5), __atomic_xor_fetch(&b, 3, 5));
+    printf("nand: %d %d\n", __atomic_fetch_nand(&b, 12, 5), b);
+
+    int expected = 3;
+    int ok = __atomic_compare_exchange_n(&b, &expected, 7, 0, 5, 5);
+    printf("cmpxchg: %d %d %d\n", ok, expected, b);
+    ok = __atomic_compare_exchange_n(&b, &expected, 7, 0, 5, 5);
+    printf("cmpxchg: %d %d %d\n", ok, expected, b);
+    printf("exchange: %d %d\n", __atomic_exchange_n(&b, 42, 5), b);
+
+    int src = 11, dst = 0;
+    __atomic_store(&b, &src, 5);
+    __atomic_load(&b, &dst, 5);
+    __atomic_exchange(&b, &src, &dst, 5);
+    printf("generic: %d %d\n", b, dst);
+
+    unsigned u = 10;
+    printf("sync: %u %u %u\n", __sync_fetch_and_add(&u, 5), __sync_sub_and_fetch(&u, 20), u);
+    printf("sync cas: %d %u %u\n", __sync_bool_compare_and_swap(&u, 1, 2), __sync_val_compare_and_swap(&u, u, 9), u);
+    printf("sync lock: %u", __sync_lock_test_and_set(&u, 1));
+    __sync_lock_release(&u);
+    printf(" %u\n", u);
+
+    char c = 'a';
+    __sync_fetch_and_add(&c, 2);
+    printf("char: %c", c);
+    printf(" %d\n", __atomic_test_and_set(&c, 5));
+    __atomic_clear(&c, 5);
+    printf("clear: %d\n", c);
+
+    struct counter cnt = {0};
+    char buf[4] = "abc";
+    cnt.n = 5;
+    cnt.n += 10;
+    cnt.n *= 3;
+    ++cnt.n;
+    int post = cnt.n--;
+    cnt.p = buf;
+    cnt.p++;
+    printf("_Atomic: %d %d %c\n", cnt.n, post, *cnt.p);
+
+    int arr[4] = {1, 2, 3, 4};
+    int *ip = arr;
+    int *oldp = __atomic_fetch_add(&ip, sizeof(int), 5); /* in bytes, not scaled */
+    __sync_fetch_and_add(&ip, 2 * sizeof(int));
+    int *newp = __atomic_sub_fetch(&ip, sizeof(int), 5);
+    printf("pointer: %d %d %d\n", *oldp, *newp, *ip);
+
+    total = 1;
+    total -= 2;
+    small = -1;
+    small += 3;
+    __atomic_thread_fence(5);
+    printf("%lu %d %d\n", total + 1, small, __c11_atomic_fetch_add(&small, 1, 5));
     return 0;
 }
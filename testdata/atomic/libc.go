@@ -15,32 +15,23 @@ func gostring(s *int8) string {
 }
 
 func printf(format *int8, args ...interface{}) int32 {
-	goformat := strings.ReplaceAll(gostring(format), "%lld", "%d")
+	goformat := strings.NewReplacer("%lld", "%d", "%lu", "%d", "%u", "%d").Replace(gostring(format))
 	for i, arg := range args {
-		if v, ok := arg.(*int8); ok {
+		switch v := arg.(type) {
+		case *int8:
 			args[i] = gostring(v)
+		case bool:
+			if v {
+				args[i] = 1
+			} else {
+				args[i] = 0
+			}
 		}
 	}
 	fmt.Printf(goformat, args...)
 	return 0
 }
 
-func __atomic_store_n_i32(p *int32, memorder int32, v int32) {
-	*p = v
-}
-
-func __atomic_store_n_i64(p *int64, memorder int32, v int64) {
-	*p = v
-}
-
-func __atomic_load_n_i32(p *int32, memorder int32) int32 {
-	return *p
-}
-
-func __atomic_load_n_i64(p *int64, memorder int32) int64 {
-	return *p
-}
-
 func __swbuf(_c int32, _p *FILE) int32 {
 	return _c
 }
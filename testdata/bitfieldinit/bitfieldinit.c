@@ -0,0 +1,96 @@
+#include <stdio.h>
+#include <stddef.h>
+
+struct mixed {
+    char a :4;
+    int b :4;
+};
+
+struct shared {
+    int a :4;
+    char c;
+};
+
+struct zero {
+    char a :3;
+    int :0;
+    char b :3;
+};
+
+struct after {
+    char x;
+    int a :4;
+};
+
+struct signs {
+    unsigned short a :3;
+    short b :3;
+    short c :6;
+    unsigned d :5;
+};
+
+struct wide {
+    long long a :40;
+    int b :20;
+    char c;
+};
+
+struct straddle {
+    int a :4;
+    int b :8;
+    char c;
+};
+
+struct point {
+    int x :8;
+    int y :8;
+    unsigned flags :3;
+    double w;
+};
+
+static struct point gpt = {1, -2, 5, 1.5};
+
+int next(int *n) {
+    return (*n)++;
+}
+
+int main() {
+    printf("sizeof: %d %d %d %d %d %d %d %d\n",
+        (int)sizeof(struct mixed), (int)sizeof(struct shared),
+        (int)sizeof(struct zero), (int)sizeof(struct after),
+        (int)sizeof(struct signs), (int)sizeof(struct wide),
+        (int)sizeof(struct straddle), (int)sizeof(struct point));
+    printf("offsetof: %d %d %d\n",
+        (int)offsetof(struct shared, c), (int)offsetof(struct wide, c),
+        (int)offsetof(struct straddle, c));
+
+    struct mixed m = {-3, 7};
+    printf("mixed: %d %d\n", m.a, m.b);
+    struct shared sh = {-1, 'x'};
+    printf("shared: %d %c\n", sh.a, sh.c);
+    struct zero z = {.b = 2, .a = 3};
+    printf("zero: %d %d\n", z.a, z.b);
+    struct after af = {.a = 5};
+    printf("after: %d %d\n", af.x, af.a);
+    struct signs sg = {7, -1, 31, 17};
+    printf("signs: %d %d %d %d\n", sg.a, sg.b, sg.c, sg.d);
+    sg.a = 9;
+    sg.b = 3;
+    sg.c = -32;
+    sg.d = 0;
+    printf("signs: %d %d %d %d\n", sg.a, sg.b, sg.c, sg.d);
+    struct wide w = {-2, 0x7ffff, 'c'};
+    printf("wide: %lld %d %c\n", w.a, w.b, w.c);
+    struct straddle st = {.b = 200};
+    printf("straddle: %d %d %d\n", st.a, st.b, st.c);
+
+    int n = 5;
+    struct point p = {next(&n), -next(&n), .w = 2.5};
+    printf("point: %d %d %d %g\n", p.x, p.y, p.flags, p.w);
+    struct point q = {.flags = n, .y = 100};
+    printf("point: %d %d %d %g\n", q.x, q.y, q.flags, q.w);
+    printf("gpt: %d %d %d %g\n", gpt.x, gpt.y, gpt.flags, gpt.w);
+    struct point ps[2] = {{1, 2, 3, 4}, {.x = -1}};
+    printf("ps: %d %d %d %d\n", ps[0].x, ps[0].flags, ps[1].x, ps[1].y);
+    return 0;
+}
@@ -0,0 +1,48 @@
+#include <stdio.h>
+#include <limits.h>
+
+static int check(unsigned x) {
+    if (x == 0)
+        __builtin_unreachable();
+    return __builtin_ctz(x);
+}
+
+int main() {
+    unsigned x = 0x00f0;
+    unsigned long y = 1UL << 40;
+    long long z = -1;
+    printf("clz: %d %d %d\n", __builtin_clz(x), __builtin_clzl(y), __builtin_clzll(1));
+    printf("ctz: %d %d %d\n", __builtin_ctz(x), __builtin_ctzl(y), check(8));
+    printf("popcount: %d %d %d\n", __builtin_popcount(x), __builtin_popcountl(y), __builtin_popcountll(z));
+    printf("parity: %d %d %d\n", __builtin_parity(x), __builtin_parity(7), __builtin_parityll(z));
+    printf("ffs: %d %d %d %d\n", __builtin_ffs(0), __builtin_ffs(x), __builtin_ffsl(y), __builtin_ffsll(z));
+
+    unsigned char c = 0x81;
+    printf("rotate: %u %u %u %llu\n", __builtin_rotateleft8(c, 1), __builtin_rotateright16(0x1234, 4),
+        __builtin_rotateleft32(x, 28), (unsigned long long)__builtin_rotateright64(1, 1));
+
+    int r;
+    unsigned u;
+    long long ll;
+    unsigned long long ull;
+    printf("add: %d %d", __builtin_add_overflow(INT_MAX, 1, &r), r);
+    printf(" %d %d", __builtin_add_overflow(INT_MAX, -1, &r), r);
+    printf(" %d %u", __builtin_add_overflow(-1, 0, &u), u);
+    printf(" %d %lld", __builtin_saddll_overflow(LLONG_MAX, 1, &ll), ll);
+    printf(" %d %llu\n", __builtin_add_overflow(ULLONG_MAX, 2ULL, &ull), ull);
+    printf("sub: %d %u", __builtin_sub_overflow(1u, 2u, &u), u);
+    printf(" %d %d", __builtin_ssub_overflow(INT_MIN, 1, &r), r);
+    printf(" %d %lld", __builtin_sub_overflow(LLONG_MIN, 1LL, &ll), ll);
+    printf(" %d %llu\n", __builtin_usubll_overflow(3, 1, &ull), ull);
+    printf("mul: %d %d", __builtin_mul_overflow(1 << 16, 1 << 15, &r), r);
+    printf(" %d %d", __builtin_mul_overflow(-(1 << 16), 1 << 15, &r), r);
+    printf(" %d %lld", __builtin_mul_overflow(-1LL, LLONG_MIN, &ll), ll);
+    printf(" %d %lld", __builtin_smulll_overflow(-3, 5, &ll), ll);
+    printf(" %d %llu", __builtin_umulll_overflow(1ULL << 32, 1ULL << 32, &ull), ull);
+    printf(" %d %d\n", __builtin_mul_overflow(z, 7LL, &r), r);
+
+    __builtin_assume(x != 0);
+    if (x == 0)
+        __builtin_trap();
+    return 0;
+}
@@ -0,0 +1,11 @@
+#include <stdio.h>
+
+int vendor_popcount(unsigned x);
+int __attribute__((overloadable)) vendor_abs(int x);
+double __attribute__((overloadable)) vendor_abs(double x);
+
+int main() {
+    printf("%d %d\n", __builtin_bswap16(0x1234), vendor_popcount(0xff));
+    printf("%d %g\n", vendor_abs(-3), vendor_abs(-2.5));
+    return 0;
+}
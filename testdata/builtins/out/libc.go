@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+func gostring(s *int8) string {
+	n, arr := 0, (*[1 << 20]byte)(unsafe.Pointer(s))
+	for arr[n] != 0 {
+		n++
+	}
+	return string(arr[:n])
+}
+
+func printf(format *int8, args ...interface{}) int32 {
+	fmt.Printf(gostring(format), args...)
+	return 0
+}
+
+func bswap16(x uint16) uint16 {
+	return x<<8 | x>>8
+}
+
+func vendor_absi(x int32) int32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+type struct__IO_marker struct{}
+type struct__IO_codecvt struct{}
+type struct__IO_wide_data struct{}
@@ -0,0 +1,92 @@
+#include <stdio.h>
+
+enum { OP_PUSH, OP_ADD, OP_MUL, OP_JNZ, OP_DEC, OP_PRINT, OP_HALT };
+
+static int run(const int *code) {
+    static void *dispatch[] = {
+        &&op_push, &&op_add, &&op_mul, &&op_jnz, &&op_dec, &&op_print, &&op_halt,
+    };
+    int stack[16], sp = 0, pc = 0, steps = 0;
+
+#define NEXT goto *dispatch[code[pc++]]
+    NEXT;
+    for (;;) {
+    op_push:
+        stack[sp++] = code[pc++];
+        steps++;
+        NEXT;
+    op_add:
+        sp--;
+        stack[sp - 1] += stack[sp];
+        steps++;
+        NEXT;
+    op_mul:
+        sp--;
+        stack[sp - 1] *= stack[sp];
+        steps++;
+        NEXT;
+    op_jnz:
+        if (stack[sp - 1] != 0) {
+            pc = code[pc];
+            steps++;
+            NEXT;
+        }
+        pc++;
+        steps++;
+        NEXT;
+    op_dec:
+        stack[sp - 1]--;
+        steps++;
+        NEXT;
+    op_print:
+        printf("top: %d\n", stack[sp - 1]);
+        steps++;
+        NEXT;
+    }
+op_halt:
+    return steps;
+}
+
+static int classify(int n) {
+    void *target = &&zero;
+    if (n < 0) {
+        target = &&negative;
+    } else if (n > 0) {
+        target = &&positive;
+    }
+    goto *target;
+zero:
+    return 0;
+negative:
+    return -1;
+positive:
+    return 1;
+}
+
+static int depth(int n) {
+    char buf[256];
+    buf[n & 255] = (char)n;
+    return n == 0 ? 0 : depth(n - 1) + (buf[n & 255] == (char)n);
+}
+
+static int grow(int n) {
+    void *next = n ? &&deep : &&done;
+    n = depth(n); /* the stack grows while next is live */
+    goto *next;
+done:
+    return 0;
+deep:
+    return n;
+}
+
+int main() {
+    int code[] = {
+        OP_PUSH, 1, OP_PUSH, 3,
+        OP_PRINT, OP_DEC, OP_JNZ, 4,
+        OP_PUSH, 7, OP_MUL, OP_PUSH, 2, OP_ADD, OP_PRINT, OP_HALT,
+    };
+    printf("steps: %d\n", run(code));
+    printf("classify: %d %d %d\n", classify(-5), classify(0), classify(9));
+    printf("grow: %d\n", grow(10000));
+    return 0;
+}
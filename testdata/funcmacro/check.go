@@ -0,0 +1,13 @@
+package funcmacro
+
+// Go funcs translated from function-like macros of src/mac.h are checked when
+// cmd/test_macro imports this package.
+func init() {
+	var f Struct_mac_file
+	if MAC_MAX(3, 5) != 5 || MAC_HALF(3) != 1.5 {
+		panic("MAC_MAX, MAC_HALF")
+	}
+	if Mac_putc('x', &f) != 'x' || Mac_getc(&f) != 'x' || MAC_NEXT(&f) != 'z'+1 {
+		panic("Mac_putc, Mac_getc, MAC_NEXT")
+	}
+}
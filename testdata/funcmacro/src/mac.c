@@ -0,0 +1,17 @@
+#include "mac.h"
+
+int mac_fill(mac_file *f) {
+    f->n = 0;
+    return 'z';
+}
+
+int mac_put(int c, mac_file *f) {
+    if (f->n < 8) {
+        f->buf[f->n++] = c;
+    }
+    return c;
+}
+
+double mac_scale(double x, int n) {
+    return n < 0 ? x / 2 : x * 2;
+}
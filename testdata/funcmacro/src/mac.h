@@ -0,0 +1,15 @@
+typedef struct mac_file {
+    int n;
+    char buf[8];
+} mac_file;
+
+int mac_fill(mac_file *f);
+int mac_put(int c, mac_file *f);
+double mac_scale(double x, int n);
+
+#define MAC_MAX(a, b) ((a) > (b) ? (a) : (b))
+#define MAC_HALF(x) mac_scale((x), -1)
+#define mac_getc(f) ((f)->n > 0 ? (f)->buf[--(f)->n] : mac_fill(f))
+#define mac_putc(c, f) mac_put((c), (f))
+#define MAC_NEXT(f) (mac_getc(f) + 1)
+#define MAC_COUNT(f) ((f)->n)
@@ -0,0 +1,7 @@
+#include "mac.h"
+
+int main() {
+    mac_file f = {0};
+    mac_putc('a', &f);
+    return mac_getc(&f) == 'a' && mac_getc(&f) == 'z' ? 0 : 1;
+}
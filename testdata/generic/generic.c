@@ -0,0 +1,25 @@
+#include <stdio.h>
+
+#define tname(x) _Generic((x), int: "int", double: "double", char *: "string", default: "other")
+#define absval(x) _Generic((x), int: iabs, double: dabs)(x)
+#define twice(x) _Generic((x), float: (x) * 2.0f, default: (x) * 2)
+
+static int iabs(int x) {
+    return x < 0 ? -x : x;
+}
+
+static double dabs(double x) {
+    return x < 0 ? -x : x;
+}
+
+int main() {
+    int n = -3;
+    char *s = "hi";
+    long l = 4;
+    printf("%s %s %s %s %s\n", tname(n), tname(1.5), tname(s), tname(l), s);
+    printf("%d %g\n", absval(n), absval(-2.5));
+    printf("%g %ld\n", twice(1.25f), twice(l));
+    _Generic(n, int: n, default: l) = 7;
+    printf("%d\n", n);
+    return 0;
+}
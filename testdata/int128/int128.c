@@ -0,0 +1,48 @@
+#include <stdio.h>
+
+typedef unsigned __int128 u128;
+
+static void print(const char* name, __int128 v) {
+	u128 u = (u128)v;
+	printf("%s: %llx %016llx\n", name, (unsigned long long)(u >> 64), (unsigned long long)u);
+}
+
+static u128 mulhi(unsigned long long a, unsigned long long b) {
+	return ((u128)a * b) >> 64;
+}
+
+int main() {
+	__int128 a = 1;
+	__int128 b = -7;
+	u128 c = ~(u128)0;
+	int n = 100;
+	a <<= n;
+	a += 12345;
+	print("a", a);
+	print("b", b);
+	print("a*b", a * b);
+	print("a/b", a / b);
+	print("a%b", a % b);
+	print("-a>>3", -a >> 3);
+	print("c/3", (__int128)(c / 3));
+	print("a&c|b", a & c | b);
+	print("a^b", a ^ b);
+	print("mulhi", (__int128)mulhi(0xdeadbeefcafebabeULL, 0x123456789abcdefULL));
+	printf("cmp: %d %d %d %d\n", a < b, a > b, b == -7, a != 0);
+	if (!b) {
+		printf("b is zero\n");
+	} else if (b) {
+		printf("b is not zero\n");
+	}
+	b++;
+	--b;
+	c -= 1;
+	print("b", b);
+	print("c", (__int128)c);
+	printf("int: %d %lld %llx\n", (int)b, (long long)(a >> 64), (unsigned long long)b);
+	printf("double: %.1f %.1f\n", (double)a, (double)b);
+	a = (__int128)1e30;
+	print("1e30", a);
+	printf("shift: %d\n", 1 << (__int128)3);
+	return 0;
+}
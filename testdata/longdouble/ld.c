@@ -0,0 +1,32 @@
+#include <stdio.h>
+
+long double third(long double x) {
+	return x / 3;
+}
+
+int main() {
+	long double a = 1.1L;
+	long double b = third(1);
+	double d = 0.1;
+	int n = 7;
+	long double c = a * b + d - n;
+	printf("%.20Lf %.20Lf %.20Lf\n", a, b, c);
+	c += 1;
+	c++;
+	--c;
+	c *= -a;
+	printf("%.20Lf %d %d %d\n", c, a < b, a > b, a == 1.1L);
+	if (c) {
+		printf("c is not zero\n");
+	}
+	printf("%d %lld %.17g %.20Lf\n", (int)c, (long long)(a * 1e20L), (double)b, (long double)n / 9);
+	long double z = 0;
+	printf("%Lf %Lf %d\n", 1 / z, -1 / z, z / z != z / z);
+	__int128 big = (__int128)1 << 100;
+	unsigned __int128 ub = (unsigned __int128)(a * 1e30L);
+	long double e = big;
+	e += big;
+	printf("%.0Lf %d %lld\n", e, (int)(big / (__int128)(e / 4)), (long long)(ub >> 64));
+	printf("sizeof: %d\n", (int)sizeof(long double));
+	return 0;
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+func gostring(s *int8) string {
+	n, arr := 0, (*[1 << 20]byte)(unsafe.Pointer(s))
+	for arr[n] != 0 {
+		n++
+	}
+	return string(arr[:n])
+}
+
+func printf(format *int8, args ...interface{}) int32 {
+	goformat := gostring(format)
+	for _, s := range []string{"ll", "L"} {
+		goformat = strings.ReplaceAll(goformat, s+"d", "d")
+		goformat = strings.ReplaceAll(goformat, s+"f", "f")
+	}
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case *int8:
+			args[i] = gostring(v)
+		case bool:
+			if v {
+				args[i] = 1
+			} else {
+				args[i] = 0
+			}
+		}
+	}
+	fmt.Printf(goformat, args...)
+	return 0
+}
+
+type struct__IO_marker struct{}
+type struct__IO_codecvt struct{}
+type struct__IO_wide_data struct{}
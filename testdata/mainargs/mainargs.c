@@ -0,0 +1,25 @@
+#include <stdio.h>
+
+static int hasPrefix(const char *s, const char *prefix) {
+    while (*prefix) {
+        if (*s++ != *prefix++) {
+            return 0;
+        }
+    }
+    return 1;
+}
+
+int main(int argc, char **argv, char **envp) {
+    int n = 0, path = 0;
+    printf("argc > 0: %d\n", argc > 0);
+    printf("argv[argc] == NULL: %d\n", argv[argc] == NULL);
+    printf("argv[0] != \"\": %d\n", argv[0][0] != '\0');
+    for (char **env = envp; *env; env++) {
+        n++;
+        if (hasPrefix(*env, "PATH=")) {
+            path = 1;
+        }
+    }
+    printf("envp: %d %d\n", n > 0, path);
+    return argc - argc;
+}
@@ -0,0 +1,136 @@
+#include <stdio.h>
+#include <stddef.h>
+
+struct __attribute__((packed)) header {
+    char tag;
+    int len;
+    short flags;
+};
+
+#pragma pack(push, 2)
+struct pack2 {
+    char a;
+    int b;
+    char c;
+    int d __attribute__((aligned(8)));
+};
+#pragma pack(pop)
+
+#pragma pack(1)
+struct pack1 {
+    char a;
+    long long b;
+    struct header h;
+};
+#pragma pack()
+
+struct aligned {
+    char a;
+    int b __attribute__((aligned(8)));
+} __attribute__((aligned(16)));
+
+struct aligned16 {
+    int a;
+    int b;
+} __attribute__((aligned(16)));
+
+struct tailbits {
+    char a;
+    int :16;
+};
+
+struct fieldpacked {
+    char a;
+    int b __attribute__((packed));
+    char c;
+};
+
+struct __attribute__((packed, aligned(4))) packedaligned {
+    char a;
+    int b;
+};
+
+struct __attribute__((packed)) packedbits {
+    unsigned char lo :4, hi :4;
+    unsigned short port;
+    int :0;
+    char end;
+};
+
+struct outer {
+    char a;
+    struct header h;
+    struct aligned al;
+};
+
+union __attribute__((packed)) punion {
+    char c;
+    int i;
+};
+
+struct withunion {
+    char a;
+    union punion u;
+};
+
+static struct header ghdr = {'g', 0x12345678, -2};
+
+int sum(struct header *h) {
+    return h->tag + h->len + h->flags;
+}
+
+int main() {
+    printf("sizeof: %d %d %d %d %d %d %d %d %d %d\n",
+        (int)sizeof(struct header), (int)sizeof(struct pack2),
+        (int)sizeof(struct pack1), (int)sizeof(struct aligned),
+        (int)sizeof(struct fieldpacked), (int)sizeof(struct packedaligned),
+        (int)sizeof(struct packedbits), (int)sizeof(struct outer),
+        (int)sizeof(union punion), (int)sizeof(struct withunion));
+    printf("offsetof: %d %d %d %d %d %d %d %d %d\n",
+        (int)offsetof(struct header, len), (int)offsetof(struct header, flags),
+        (int)offsetof(struct pack2, d), (int)offsetof(struct pack1, h),
+        (int)offsetof(struct aligned, b), (int)offsetof(struct fieldpacked, c),
+        (int)offsetof(struct outer, h), (int)offsetof(struct outer, al),
+        (int)offsetof(struct withunion, u));
+
+    struct header h = {'h', 100, 7};
+    h.len += 23;
+    h.flags++;
+    printf("header: %c %d %d %d\n", h.tag, h.len, h.flags, sum(&h));
+    printf("ghdr: %c %x %d\n", ghdr.tag, ghdr.len, ghdr.flags);
+
+    struct header hs[3] = {{'a', 1, 2}, {.len = -5}};
+    hs[2] = hs[0];
+    hs[2].len = 1000;
+    struct header *p = &hs[1];
+    p->flags = 3;
+    printf("hs: %d %d %d %d %d\n", hs[0].len, hs[1].len, hs[1].flags, hs[2].tag, hs[2].len);
+    unsigned char *bytes = (unsigned char *)&hs[2];
+    printf("bytes: %d %d %d %d %d\n", bytes[0], bytes[1], bytes[2], bytes[3], bytes[4]);
+
+    struct pack2 p2 = {1, 2, 3, 4};
+    struct pack1 p1 = {5, 6LL << 40, {'x', 7, 8}};
+    printf("pack: %d %d %d %d %d %lld %c %d\n", p2.a, p2.b, p2.c, p2.d, p1.a, p1.b, p1.h.tag, p1.h.len);
+
+    struct aligned al = {9, 10};
+    struct fieldpacked fp = {11, 12, 13};
+    struct packedaligned pa = {14, 15};
+    printf("attrs: %d %d %d %d %d %d %d\n", al.a, al.b, fp.a, fp.b, fp.c, pa.a, pa.b);
+
+    struct aligned16 a16 = {16, 17};
+    struct aligned16 a16s[2] = {{18}};
+    struct tailbits tb = {19};
+    printf("tails: %d %d %d %d %d %d %d\n", (int)sizeof(a16), a16.a, a16.b,
+        a16s[0].a, a16s[1].b, (int)sizeof(tb), tb.a);
+
+    struct packedbits pb = {3, 12, 8080, 'e'};
+    pb.hi = pb.hi - 1;
+    printf("bits: %d %d %d %c\n", pb.lo, pb.hi, pb.port, pb.end);
+
+    struct outer o = {1, {'o', 2, 3}, {4, 5}};
+    struct withunion wu;
+    wu.a = 6;
+    wu.u.i = 0x01020304;
+    printf("outer: %c %d %d %d %d %d\n", o.h.tag, o.h.len, o.al.b, wu.a, wu.u.i, wu.u.c);
+    return 0;
+}
@@ -0,0 +1,91 @@
+#include <stdio.h>
+#include <setjmp.h>
+
+static jmp_buf top;
+
+static void fail(int code) {
+    printf("fail %d\n", code);
+    longjmp(top, code);
+}
+
+static int depth(int n) {
+    if (n == 0) {
+        fail(7);
+    }
+    return depth(n - 1) + 1;
+}
+
+static int protect(int n) {
+    volatile int tries = 0;
+    int ret = setjmp(top);
+    if (ret != 0) {
+        tries++;
+        printf("caught %d after %d tries\n", ret, tries);
+        if (tries < 3) {
+            fail(ret + 1);
+        }
+        return -ret;
+    }
+    return depth(n);
+}
+
+static jmp_buf inner;
+
+static int nested(int x) {
+    jmp_buf outer;
+    switch (setjmp(outer)) {
+    case 0:
+        break;
+    default:
+        printf("outer resumed\n");
+        return x * 10;
+    }
+    if (!setjmp(inner)) {
+        longjmp(inner, 0);
+    }
+    printf("inner resumed with 1\n");
+    for (int i = 0; i < 3; i++) {
+        if (i == x) {
+            longjmp(outer, 1);
+        }
+    }
+    return x;
+}
+
+static void passthrough(jmp_buf env) {
+    jmp_buf mine;
+    if (setjmp(mine) == 0) {
+        longjmp(env, 42);
+    }
+    printf("unreachable\n");
+}
+
+static void labeled(void) {
+    jmp_buf env;
+    int n = 0;
+again:
+    if (setjmp(env) < 2) {
+        n++;
+        printf("labeled %d\n", n);
+        longjmp(env, n);
+    }
+    printf("labeled done %d\n", n);
+    if (n < 4) {
+        n = 3;
+        goto again;
+    }
+}
+
+int main() {
+    jmp_buf env;
+    int v;
+    printf("protect: %d\n", protect(3));
+    printf("nested: %d\n", nested(2));
+    printf("nested: %d\n", nested(5));
+    if ((v = setjmp(env)) == 0) {
+        passthrough(env);
+    }
+    printf("passthrough: %d\n", v);
+    labeled();
+    return 0;
+}
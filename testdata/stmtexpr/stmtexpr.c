@@ -0,0 +1,63 @@
+#include <stdio.h>
+
+#define max(a, b) ({ __typeof__(a) _a = (a); __typeof__(b) _b = (b); _a > _b ? _a : _b; })
+#define square(x) ({ int t = (x); t * t; })
+
+static int calls;
+
+static int next(void) {
+    return ++calls;
+}
+
+static int sum(int n) {
+    return ({
+        int s = 0;
+        for (int i = 1; i <= n; i++) {
+            if (i == 3)
+                continue;
+            s += i;
+        }
+        s;
+    });
+}
+
+static int first_neg(int *a, int n) {
+    int i;
+    for (i = 0; i < n; i++) {
+        ({
+            if (a[i] < 0)
+                break;
+        });
+    }
+    return i;
+}
+
+static int find(int *a, int n, int v) {
+    return ({
+        int i = 0, r = -1;
+        while (i < n) {
+            if (a[i] == v)
+                goto found;
+            i++;
+        }
+        goto done;
+    found:
+        r = i;
+    done:
+        r;
+    });
+}
+
+int main() {
+    int a[] = {3, 1, -4, 1, 5};
+    printf("max: %d %d\n", max(next(), next()), calls);
+    printf("square: %d\n", square(max(2, 3) + 1));
+    printf("sum: %d\n", sum(5));
+    printf("first_neg: %d\n", first_neg(a, 5));
+    printf("find: %d %d\n", find(a, 5, 1), find(a, 5, 7));
+    double d = ({ double x = 1.5; x * 2; });
+    ({ printf("void: %g\n", d); });
+    (void)({ calls = 0; });
+    printf("calls: %d\n", calls);
+    return 0;
+}
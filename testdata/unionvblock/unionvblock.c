@@ -0,0 +1,36 @@
+#include <stdio.h>
+
+union Value {
+    int i;
+    double d;
+    char bytes[8];
+};
+
+static union Value make(int i) {
+    union Value v = {i};
+    return v;
+}
+
+int main() {
+    int n = 0;
+    double sum = 0;
+    if (n == 0) {
+        goto next; /* jumps into the loop, so its variables are hoisted */
+    }
+    while (n < 4) {
+        union Value a = {n + 1};
+        union Value b = {.d = 0.5 * n};
+        union Value c = a;
+        union Value d = make(n * 10);
+        union Value e = {.bytes = {'o', 'k'}};
+        union Value z = {};
+        printf("a=%d c=%d d=%d e=%s z=%d\n", a.i, c.i, d.i, e.bytes, z.i);
+        sum += b.d;
+        e.bytes[2] = '!'; /* the initializer must reset it next time */
+        z.i = n;
+    next:
+        n++;
+    }
+    printf("n=%d sum=%.1f\n", n, sum);
+    return 0;
+}